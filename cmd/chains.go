@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+	"github.com/chainflag/eth-faucet/internal/server"
+)
+
+// chainEntry describes one chain served by the faucet, the primary chain is built from flags
+// and additional ones are read from the JSON array in chains.file.
+type chainEntry struct {
+	Name          string  `json:"name"`
+	Network       string  `json:"network"`
+	Symbol        string  `json:"symbol"`
+	ShortName     string  `json:"short_name"`
+	AddressFormat string  `json:"address_format"`
+	Provider      string  `json:"provider"`
+	PrivateKey    string  `json:"privkey"`
+	KeyJSON       string  `json:"keyjson"`
+	KeyPass       string  `json:"keypass"`
+	Signer        string  `json:"signer"`
+	SignerAddress string  `json:"signer_address"`
+	ChainID       int64   `json:"chainid"`
+	Amount        float64 `json:"amount"`
+	AmountMax     float64 `json:"amount_max"`
+	TokenAddress  string  `json:"token_address"`
+	TokenAmount   float64 `json:"token_amount"`
+	TokenDecimals *int    `json:"token_decimals"`
+	TokenMinutes  int     `json:"token_minutes"`
+	BatchContract string  `json:"batch_contract"`
+	WrappedNative string  `json:"wrapped_native"`
+	// Bundle lists the payouts of every claim, an empty token sets the native amount
+	Bundle []bundleEntry `json:"bundle"`
+	// PoolKeys are the private keys of further wallets claims are sent from in turn
+	PoolKeys []string `json:"pool_keys"`
+}
+
+type bundleEntry struct {
+	Token    string  `json:"token"`
+	Amount   float64 `json:"amount"`
+	Decimals *int    `json:"decimals"`
+	// Minutes is the cooldown of the token per address, 0 sends it with every claim
+	Minutes int `json:"cooldown_minutes"`
+}
+
+// parseBundle reads comma separated token=amount entries, as in "=0.5,0xToken=100". A token
+// amount may be followed by its cooldown in minutes, as in "0xToken=100/1440".
+func parseBundle(value string) ([]bundleEntry, error) {
+	var bundle []bundleEntry
+	for _, item := range splitList(value) {
+		token, amount, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid bundle entry %q, expected token=amount", item)
+		}
+		amount, minutes, hasCooldown := strings.Cut(amount, "/")
+		parsed, err := strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle amount %q: %w", amount, err)
+		}
+		entry := bundleEntry{Token: token, Amount: parsed}
+		if hasCooldown {
+			if entry.Minutes, err = strconv.Atoi(minutes); err != nil || entry.Minutes < 0 {
+				return nil, fmt.Errorf("invalid bundle cooldown %q, expected minutes", minutes)
+			}
+		}
+		bundle = append(bundle, entry)
+	}
+	return bundle, nil
+}
+
+func readChainsFile(path string) ([]chainEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []chainEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// newSigner signs through the external signer of the entry, or else with its private key or keystore.
+func newSigner(entry chainEntry) (chain.Signer, error) {
+	if entry.Signer != "" {
+		signer, err := chain.NewExternalSigner(entry.Signer, entry.SignerAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to external signer: %w", err)
+		}
+		return signer, nil
+	}
+	privateKey, err := getPrivateKey(entry.PrivateKey, entry.KeyJSON, entry.KeyPass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	return chain.NewKeySigner(privateKey), nil
+}
+
+// newSigners returns the signer of the entry followed by those of its pool keys.
+func newSigners(entry chainEntry) ([]chain.Signer, error) {
+	signer, err := newSigner(entry)
+	if err != nil {
+		return nil, err
+	}
+	signers := []chain.Signer{signer}
+	for i, key := range entry.PoolKeys {
+		privateKey, err := getPrivateKey(strings.TrimSpace(key), "", "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pool key %d: %w", i+1, err)
+		}
+		signers = append(signers, chain.NewKeySigner(privateKey))
+	}
+	return signers, nil
+}
+
+func addChain(s *server.Server, entry chainEntry) error {
+	signers, err := newSigners(entry)
+	if err != nil {
+		return err
+	}
+	var chainID *big.Int
+	if entry.ChainID > 0 {
+		chainID = big.NewInt(entry.ChainID)
+	}
+
+	opts := []chain.Option{
+		chain.WithFeeMultiplier(*feeMultFlag),
+		chain.WithSendRetries(*sendRetryFlag, *sendWaitFlag),
+		chain.WithGasEstimation(*gasMultFlag, *gasDefaultFlag, *gasCapFlag),
+		chain.WithSendInterval(*sendSpaceFlag, *sendQueueFlag),
+	}
+	if *dryRunFlag {
+		opts = append(opts, chain.WithDryRun())
+	}
+	txBuilder, err := chain.NewSignerPool(entry.Provider, signers, chainID, opts...)
+	if err != nil {
+		return fmt.Errorf("cannot connect to web3 provider: %w", err)
+	}
+
+	chainCfg := server.ChainConfig{
+		Name:    entry.Name,
+		Network: entry.Network,
+		Symbol:  entry.Symbol,
+		Payout:  entry.Amount,
+	}
+	// Well known chains accept their EIP-3770 prefix without configuration
+	chainCfg.ShortName = entry.ShortName
+	if chainCfg.ShortName == "" {
+		chainCfg.ShortName = chain.ChainShortName(txBuilder.ChainID())
+	}
+	chainCfg.AddressFormat, err = chain.NewAddressFormat(entry.AddressFormat)
+	if err != nil {
+		return err
+	}
+	bundle := entry.Bundle
+	if entry.TokenAddress != "" {
+		bundle = append([]bundleEntry{{Token: entry.TokenAddress, Amount: entry.TokenAmount, Decimals: entry.TokenDecimals, Minutes: entry.TokenMinutes}}, bundle...)
+	}
+	for _, item := range bundle {
+		if item.Token == "" {
+			// The native payout is limited by the claim cooldown itself
+			if item.Minutes > 0 {
+				return errors.New("the native bundle entry has no cooldown of its own, it uses faucet.minutes")
+			}
+			chainCfg.Payout = item.Amount
+			continue
+		}
+		token, err := tokenPayout(txBuilder, item)
+		if err != nil {
+			return err
+		}
+		chainCfg.Tokens = append(chainCfg.Tokens, token)
+	}
+	if entry.AmountMax > 0 {
+		if entry.AmountMax < chainCfg.Payout {
+			return fmt.Errorf("invalid maximum amount %g below the amount %g", entry.AmountMax, chainCfg.Payout)
+		}
+		chainCfg.PayoutMax = entry.AmountMax
+	}
+
+	if entry.BatchContract != "" {
+		if !chain.IsValidAddress(entry.BatchContract, false) {
+			return fmt.Errorf("invalid batch contract address: %s", entry.BatchContract)
+		}
+		chainCfg.BatchContract = entry.BatchContract
+	}
+	if entry.WrappedNative != "" {
+		if !chain.IsValidAddress(entry.WrappedNative, false) {
+			return fmt.Errorf("invalid wrapped native token address: %s", entry.WrappedNative)
+		}
+		if entry.BatchContract != "" {
+			return errors.New("wrapped native payouts cannot be batched")
+		}
+		chainCfg.WrappedNative = entry.WrappedNative
+	}
+
+	return s.AddFaucet(txBuilder, chainCfg)
+}
+
+func tokenPayout(txBuilder chain.TxBuilder, item bundleEntry) (server.TokenPayout, error) {
+	if !chain.IsValidAddress(item.Token, false) {
+		return server.TokenPayout{}, fmt.Errorf("invalid token address: %s", item.Token)
+	}
+	token := server.TokenPayout{Address: item.Token, Amount: item.Amount, Cooldown: time.Duration(item.Minutes) * time.Minute}
+	if item.Decimals != nil {
+		token.Decimals = *item.Decimals
+		return token, nil
+	}
+	decimals, err := txBuilder.TokenDecimals(context.Background(), common.HexToAddress(item.Token))
+	if err != nil {
+		return server.TokenPayout{}, fmt.Errorf("failed to read decimals of token %s: %w", item.Token, err)
+	}
+	token.Decimals = int(decimals)
+	return token, nil
+}
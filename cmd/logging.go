@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/server"
+)
+
+// setupLogging applies the log format and level, and masks the configured secrets in every entry.
+func setupLogging(format, level string, secrets []string) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	var formatter log.Formatter
+	switch strings.ToLower(format) {
+	case "text":
+		formatter = &log.TextFormatter{}
+	case "json":
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	var pairs []string
+	for _, secret := range secrets {
+		if secret != "" {
+			pairs = append(pairs, secret, "[redacted]")
+		}
+	}
+	log.SetLevel(lvl)
+	log.AddHook(server.RequestIDHook{})
+	log.SetFormatter(&redactFormatter{Formatter: formatter, replacer: strings.NewReplacer(pairs...)})
+	return nil
+}
+
+// logSecrets lists the values that must never appear in logs, even where an error message
+// quotes them, such as a bot token in a failed API request URL.
+func logSecrets(config *server.Config, entries []chainEntry) []string {
+	secrets := []string{config.CaptchaSecret, config.CaptchaBypassToken, config.DiscordToken, config.TelegramToken, config.WebhookURL, config.LogPrivacyKey}
+	secrets = append(secrets, config.APIKeys...)
+	if u, err := url.Parse(config.RedisURL); err == nil {
+		if password, ok := u.User.Password(); ok {
+			secrets = append(secrets, password)
+		}
+	}
+	for _, entry := range entries {
+		// The bare hex also masks the key where it is printed with or without 0x
+		for _, key := range append([]string{entry.PrivateKey}, entry.PoolKeys...) {
+			secrets = append(secrets, strings.TrimPrefix(strings.TrimPrefix(key, "0x"), "0X"))
+		}
+	}
+	return secrets
+}
+
+// redactFormatter replaces secrets in the message and the string and error fields of an entry.
+type redactFormatter struct {
+	log.Formatter
+	replacer *strings.Replacer
+}
+
+func (f *redactFormatter) Format(entry *log.Entry) ([]byte, error) {
+	redacted := *entry
+	redacted.Message = f.replacer.Replace(entry.Message)
+	redacted.Data = make(log.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			redacted.Data[key] = f.replacer.Replace(v)
+		case error:
+			redacted.Data[key] = f.replacer.Replace(v.Error())
+		default:
+			redacted.Data[key] = value
+		}
+	}
+	return f.Formatter.Format(&redacted)
+}
@@ -1,15 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"errors"
 	"flag"
 	"fmt"
-	"math/big"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 
@@ -23,20 +25,154 @@ var (
 
 	httpPortFlag = flag.Int("httpport", 8080, "Listener port to serve HTTP connection")
 	proxyCntFlag = flag.Int("proxycount", 0, "Count of reverse proxies in front of the server")
+	realIPFlag   = flag.Bool("realip", false, "Read the client IP from the X-Real-IP header set by the reverse proxy")
+	trustedFlag  = flag.String("trustedproxies", os.Getenv("TRUSTED_PROXIES"), "Comma separated IPs and CIDR ranges of trusted reverse proxies, replaces proxycount")
+	tlsCertFlag  = flag.String("tls.cert", os.Getenv("TLS_CERT"), "Certificate file to serve HTTPS with, instead of a TLS terminating reverse proxy")
+	tlsKeyFlag   = flag.String("tls.key", os.Getenv("TLS_KEY"), "Private key file of tls.cert")
+	tlsHostFlag  = flag.String("tls.domain", os.Getenv("TLS_DOMAIN"), "Domain to serve HTTPS for with a certificate obtained from Let's Encrypt, instead of tls.cert")
+	tlsCacheFlag = flag.String("tls.cachedir", "certs", "Directory to cache the certificates of tls.domain in across restarts")
+	maxBodyFlag  = flag.Int64("maxbodysize", server.DefaultMaxBodySize, "Maximum size of a claim request body in bytes")
 	versionFlag  = flag.Bool("version", false, "Print version number")
+	redisURLFlag = flag.String("redis.url", os.Getenv("REDIS_URL"), "Redis URL to share rate limit state between instances")
 
-	payoutFlag   = flag.Float64("faucet.amount", 1, "Number of Ethers to transfer per user request")
-	intervalFlag = flag.Int("faucet.minutes", 1440, "Number of minutes to wait between funding rounds")
-	netnameFlag  = flag.String("faucet.name", os.Getenv("FAUCET_NAME"), "Network name to display on the frontend")
-	symbolFlag   = flag.String("faucet.symbol", "ETH", "Token symbol to display on the frontend")
+	logFormatFlag = flag.String("log.format", "text", "Log output format, text or json")
+	logLevelFlag  = flag.String("log.level", "info", "Minimum level of logged entries, one of debug, info, warn or error")
+	privacyFlag   = flag.Bool("log.privacy", false, "Log hashes of recipient addresses and client IPs instead of the raw values")
+	logKeyFlag    = flag.String("log.privacykey", os.Getenv("LOG_PRIVACY_KEY"), "HMAC key of the hashes logged in privacy mode, random per run when empty")
+	claimPathFlag = flag.String("claimpath", os.Getenv("CLAIM_PATH"), "Path to also accept claims of the primary chain at, as in /v2/faucet/request")
+	jsonRPCFlag   = flag.Bool("jsonrpc", false, "Serve faucet_claim and faucet_info as JSON-RPC 2.0 methods at /api/rpc")
 
-	keyJSONFlag  = flag.String("wallet.keyjson", os.Getenv("KEYSTORE"), "Keystore file to fund user requests with")
-	keyPassFlag  = flag.String("wallet.keypass", "password.txt", "Passphrase text file to decrypt keystore")
-	privKeyFlag  = flag.String("wallet.privkey", os.Getenv("PRIVATE_KEY"), "Private key hex to fund user requests with")
-	providerFlag = flag.String("wallet.provider", os.Getenv("WEB3_PROVIDER"), "Endpoint for Ethereum JSON-RPC connection")
+	stateFileFlag     = flag.String("state.file", os.Getenv("STATE_FILE"), "File to persist rate limit state across restarts when Redis is not used")
+	stateIntervalFlag = flag.Duration("state.interval", time.Minute, "Interval to save the rate limit state file")
+	totalsFileFlag    = flag.String("totals.file", os.Getenv("TOTALS_FILE"), "File to persist the lifetime claim and payout totals across restarts when Redis is not used")
+
+	corsOriginsFlag = flag.String("cors.origins", os.Getenv("CORS_ORIGINS"), "Comma separated origins allowed to call the API cross-origin, * allows any")
+	corsMethodsFlag = flag.String("cors.methods", "GET,POST", "Comma separated methods allowed in cross-origin requests")
+	corsHeadersFlag = flag.String("cors.headers", "", "Comma separated headers allowed in cross-origin requests, defaults to Content-Type and the captcha header")
+
+	geoDBFlag        = flag.String("geoip.db", os.Getenv("GEOIP_DB"), "MaxMind country database to filter claims by the country of the client IP, such as GeoLite2-Country.mmdb")
+	geoModeFlag      = flag.String("geoip.mode", server.GeoBlock, "Whether geoip.countries are the only countries allowed to claim, allow, or the ones rejected, block")
+	geoCountriesFlag = flag.String("geoip.countries", os.Getenv("GEOIP_COUNTRIES"), "Comma separated ISO 3166-1 alpha-2 country codes of geoip.mode")
+
+	chainsFileFlag = flag.String("chains.file", os.Getenv("CHAINS_FILE"), "JSON file of additional chains to serve from this process")
+
+	ensEnabledFlag  = flag.Bool("ens.enabled", false, "Resolve ENS names submitted in claims")
+	ensRegistryFlag = flag.String("ens.registry", "0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e", "ENS registry contract address")
+
+	payoutFlag     = flag.Float64("faucet.amount", 1, "Number of Ethers to transfer per user request")
+	payoutMaxFlag  = flag.Float64("faucet.amountmax", 0, "Randomize each payout between faucet.amount and this number of Ethers, 0 pays faucet.amount")
+	minPayoutFlag  = flag.Float64("faucet.minamount", 0, "Minimum number of Ethers a user may request")
+	maxPayoutFlag  = flag.Float64("faucet.maxamount", 0, "Maximum number of Ethers a user may request, defaults to faucet.amount")
+	budgetFlag     = flag.Float64("faucet.dailybudget", 0, "Maximum number of Ethers to transfer per 24 hours across all users, 0 disables the cap")
+	maxBalanceFlag = flag.Float64("faucet.maxbalance", 0, "Reject claims to addresses holding more Ethers than this, 0 disables the check")
+	minNonceFlag   = flag.Uint64("faucet.minnonce", 0, "Only fund addresses with at least this many sent transactions or a balance, 0 disables the check")
+	addrFieldsFlag = flag.String("faucet.addressfields", "address", "Comma separated claim fields or query parameters to read the address from, the first present wins")
+	signatureFlag  = flag.Bool("faucet.requiresignature", false, "Require claims to be signed by the claimed address over a nonce from /api/nonce")
+	nonceTTLFlag   = flag.Duration("faucet.noncettl", server.DefaultNonceTTL, "Time a nonce from /api/nonce may be signed and submitted")
+	checksumFlag   = flag.Bool("faucet.strictchecksum", false, "Reject addresses that are not EIP-55 checksummed instead of normalizing them")
+	intervalFlag   = flag.Int("faucet.minutes", 1440, "Number of minutes to wait between funding rounds")
+	ipIntervalFlag = flag.Int("faucet.ipminutes", -1, "Number of minutes to wait between funding rounds per IP, defaults to faucet.minutes")
+	newMinutesFlag = flag.Int("faucet.newminutes", 0, "Number of minutes new addresses, without transactions or balance, wait after their first claim, 0 uses faucet.minutes")
+	newAmountFlag  = flag.Float64("faucet.newamount", 0, "Number of Ethers to transfer to new addresses, without transactions or balance, 0 uses faucet.amount")
+	allowlistFlag  = flag.String("faucet.allowlist", os.Getenv("FAUCET_ALLOWLIST"), "Comma separated addresses, IPs and CIDR ranges exempt from rate limiting")
+	denylistFlag   = flag.String("faucet.denylist", os.Getenv("FAUCET_DENYLIST"), "Comma separated addresses, IPs and CIDR ranges rejected from claiming")
+	blockedFlag    = flag.String("faucet.blocked", os.Getenv("FAUCET_BLOCKED"), "Comma separated burn or contract addresses to never fund, besides the zero address")
+	contractsFlag  = flag.String("faucet.contracts", server.ContractsAllow, "Claims to contract addresses, one of allow, warn or reject")
+	allowFileFlag  = flag.String("faucet.allowlistfile", "", "File of allowlist entries, one per line, reloaded on SIGHUP")
+	denyFileFlag   = flag.String("faucet.denylistfile", "", "File of denylist entries, one per line, reloaded on SIGHUP")
+	aclReloadFlag  = flag.Duration("faucet.listreload", 0, "Interval to reload the allowlist and denylist files, 0 reloads on SIGHUP only")
+	ipBucketsFlag  = flag.Int("faucet.ipclaims", server.DefaultIPBuckets, "Number of claims allowed per IP within faucet.ipminutes")
+	slidingFlag    = flag.Bool("faucet.slidingwindow", false, "Restart the cooldown whenever a rate limited client claims again")
+	bucketFlag     = flag.Bool("faucet.tokenbucket", false, "Limit claims by token buckets that allow a burst and refill at the rate of the cooldowns, instead of fixed windows")
+	burstFlag      = flag.Int("faucet.burst", 1, "Number of claims an address may make at once with faucet.tokenbucket, gaining one every faucet.minutes")
+	ipBurstFlag    = flag.Int("faucet.ipburst", 0, "Number of claims an IP may make at once with faucet.tokenbucket, defaults to faucet.ipclaims")
+	roundingFlag   = flag.Duration("faucet.waitrounding", 0, "Granularity to round the wait shown to rate limited users up to, as in 1m or 1h")
+	sharedFlag     = flag.Bool("faucet.sharedcooldowns", false, "Share cooldowns between all chains served, instead of limiting each chain on its own")
+	limitKeyFlag   = flag.String("faucet.limitkey", server.LimitKeyEither, "Rate limit keying, either to limit addresses and IPs separately or pair to limit each address per IP")
+	storeFailFlag  = flag.String("faucet.storefailure", server.StoreFailOpen, "Claims while the rate limit store fails, open to let them through or closed to reject them")
+	ipv6PrefixFlag = flag.Int("faucet.ipv6prefix", server.DefaultIPv6Prefix, "Prefix length IPv6 clients are rate limited by")
+	readLimitFlag  = flag.Int("faucet.readlimit", 60, "Number of info, status, job and claims requests allowed per IP within faucet.readwindow, 0 disables the limit")
+	readWindowFlag = flag.Duration("faucet.readwindow", time.Minute, "Window of faucet.readlimit")
+	chainNameFlag  = flag.String("faucet.chain", os.Getenv("FAUCET_CHAIN"), "Name to also serve the chain under, as in /api/{name}/claim")
+	netnameFlag    = flag.String("faucet.name", os.Getenv("FAUCET_NAME"), "Network name to display on the frontend")
+	symbolFlag     = flag.String("faucet.symbol", "ETH", "Token symbol to display on the frontend")
+	messagesFlag   = flag.String("faucet.messages", "", "JSON file of response templates per language, replacing the English texts")
+	shortNameFlag  = flag.String("faucet.shortname", "", "EIP-3770 chain short name claimed addresses may be prefixed with, known for well known chains")
+	addrFormatFlag = flag.String("faucet.addressformat", "evm", "Format of recipient addresses, evm, bech32:{prefix} or tron, non-evm formats accept hex addresses too")
+
+	queueWorkersFlag = flag.Int("queue.workers", 1, "Number of workers sending transactions concurrently")
+	queueSizeFlag    = flag.Int("queue.size", 100, "Number of claims that may wait for a worker before new ones are rejected")
+	asyncClaimsFlag  = flag.Bool("queue.async", false, "Answer claims with a job ID instead of waiting for the transaction")
+	shutdownFlag     = flag.Duration("queue.shutdowntimeout", 30*time.Second, "Maximum time to wait for pending claims on shutdown")
+
+	historySizeFlag = flag.Int("history.size", 0, "Number of recent claims to list at /api/claims, 0 disables the endpoint")
+	historyHashFlag = flag.Bool("history.hashaddresses", false, "List hashed instead of shortened addresses at /api/claims")
+
+	batchContractFlag = flag.String("batch.contract", os.Getenv("BATCH_CONTRACT"), "Disperse contract to send the payouts of concurrent claims in one transaction")
+	batchWindowFlag   = flag.Duration("batch.window", server.DefaultBatchWindow, "Time to collect claims into one batch transaction")
+	batchSizeFlag     = flag.Int("batch.size", server.DefaultBatchSize, "Maximum number of claims in one batch transaction")
+
+	wrappedNativeFlag = flag.String("faucet.weth", os.Getenv("FAUCET_WETH"), "WETH style contract to wrap the native payout into before sending it")
+
+	waitReceiptFlag    = flag.Bool("tx.waitreceipt", false, "Wait for the transaction receipt before reporting a claim as successful")
+	receiptTimeoutFlag = flag.Duration("tx.receipttimeout", 30*time.Second, "Maximum time to wait for a transaction receipt")
+	confirmationsFlag  = flag.Uint64("tx.confirmations", 0, "Number of blocks to wait for on top of the receipt before reporting a claim as successful")
+	dryRunFlag         = flag.Bool("tx.dryrun", false, "Sign and validate transactions without broadcasting them, for testing deployments")
+
+	tokenAddressFlag  = flag.String("token.address", os.Getenv("TOKEN_ADDRESS"), "ERC-20 token contract to transfer per user request")
+	tokenAmountFlag   = flag.Float64("token.amount", 0, "Number of ERC-20 tokens to transfer per user request")
+	tokenDecimalsFlag = flag.Int("token.decimals", -1, "ERC-20 token decimals, read from the contract when negative")
+	tokenMinutesFlag  = flag.Int("token.minutes", 0, "Number of minutes to wait between two token payouts to an address, 0 sends the token with every claim")
+	tokenBundleFlag   = flag.String("token.bundle", os.Getenv("TOKEN_BUNDLE"), "Comma separated token=amount payouts of every request, an empty token sets the native amount")
+
+	keyJSONFlag    = flag.String("wallet.keyjson", os.Getenv("KEYSTORE"), "Keystore file to fund user requests with")
+	keyPassFlag    = flag.String("wallet.keypass", "password.txt", "Passphrase text file to decrypt keystore")
+	privKeyFlag    = flag.String("wallet.privkey", os.Getenv("PRIVATE_KEY"), "Private key hex to fund user requests with")
+	signerFlag     = flag.String("wallet.signer", os.Getenv("SIGNER_URL"), "Endpoint of a clef compatible external signer holding the key, instead of a private key or keystore")
+	signerAddrFlag = flag.String("wallet.signeraddress", os.Getenv("SIGNER_ADDRESS"), "Account of the external signer to fund user requests with, its first account when empty")
+	poolKeysFlag   = flag.String("wallet.poolkeys", os.Getenv("POOL_PRIVATE_KEYS"), "Comma separated private keys of further wallets to send claims from in turn, for throughput")
+	providerFlag   = flag.String("wallet.provider", os.Getenv("WEB3_PROVIDER"), "Endpoint for Ethereum JSON-RPC connection, http(s):// or ws(s)://")
+	chainIDFlag    = flag.Int64("wallet.chainid", 0, "Chain ID the provider must serve or the faucet refuses to start, known for goerli and sepolia")
+	rpcTimeoutFlag = flag.Duration("wallet.rpctimeout", server.DefaultRPCTimeout, "Maximum time to wait for each JSON-RPC call made for a claim")
+	sendRetryFlag  = flag.Int("wallet.sendretries", 2, "Number of times to resend a transaction after a transient RPC error")
+	sendWaitFlag   = flag.Duration("wallet.sendbackoff", 500*time.Millisecond, "Wait before the first resend, doubled for each further one")
+	sendSpaceFlag  = flag.Duration("wallet.sendinterval", 0, "Minimum time between two transactions of a wallet, 0 sends as fast as claims arrive")
+	sendQueueFlag  = flag.Duration("wallet.sendmaxwait", 2*time.Second, "Maximum time a transaction waits for its turn under wallet.sendinterval before the claim is answered busy")
+	maxGasFlag     = flag.Float64("wallet.maxgasprice", 0, "Reject claims while the max fee per gas is above this many gwei, 0 disables the cap")
+	feeMultFlag    = flag.Float64("wallet.feemultiplier", 2, "Multiple of the base fee to bid as max fee per gas on EIP-1559 chains")
+	gasMultFlag    = flag.Float64("wallet.gasmultiplier", 1, "Multiple of the estimated gas to use as the gas limit of transactions")
+	gasDefaultFlag = flag.Uint64("wallet.gaslimit", 0, "Gas limit of transactions whose estimation fails, native transfers fall back to 21000 when 0")
+	gasCapFlag     = flag.Uint64("wallet.maxgas", 0, "Reject transactions estimated to use more gas, 0 disables the cap")
+
+	discordTokenFlag  = flag.String("discord.token", os.Getenv("DISCORD_TOKEN"), "Discord bot token to enable the /faucet slash command")
+	discordGuildFlag  = flag.String("discord.guild", os.Getenv("DISCORD_GUILD"), "Discord server ID to register the command in, registers globally when empty")
+	telegramTokenFlag = flag.String("telegram.token", os.Getenv("TELEGRAM_TOKEN"), "Telegram bot token to enable the /faucet command")
+
+	webhookURLFlag    = flag.String("webhook.url", os.Getenv("WEBHOOK_URL"), "Slack or Discord compatible webhook to notify of faucet events")
+	webhookEventsFlag = flag.String("webhook.events", "claim,low_balance", "Comma separated events to notify, claim and low_balance")
+	lowBalanceFlag    = flag.Float64("webhook.lowbalance", 0, "Notify when the wallet holds fewer Ethers than this, 0 only notifies when out of funds")
+
+	apiKeysFlag     = flag.String("apikey.keys", os.Getenv("API_KEYS"), "Comma separated API keys whose claims skip the captcha and public rate limits")
+	apiIntervalFlag = flag.Int("apikey.minutes", 0, "Number of minutes to wait between funding an address for API key claims, 0 disables the limit")
+
+	captchaProviderFlag = flag.String("captcha.provider", os.Getenv("CAPTCHA_PROVIDER"), "Captcha provider to verify requests with, hcaptcha, turnstile or recaptcha")
+	captchaHeaderFlag   = flag.String("captcha.header", "", "Request header to read the captcha token from, defaults to the provider's header")
+	captchaFailOpenFlag = flag.Bool("captcha.failopen", false, "Accept claims unverified while the captcha provider is unreachable or failing")
+	captchaBypassFlag   = flag.String("captcha.bypasstoken", os.Getenv("CAPTCHA_BYPASS_TOKEN"), "Token accepted as a solved captcha, for integration tests only")
+	captchaTimeoutFlag  = flag.Duration("captcha.timeout", server.DefaultCaptchaTimeout, "Timeout of a captcha verification call to the provider")
+	captchaInFlightFlag = flag.Int("captcha.maxinflight", 0, "Maximum number of concurrent captcha verifications, claims over it are answered 503, 0 is unlimited")
+	captchaStatusFlag   = flag.Int("captcha.failurestatus", server.DefaultCaptchaFailureStatus, "HTTP status to answer failed captcha verifications with")
 
 	hcaptchaSiteKeyFlag = flag.String("hcaptcha.sitekey", os.Getenv("HCAPTCHA_SITEKEY"), "hCaptcha sitekey")
 	hcaptchaSecretFlag  = flag.String("hcaptcha.secret", os.Getenv("HCAPTCHA_SECRET"), "hCaptcha secret")
+
+	turnstileSiteKeyFlag = flag.String("turnstile.sitekey", os.Getenv("TURNSTILE_SITEKEY"), "Cloudflare Turnstile sitekey")
+	turnstileSecretFlag  = flag.String("turnstile.secret", os.Getenv("TURNSTILE_SECRET"), "Cloudflare Turnstile secret")
+
+	recaptchaSiteKeyFlag  = flag.String("recaptcha.sitekey", os.Getenv("RECAPTCHA_SITEKEY"), "reCAPTCHA v3 sitekey")
+	recaptchaSecretFlag   = flag.String("recaptcha.secret", os.Getenv("RECAPTCHA_SECRET"), "reCAPTCHA v3 secret")
+	recaptchaMinScoreFlag = flag.Float64("recaptcha.minscore", 0.5, "Minimum reCAPTCHA v3 score to accept a request")
+	recaptchaActionFlag   = flag.String("recaptcha.action", "claim", "reCAPTCHA v3 action name expected in verified tokens")
 )
 
 func init() {
@@ -48,20 +184,6 @@ func init() {
 }
 
 func Execute() {
-	privateKey, err := getPrivateKeyFromFlags()
-	if err != nil {
-		panic(fmt.Errorf("failed to read private key: %w", err))
-	}
-	var chainID *big.Int
-	if value, ok := chainIDMap[strings.ToLower(*netnameFlag)]; ok {
-		chainID = big.NewInt(int64(value))
-	}
-
-	txBuilder, err := chain.NewTxBuilder(*providerFlag, privateKey, chainID)
-	if err != nil {
-		panic(fmt.Errorf("cannot connect to web3 provider: %w", err))
-	}
-
 	var payoutAmount = *payoutFlag
 	var payoutInterval = *intervalFlag
 
@@ -74,33 +196,265 @@ func Execute() {
 		payoutInterval = int(payoutInterval_)
 	}
 
-	config := server.NewConfig(*netnameFlag, *symbolFlag, *httpPortFlag, payoutInterval, payoutAmount, *proxyCntFlag, *hcaptchaSiteKeyFlag, *hcaptchaSecretFlag)
-	go server.NewServer(txBuilder, config).Run()
+	var ipInterval = *ipIntervalFlag
+	if os.Getenv("FAUCET_IP_INTERVAL") != "" {
+		ipInterval_, _ := strconv.ParseInt(os.Getenv("FAUCET_IP_INTERVAL"), 10, 64)
+		ipInterval = int(ipInterval_)
+	}
+	if ipInterval < 0 {
+		ipInterval = payoutInterval
+	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
+	config := &server.Config{
+		HTTPPort:            *httpPortFlag,
+		ClaimPath:           *claimPathFlag,
+		JSONRPC:             *jsonRPCFlag,
+		Interval:            payoutInterval,
+		IPInterval:          ipInterval,
+		NewAddressInterval:  *newMinutesFlag,
+		NewAddressPayout:    *newAmountFlag,
+		IPBuckets:           *ipBucketsFlag,
+		ReadLimit:           *readLimitFlag,
+		ReadWindow:          *readWindowFlag,
+		IPv6Prefix:          *ipv6PrefixFlag,
+		SlidingWindow:       *slidingFlag,
+		TokenBucket:         *bucketFlag,
+		AddressBurst:        *burstFlag,
+		IPBurst:             *ipBurstFlag,
+		WaitRounding:        *roundingFlag,
+		LimitKey:            strings.ToLower(*limitKeyFlag),
+		StoreFailure:        strings.ToLower(*storeFailFlag),
+		SharedCooldowns:     *sharedFlag,
+		Allowlist:           splitList(*allowlistFlag),
+		Denylist:            splitList(*denylistFlag),
+		AllowlistFile:       *allowFileFlag,
+		DenylistFile:        *denyFileFlag,
+		AccessListInterval:  *aclReloadFlag,
+		MinPayout:           *minPayoutFlag,
+		MaxPayout:           *maxPayoutFlag,
+		ProxyCount:          *proxyCntFlag,
+		RealIP:              *realIPFlag,
+		TrustedProxies:      splitList(*trustedFlag),
+		TLSCertFile:         *tlsCertFlag,
+		TLSKeyFile:          *tlsKeyFlag,
+		TLSDomain:           *tlsHostFlag,
+		TLSCacheDir:         *tlsCacheFlag,
+		GeoIPDatabase:       *geoDBFlag,
+		GeoIPMode:           *geoModeFlag,
+		GeoIPCountries:      splitList(*geoCountriesFlag),
+		CORSOrigins:         splitList(*corsOriginsFlag),
+		CORSMethods:         splitList(*corsMethodsFlag),
+		CORSHeaders:         splitList(*corsHeadersFlag),
+		DailyBudget:         *budgetFlag,
+		MaxRecipientBalance: *maxBalanceFlag,
+		MinRecipientNonce:   *minNonceFlag,
+		StrictChecksum:      *checksumFlag,
+		RequireSignature:    *signatureFlag,
+		NonceTTL:            *nonceTTLFlag,
+		AddressFields:       splitList(*addrFieldsFlag),
+		MaxBodySize:         *maxBodyFlag,
+		BlockedAddresses:    splitList(*blockedFlag),
+		ContractRecipients:  strings.ToLower(*contractsFlag),
+		RedisURL:            *redisURLFlag,
+		StateFile:           *stateFileFlag,
+		StateInterval:       *stateIntervalFlag,
+		TotalsFile:          *totalsFileFlag,
+		QueueWorkers:        *queueWorkersFlag,
+		QueueSize:           *queueSizeFlag,
+		AsyncClaims:         *asyncClaimsFlag,
+		ShutdownTimeout:     *shutdownFlag,
+		HistorySize:         *historySizeFlag,
+		HistoryPrivacy:      *historyHashFlag,
+		BatchWindow:         *batchWindowFlag,
+		BatchSize:           *batchSizeFlag,
+		RPCTimeout:          *rpcTimeoutFlag,
+		MaxGasPrice:         *maxGasFlag,
+		WaitReceipt:         *waitReceiptFlag,
+		DryRun:              *dryRunFlag,
+		LogPrivacy:          *privacyFlag,
+		LogPrivacyKey:       *logKeyFlag,
+		ReceiptTimeout:      *receiptTimeoutFlag,
+		Confirmations:       *confirmationsFlag,
+		DiscordToken:        *discordTokenFlag,
+		DiscordGuildID:      *discordGuildFlag,
+		TelegramToken:       *telegramTokenFlag,
+		APIKeys:             splitList(*apiKeysFlag),
+		APIKeyInterval:      *apiIntervalFlag,
+		WebhookURL:          *webhookURLFlag,
+		WebhookEvents:       splitList(*webhookEventsFlag),
+		LowBalance:          *lowBalanceFlag,
+		CaptchaProvider:     *captchaProviderFlag,
+		CaptchaSiteKey:      *hcaptchaSiteKeyFlag,
+		CaptchaSecret:       *hcaptchaSecretFlag,
+		CaptchaHeader:       *captchaHeaderFlag,
+		CaptchaStatus:       *captchaStatusFlag,
+		CaptchaFailOpen:     *captchaFailOpenFlag,
+		CaptchaBypassToken:  *captchaBypassFlag,
+		CaptchaTimeout:      *captchaTimeoutFlag,
+		CaptchaMaxInFlight:  *captchaInFlightFlag,
+	}
+	switch config.ContractRecipients {
+	case server.ContractsAllow, server.ContractsWarn, server.ContractsReject:
+	default:
+		panic(fmt.Errorf("invalid faucet.contracts mode: %s", *contractsFlag))
+	}
+	if config.ClaimPath != "" && !strings.HasPrefix(config.ClaimPath, "/") {
+		panic(fmt.Errorf("invalid claimpath, must start with /: %s", config.ClaimPath))
+	}
+	switch config.LimitKey {
+	case server.LimitKeyEither, server.LimitKeyPair:
+	default:
+		panic(fmt.Errorf("invalid faucet.limitkey mode: %s", *limitKeyFlag))
+	}
+	if config.TokenBucket && config.SlidingWindow {
+		panic(fmt.Errorf("invalid rate limit mode, faucet.tokenbucket excludes faucet.slidingwindow"))
+	}
+	if config.AddressBurst < 1 || config.IPBurst < 0 {
+		panic(fmt.Errorf("invalid faucet.burst or faucet.ipburst, must be positive: %d, %d", config.AddressBurst, config.IPBurst))
+	}
+	if config.NewAddressInterval < 0 || config.NewAddressPayout < 0 {
+		panic(fmt.Errorf("invalid faucet.newminutes or faucet.newamount, must not be negative: %d, %g", config.NewAddressInterval, config.NewAddressPayout))
+	}
+	switch config.StoreFailure {
+	case server.StoreFailOpen, server.StoreFailClosed:
+	default:
+		panic(fmt.Errorf("invalid faucet.storefailure mode: %s", *storeFailFlag))
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		panic(fmt.Errorf("invalid TLS configuration, tls.cert and tls.key must be set together"))
+	}
+	if config.TLSDomain != "" && config.TLSCertFile != "" {
+		panic(fmt.Errorf("invalid TLS configuration, tls.domain obtains its own certificate and excludes tls.cert"))
+	}
+	if (config.TLSDomain != "" || config.TLSCertFile != "") && (config.ProxyCount > 0 || config.RealIP || len(config.TrustedProxies) > 0) {
+		panic(fmt.Errorf("invalid TLS configuration, serving TLS directly excludes proxycount, trustedproxies and realip"))
+	}
+	if config.GeoIPMode != server.GeoAllow && config.GeoIPMode != server.GeoBlock {
+		panic(fmt.Errorf("invalid geoip.mode, must be allow or block: %s", config.GeoIPMode))
+	}
+	if config.GeoIPMode == server.GeoAllow && config.GeoIPDatabase != "" && len(config.GeoIPCountries) == 0 {
+		panic(fmt.Errorf("invalid GeoIP configuration, geoip.mode allow requires geoip.countries"))
+	}
+	if config.CaptchaBypassToken != "" && len(config.CaptchaBypassToken) < 16 {
+		panic(fmt.Errorf("invalid captcha.bypasstoken, must be at least 16 characters"))
+	}
+	if config.CaptchaTimeout <= 0 || config.CaptchaMaxInFlight < 0 {
+		panic(fmt.Errorf("invalid captcha.timeout or captcha.maxinflight: %s, %d", config.CaptchaTimeout, config.CaptchaMaxInFlight))
+	}
+	if *captchaStatusFlag < 400 || *captchaStatusFlag > 499 {
+		panic(fmt.Errorf("invalid captcha.failurestatus, must be a 4xx status: %d", *captchaStatusFlag))
+	}
+	if *ensEnabledFlag {
+		if !chain.IsValidAddress(*ensRegistryFlag, false) {
+			panic(fmt.Errorf("invalid ENS registry address: %s", *ensRegistryFlag))
+		}
+		config.ENSRegistry = *ensRegistryFlag
+	}
+	if *messagesFlag != "" {
+		messages, err := server.LoadMessages(*messagesFlag)
+		if err != nil {
+			panic(fmt.Errorf("failed to read messages file: %w", err))
+		}
+		config.Messages = messages
+	}
+
+	switch strings.ToLower(*captchaProviderFlag) {
+	case server.TurnstileProvider:
+		config.CaptchaSiteKey = *turnstileSiteKeyFlag
+		config.CaptchaSecret = *turnstileSecretFlag
+	case server.ReCaptchaProvider:
+		config.CaptchaSiteKey = *recaptchaSiteKeyFlag
+		config.CaptchaSecret = *recaptchaSecretFlag
+		config.CaptchaMinScore = *recaptchaMinScoreFlag
+		config.CaptchaAction = *recaptchaActionFlag
+	}
+
+	primary := chainEntry{
+		Name:          *chainNameFlag,
+		Network:       *netnameFlag,
+		Symbol:        *symbolFlag,
+		ShortName:     *shortNameFlag,
+		AddressFormat: *addrFormatFlag,
+		Provider:      *providerFlag,
+		PrivateKey:    *privKeyFlag,
+		KeyJSON:       *keyJSONFlag,
+		KeyPass:       *keyPassFlag,
+		Signer:        *signerFlag,
+		SignerAddress: *signerAddrFlag,
+		PoolKeys:      splitList(*poolKeysFlag),
+		Amount:        payoutAmount,
+		AmountMax:     *payoutMaxFlag,
+		TokenAddress:  *tokenAddressFlag,
+		TokenAmount:   *tokenAmountFlag,
+		TokenMinutes:  *tokenMinutesFlag,
+		BatchContract: *batchContractFlag,
+		WrappedNative: *wrappedNativeFlag,
+	}
+	if value, ok := chainIDMap[strings.ToLower(*netnameFlag)]; ok {
+		primary.ChainID = int64(value)
+	}
+	if *chainIDFlag != 0 {
+		primary.ChainID = *chainIDFlag
+	}
+	if *tokenDecimalsFlag >= 0 {
+		primary.TokenDecimals = tokenDecimalsFlag
+	}
+	bundle, err := parseBundle(*tokenBundleFlag)
+	if err != nil {
+		panic(err)
+	}
+	primary.Bundle = bundle
+	entries := []chainEntry{primary}
+	if *chainsFileFlag != "" {
+		extra, err := readChainsFile(*chainsFileFlag)
+		if err != nil {
+			panic(fmt.Errorf("failed to read chains file: %w", err))
+		}
+		entries = append(entries, extra...)
+	}
+
+	if err := setupLogging(*logFormatFlag, *logLevelFlag, logSecrets(config, entries)); err != nil {
+		panic(fmt.Errorf("invalid logging configuration: %w", err))
+	}
+
+	faucetServer := server.NewServer(config)
+	for _, entry := range entries {
+		if err := addChain(faucetServer, entry); err != nil {
+			panic(fmt.Errorf("failed to set up chain %q: %w", entry.Name, err))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	faucetServer.Run(ctx)
 }
 
-func getPrivateKeyFromFlags() (*ecdsa.PrivateKey, error) {
-	if *privKeyFlag != "" {
-		hexkey := *privKeyFlag
+func getPrivateKey(privKey, keyJSON, keyPass string) (*ecdsa.PrivateKey, error) {
+	if privKey != "" {
+		hexkey := privKey
 		if chain.Has0xPrefix(hexkey) {
 			hexkey = hexkey[2:]
 		}
 		return crypto.HexToECDSA(hexkey)
-	} else if *keyJSONFlag == "" {
+	} else if keyJSON == "" {
 		return nil, errors.New("missing private key or keystore")
 	}
 
-	keyfile, err := chain.ResolveKeyfilePath(*keyJSONFlag)
+	keyfile, err := chain.ResolveKeyfilePath(keyJSON)
 	if err != nil {
 		return nil, err
 	}
-	password, err := os.ReadFile(*keyPassFlag)
+	password, err := os.ReadFile(keyPass)
 	if err != nil {
 		return nil, err
 	}
 
 	return chain.DecryptKeyfile(keyfile, strings.TrimRight(string(password), "\r\n"))
 }
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
@@ -0,0 +1,226 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AddressFormat validates the recipient addresses of a chain and returns the account they
+// denote. Chains writing addresses in another form than hex, such as bech32 or base58, decode
+// them to the 20 byte account the faucet pays, as their EVM layer does.
+type AddressFormat interface {
+	ParseAddress(address string) (common.Address, error)
+}
+
+// AddressFormatFactory creates a format from the parameter of its spec, see NewAddressFormat.
+type AddressFormatFactory func(param string) (AddressFormat, error)
+
+var errInvalidAddress = errors.New("invalid address")
+
+var (
+	addressFormatsMu sync.RWMutex
+	addressFormats   = map[string]AddressFormatFactory{
+		"bech32": newBech32Format,
+		"tron":   newTronFormat,
+	}
+)
+
+// RegisterAddressFormat makes the format created by factory available to NewAddressFormat
+// under name, replacing a format registered before.
+func RegisterAddressFormat(name string, factory AddressFormatFactory) {
+	addressFormatsMu.Lock()
+	defer addressFormatsMu.Unlock()
+	addressFormats[strings.ToLower(name)] = factory
+}
+
+// NewAddressFormat returns the format of spec, a registered name optionally followed by a
+// parameter, as in "bech32:evmos" or "tron". It returns nil for the hex addresses of EVM
+// chains, when spec is empty or "evm".
+func NewAddressFormat(spec string) (AddressFormat, error) {
+	name, param, _ := strings.Cut(spec, ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "evm" {
+		return nil, nil
+	}
+	addressFormatsMu.RLock()
+	factory, ok := addressFormats[name]
+	addressFormatsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown address format %q", name)
+	}
+	return factory(strings.TrimSpace(param))
+}
+
+// EVMAddressFormat accepts hex addresses, only EIP-55 checksummed ones when checksummed.
+type EVMAddressFormat bool
+
+func (checksummed EVMAddressFormat) ParseAddress(address string) (common.Address, error) {
+	if !IsValidAddress(address, bool(checksummed)) {
+		return common.Address{}, errInvalidAddress
+	}
+	return common.HexToAddress(address), nil
+}
+
+// bech32Format accepts bech32 addresses with its human readable part, as Evmos and other
+// Cosmos SDK chains with an EVM write them, besides hex addresses.
+type bech32Format struct {
+	hrp string
+}
+
+func newBech32Format(hrp string) (AddressFormat, error) {
+	if hrp == "" {
+		return nil, errors.New("the bech32 address format needs a prefix, as in bech32:evmos")
+	}
+	return bech32Format{hrp: strings.ToLower(hrp)}, nil
+}
+
+func (f bech32Format) ParseAddress(address string) (common.Address, error) {
+	if common.IsHexAddress(address) {
+		return common.HexToAddress(address), nil
+	}
+	hrp, data, err := decodeBech32(address)
+	if err != nil || hrp != f.hrp {
+		return common.Address{}, errInvalidAddress
+	}
+	account, err := convertBits(data, 5, 8)
+	if err != nil || len(account) != common.AddressLength {
+		return common.Address{}, errInvalidAddress
+	}
+	return common.BytesToAddress(account), nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// decodeBech32 returns the human readable part and the 5 bit data of a BIP-173 string.
+func decodeBech32(s string) (string, []byte, error) {
+	if len(s) > 90 || (strings.ToLower(s) != s && strings.ToUpper(s) != s) {
+		return "", nil, errInvalidAddress
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, errInvalidAddress
+	}
+	hrp := s[:sep]
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			return "", nil, errInvalidAddress
+		}
+		data = append(data, byte(d))
+	}
+	if bech32Polymod(append(bech32ExpandHRP(hrp), data...)) != 1 {
+		return "", nil, errInvalidAddress
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32ExpandHRP(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// convertBits regroups data of from bit values into to bit values, rejecting non-zero padding.
+func convertBits(data []byte, from, to uint) ([]byte, error) {
+	var acc, bits uint
+	out := make([]byte, 0, len(data)*int(from)/int(to))
+	for _, value := range data {
+		acc = acc<<from | uint(value)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&(1<<to-1)))
+		}
+	}
+	if bits >= from || acc&(1<<bits-1) != 0 {
+		return nil, errInvalidAddress
+	}
+	return out, nil
+}
+
+// tronFormat accepts the base58check addresses of Tron, as in T..., besides hex addresses
+// with or without Tron's 41 prefix.
+type tronFormat struct{}
+
+const tronAddressPrefix = 0x41
+
+func newTronFormat(param string) (AddressFormat, error) {
+	if param != "" {
+		return nil, fmt.Errorf("the tron address format takes no parameter: %s", param)
+	}
+	return tronFormat{}, nil
+}
+
+func (tronFormat) ParseAddress(address string) (common.Address, error) {
+	if common.IsHexAddress(address) {
+		return common.HexToAddress(address), nil
+	}
+	if len(address) == 42 && strings.HasPrefix(address, "41") && common.IsHexAddress(address[2:]) {
+		return common.HexToAddress(address[2:]), nil
+	}
+	decoded, err := decodeBase58(address)
+	if err != nil || len(decoded) != 1+common.AddressLength+4 || decoded[0] != tronAddressPrefix {
+		return common.Address{}, errInvalidAddress
+	}
+	payload, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return common.Address{}, errInvalidAddress
+	}
+	return common.BytesToAddress(payload[1:]), nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func decodeBase58(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errInvalidAddress
+	}
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base58Alphabet, s[i])
+		if digit < 0 {
+			return nil, errInvalidAddress
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+	// Every leading 1 stands for a leading zero byte
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), value.Bytes()...), nil
+}
@@ -0,0 +1,65 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestAddressFormats(t *testing.T) {
+	account := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	tests := []struct {
+		spec    string
+		address string
+		want    common.Address
+		wantErr bool
+	}{
+		{spec: "bech32:evmos", address: "evmos14dvqrf7nnq63hzlpr3peupw9kvje4myms5wfhd", want: account},
+		{spec: "bech32:evmos", address: "EVMOS14DVQRF7NNQ63HZLPR3PEUPW9KVJE4MYMS5WFHD", want: account},
+		{spec: "bech32:evmos", address: "0xab5801a7d398351b8be11c439e05c5b3259aec9b", want: account},
+		{spec: "bech32:evmos", address: "evmos14dvqrf7nnq63hzlpr3peupw9kvje4myms5wfhe", wantErr: true},
+		{spec: "bech32:evmos", address: "cosmos14dvqrf7nnq63hzlpr3peupw9kvje4myms5wfhd", wantErr: true},
+		{spec: "bech32:evmos", address: "Evmos14dvqrf7nnq63hzlpr3peupw9kvje4myms5wfhd", wantErr: true},
+		{spec: "tron", address: "TRbByf9ZSMnAkjF1rjS1u1TgWYZsMnJLiY", want: account},
+		{spec: "tron", address: "T9yD14Nj9j7xAB4dbGeiX9h8unkKHxuWwb", want: common.Address{}},
+		{spec: "tron", address: "41ab5801a7d398351b8be11c439e05c5b3259aec9b", want: account},
+		{spec: "tron", address: "0xab5801a7d398351b8be11c439e05c5b3259aec9b", want: account},
+		{spec: "tron", address: "TRbByf9ZSMnAkjF1rjS1u1TgWYZsMnJLiZ", wantErr: true},
+		{spec: "tron", address: "TRbByf9ZSMnAkjF1rjS1u1TgWYZsMnJLi0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec+" "+tt.address, func(t *testing.T) {
+			format, err := NewAddressFormat(tt.spec)
+			if err != nil {
+				t.Fatalf("NewAddressFormat() error = %v", err)
+			}
+			got, err := format.ParseAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAddress() = %s, want %s", got.Hex(), tt.want.Hex())
+			}
+		})
+	}
+
+	for _, spec := range []string{"", "evm", "EVM"} {
+		if format, err := NewAddressFormat(spec); format != nil || err != nil {
+			t.Errorf("NewAddressFormat(%q) = %v, %v, want the default hex format", spec, format, err)
+		}
+	}
+	for _, spec := range []string{"bech32", "tron:mainnet", "ss58"} {
+		if _, err := NewAddressFormat(spec); err == nil {
+			t.Errorf("NewAddressFormat(%q) accepted an invalid spec", spec)
+		}
+	}
+
+	RegisterAddressFormat("fixed", func(param string) (AddressFormat, error) { return EVMAddressFormat(true), nil })
+	format, err := NewAddressFormat("fixed")
+	if err != nil {
+		t.Fatalf("NewAddressFormat() of a registered format error = %v", err)
+	}
+	if _, err := format.ParseAddress("0xab5801a7d398351b8be11c439e05c5b3259aec9b"); err == nil {
+		t.Error("registered checksummed format accepted a lowercase address")
+	}
+}
@@ -0,0 +1,38 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const disperseABIJSON = `[
+	{"constant":false,"inputs":[{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}],"name":"disperseEther","outputs":[],"payable":true,"type":"function"}
+]`
+
+var disperseABI = mustParseABI(disperseABIJSON)
+
+// DisperseEther funds every recipient with the value at the same index in a single
+// disperseEther call of a Disperse style contract, sending the sum of values along.
+func (b *TxBuild) DisperseEther(ctx context.Context, contract common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error) {
+	if len(recipients) != len(values) {
+		return common.Hash{}, errors.New("recipients and values differ in length")
+	}
+	data, err := disperseABI.Pack("disperseEther", recipients, values)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	total := new(big.Int)
+	for _, value := range values {
+		total.Add(total, value)
+	}
+
+	gasLimit, err := b.estimateGas(ctx, contract, total, data, 0)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return b.sendTx(ctx, contract, total, data, gasLimit)
+}
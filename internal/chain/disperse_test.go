@@ -0,0 +1,62 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestDisperseEther(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	txBuilder := &TxBuild{
+		client:      simClient,
+		signer:      NewKeySigner(privateKey),
+		chainID:     big.NewInt(1337),
+		fromAddress: fromAddress,
+	}
+	bgCtx := context.Background()
+	contract := common.HexToAddress("0xD152f549545093347A162Dce210e7293f1452150")
+	recipients := []common.Address{
+		common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"),
+		common.HexToAddress("0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984"),
+	}
+	values := []*big.Int{big.NewInt(1000), big.NewInt(2000)}
+	txHash, err := txBuilder.DisperseEther(bgCtx, contract, recipients, values)
+	if err != nil {
+		t.Fatalf("could not add tx to pending block: %v", err)
+	}
+	simClient.Commit()
+
+	tx, _, err := simClient.TransactionByHash(bgCtx, txHash)
+	if err != nil {
+		t.Fatalf("could not get sent transaction: %v", err)
+	}
+	if *tx.To() != contract {
+		t.Errorf("transaction sent to %v, want contract %v", tx.To(), contract)
+	}
+	if tx.Value().Cmp(big.NewInt(3000)) != 0 {
+		t.Errorf("transaction value = %v, want the sum 3000", tx.Value())
+	}
+	want, _ := disperseABI.Pack("disperseEther", recipients, values)
+	if !bytes.Equal(tx.Data(), want) {
+		t.Errorf("unexpected calldata %x, want %x", tx.Data(), want)
+	}
+
+	if _, err := txBuilder.DisperseEther(bgCtx, contract, recipients, values[:1]); err == nil {
+		t.Error("expected an error for mismatched recipients and values")
+	}
+}
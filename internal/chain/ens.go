@@ -0,0 +1,94 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const ensABIJSON = `[
+	{"constant":true,"inputs":[{"name":"node","type":"bytes32"}],"name":"resolver","outputs":[{"name":"","type":"address"}],"type":"function"},
+	{"constant":true,"inputs":[{"name":"node","type":"bytes32"}],"name":"addr","outputs":[{"name":"","type":"address"}],"type":"function"}
+]`
+
+var (
+	ensABI = mustParseABI(ensABIJSON)
+
+	ErrENSNameNotFound = errors.New("ens name is not registered")
+)
+
+// IsENSName reports whether the input looks like a dotted ENS name rather than a hex address.
+func IsENSName(name string) bool {
+	if common.IsHexAddress(name) || strings.ContainsAny(name, " /:") {
+		return false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// NameHash implements the EIP-137 namehash algorithm.
+func NameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		labelHash := crypto.Keccak256([]byte(labels[i]))
+		node = crypto.Keccak256Hash(node.Bytes(), labelHash)
+	}
+	return node
+}
+
+func (b *TxBuild) ResolveENSName(ctx context.Context, registry common.Address, name string) (common.Address, error) {
+	node := NameHash(name)
+	resolver, err := b.callAddress(ctx, registry, "resolver", node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, ErrENSNameNotFound
+	}
+
+	address, err := b.callAddress(ctx, resolver, "addr", node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, ErrENSNameNotFound
+	}
+	return address, nil
+}
+
+func (b *TxBuild) callAddress(ctx context.Context, contract common.Address, method string, node common.Hash) (common.Address, error) {
+	data, err := ensABI.Pack(method, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	output, err := b.client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return common.Address{}, wrapError(err)
+	}
+	if len(output) == 0 {
+		return common.Address{}, nil
+	}
+
+	var address common.Address
+	if err := ensABI.UnpackIntoInterface(&address, method, output); err != nil {
+		return common.Address{}, err
+	}
+	return address, nil
+}
@@ -0,0 +1,47 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestNameHash(t *testing.T) {
+	tests := []struct {
+		name string
+		want common.Hash
+	}{
+		{name: "", want: common.Hash{}},
+		{name: "eth", want: common.HexToHash("0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae")},
+		{name: "foo.eth", want: common.HexToHash("0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NameHash(tt.name); got != tt.want {
+				t.Errorf("NameHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsENSName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "simple", input: "alice.eth", want: true},
+		{name: "subdomain", input: "pay.alice.eth", want: true},
+		{name: "hex address", input: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: false},
+		{name: "no tld", input: "alice", want: false},
+		{name: "empty label", input: "alice..eth", want: false},
+		{name: "url", input: "https://alice.eth", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsENSName(tt.input); got != tt.want {
+				t.Errorf("IsENSName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
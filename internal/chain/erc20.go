@@ -0,0 +1,58 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const erc20ABIJSON = `[
+	{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"type":"function"},
+	{"constant":false,"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"type":"function"}
+]`
+
+var erc20ABI = mustParseABI(erc20ABIJSON)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func (b *TxBuild) TransferERC20(ctx context.Context, token common.Address, to common.Address, amount *big.Int) (common.Hash, error) {
+	data, err := erc20ABI.Pack("transfer", to, amount)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	gasLimit, err := b.estimateGas(ctx, token, nil, data, 0)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return b.sendTx(ctx, token, new(big.Int), data, gasLimit)
+}
+
+func (b *TxBuild) TokenDecimals(ctx context.Context, token common.Address) (uint8, error) {
+	data, err := erc20ABI.Pack("decimals")
+	if err != nil {
+		return 0, err
+	}
+
+	output, err := b.client.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	var decimals uint8
+	if err := erc20ABI.UnpackIntoInterface(&decimals, "decimals", output); err != nil {
+		return 0, err
+	}
+	return decimals, nil
+}
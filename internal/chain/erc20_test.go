@@ -0,0 +1,58 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestTransferERC20(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+	var s *backends.SimulatedBackend
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(s), "SuggestGasPrice", func(_ *backends.SimulatedBackend, _ context.Context) (*big.Int, error) {
+		return big.NewInt(875000000), nil
+	})
+	defer patches.Reset()
+
+	txBuilder := &TxBuild{
+		client:      simClient,
+		signer:      NewKeySigner(privateKey),
+		chainID:     big.NewInt(1337),
+		fromAddress: fromAddress,
+	}
+	bgCtx := context.Background()
+	token := common.HexToAddress("0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984")
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	txHash, err := txBuilder.TransferERC20(bgCtx, token, toAddress, big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("could not add tx to pending block: %v", err)
+	}
+	simClient.Commit()
+
+	tx, _, err := simClient.TransactionByHash(bgCtx, txHash)
+	if err != nil {
+		t.Fatalf("could not get sent transaction: %v", err)
+	}
+	if *tx.To() != token {
+		t.Errorf("transaction sent to %v, want token %v", tx.To(), token)
+	}
+	want, _ := erc20ABI.Pack("transfer", toAddress, big.NewInt(1000))
+	if !bytes.Equal(tx.Data(), want) {
+		t.Errorf("unexpected calldata %x, want %x", tx.Data(), want)
+	}
+}
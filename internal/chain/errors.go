@@ -0,0 +1,88 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Errors of the node are wrapped into these, so callers tell failures apart with errors.Is
+// instead of matching the messages of every node implementation.
+var (
+	// ErrInsufficientFunds is returned when the wallet cannot pay the value and gas of a transaction.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrNonceTooLow is returned when the node rejects the nonce of a transaction as used, most
+	// often as another process sent from the wallet. The local nonce is read again before the next send.
+	ErrNonceTooLow = errors.New("nonce too low")
+	// ErrNonceTooHigh is returned when the nonce of a transaction is ahead of the wallet's, such as
+	// after the node dropped an earlier transaction. The local nonce is read again as well.
+	ErrNonceTooHigh = errors.New("nonce too high")
+	// ErrGasTooHigh is returned when a transaction needs more gas than a block of the chain holds.
+	ErrGasTooHigh = errors.New("gas exceeds the block gas limit")
+	// ErrNodeUnavailable is returned when the node could not be reached or failed to answer.
+	ErrNodeUnavailable = errors.New("node unavailable")
+	// ErrTxReverted is returned for transactions mined with a failed status, and those the node
+	// rejects because they revert.
+	ErrTxReverted = errors.New("transaction reverted")
+)
+
+// nodeError is an error of the node marked with the sentinel it is an instance of. It keeps
+// the node's message, and unwraps to both.
+type nodeError struct {
+	kind error
+	err  error
+}
+
+func (e *nodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *nodeError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// wrapError marks err with the sentinel it matches, errors matching none and cancellations of
+// the caller are returned as they are.
+func wrapError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var kind error
+	switch {
+	case IsInsufficientFunds(err):
+		kind = ErrInsufficientFunds
+	case isNonceTooHigh(err):
+		kind = ErrNonceTooHigh
+	case isNonceError(err):
+		kind = ErrNonceTooLow
+	case isGasTooHigh(err):
+		kind = ErrGasTooHigh
+	case isRevertError(err):
+		kind = ErrTxReverted
+	case isTransientError(err):
+		kind = ErrNodeUnavailable
+	default:
+		return err
+	}
+	if errors.Is(err, kind) {
+		return err
+	}
+	return &nodeError{kind: kind, err: err}
+}
+
+// isNonceTooHigh reports whether the node rejected a transaction whose nonce leaves a gap.
+func isNonceTooHigh(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "nonce too high") || strings.Contains(msg, "nonce gap")
+}
+
+// isGasTooHigh reports whether the node rejected a transaction whose gas limit exceeds a block.
+func isGasTooHigh(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "exceeds block gas limit") || strings.Contains(msg, "gas limit reached")
+}
+
+// isRevertError reports whether the node rejected a call or transaction because it reverts.
+func isRevertError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "execution reverted")
+}
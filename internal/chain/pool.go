@@ -0,0 +1,161 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// SignerPool sends the transactions of claims from several wallets in turn. Every wallet keeps
+// its own nonce, so the sends of concurrent claims are broadcast in parallel rather than queueing
+// on the nonce of one key. Reads go to the first wallet, which the pool reports as its sender.
+type SignerPool struct {
+	builders []TxBuilder
+	next     atomic.Uint32
+}
+
+// Wallet is the balance of one wallet of a SignerPool.
+type Wallet struct {
+	Address common.Address
+	Balance *big.Int
+}
+
+// NewSignerPool sends from the wallets of signers through provider, see NewTxBuilder. A single
+// signer is returned as a plain TxBuilder.
+func NewSignerPool(provider string, signers []Signer, chainID *big.Int, opts ...Option) (TxBuilder, error) {
+	builders := make([]TxBuilder, len(signers))
+	for i, signer := range signers {
+		builder, err := NewTxBuilder(provider, signer, chainID, opts...)
+		if err != nil {
+			return nil, err
+		}
+		// Every wallet is checked against the chain of the first one
+		chainID = builder.ChainID()
+		builders[i] = builder
+	}
+	if len(builders) == 1 {
+		return builders[0], nil
+	}
+	return &SignerPool{builders: builders}, nil
+}
+
+func (p *SignerPool) Sender() common.Address {
+	return p.builders[0].Sender()
+}
+
+func (p *SignerPool) ChainID() *big.Int {
+	return p.builders[0].ChainID()
+}
+
+// Balance returns the sum of the balances of all wallets.
+func (p *SignerPool) Balance(ctx context.Context) (*big.Int, error) {
+	total := new(big.Int)
+	for _, builder := range p.builders {
+		balance, err := builder.Balance(ctx)
+		if err != nil {
+			return nil, err
+		}
+		total.Add(total, balance)
+	}
+	return total, nil
+}
+
+// Wallets returns the balance of every wallet, in the order they take turns.
+func (p *SignerPool) Wallets(ctx context.Context) ([]Wallet, error) {
+	wallets := make([]Wallet, len(p.builders))
+	for i, builder := range p.builders {
+		balance, err := builder.Balance(ctx)
+		if err != nil {
+			return nil, err
+		}
+		wallets[i] = Wallet{Address: builder.Sender(), Balance: balance}
+	}
+	return wallets, nil
+}
+
+func (p *SignerPool) BalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	return p.builders[0].BalanceAt(ctx, account)
+}
+
+func (p *SignerPool) NonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return p.builders[0].NonceAt(ctx, account)
+}
+
+func (p *SignerPool) IsContract(ctx context.Context, account common.Address) (bool, error) {
+	return p.builders[0].IsContract(ctx, account)
+}
+
+func (p *SignerPool) TransferFee(ctx context.Context, to common.Address, value *big.Int) (*big.Int, error) {
+	return p.builders[0].TransferFee(ctx, to, value)
+}
+
+func (p *SignerPool) GasPrice(ctx context.Context) (*big.Int, error) {
+	return p.builders[0].GasPrice(ctx)
+}
+
+func (p *SignerPool) TokenDecimals(ctx context.Context, token common.Address) (uint8, error) {
+	return p.builders[0].TokenDecimals(ctx, token)
+}
+
+func (p *SignerPool) ResolveENSName(ctx context.Context, registry common.Address, name string) (common.Address, error) {
+	return p.builders[0].ResolveENSName(ctx, registry, name)
+}
+
+func (p *SignerPool) WaitForReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return p.builders[0].WaitForReceipt(ctx, txHash)
+}
+
+func (p *SignerPool) WaitForConfirmations(ctx context.Context, txHash common.Hash, confirmations uint64) (*types.Receipt, error) {
+	return p.builders[0].WaitForConfirmations(ctx, txHash, confirmations)
+}
+
+func (p *SignerPool) Transfer(ctx context.Context, to string, value *big.Int) (txHash common.Hash, err error) {
+	err = p.send(ctx, func(b TxBuilder) error {
+		txHash, err = b.Transfer(ctx, to, value)
+		return err
+	})
+	return txHash, err
+}
+
+func (p *SignerPool) TransferERC20(ctx context.Context, token common.Address, to common.Address, amount *big.Int) (txHash common.Hash, err error) {
+	err = p.send(ctx, func(b TxBuilder) error {
+		txHash, err = b.TransferERC20(ctx, token, to, amount)
+		return err
+	})
+	return txHash, err
+}
+
+func (p *SignerPool) DisperseEther(ctx context.Context, contract common.Address, recipients []common.Address, values []*big.Int) (txHash common.Hash, err error) {
+	err = p.send(ctx, func(b TxBuilder) error {
+		txHash, err = b.DisperseEther(ctx, contract, recipients, values)
+		return err
+	})
+	return txHash, err
+}
+
+func (p *SignerPool) WrapAndTransfer(ctx context.Context, weth common.Address, to common.Address, amount *big.Int) (txHashes []common.Hash, err error) {
+	err = p.send(ctx, func(b TxBuilder) error {
+		txHashes, err = b.WrapAndTransfer(ctx, weth, to, amount)
+		return err
+	})
+	return txHashes, err
+}
+
+// send runs tx on the wallet whose turn it is. A wallet that cannot cover the transaction passes
+// it on to the next one, so the pool only runs dry once every wallet has.
+func (p *SignerPool) send(ctx context.Context, tx func(TxBuilder) error) error {
+	first := int(p.next.Add(1)-1) % len(p.builders)
+	var err error
+	for i := range p.builders {
+		builder := p.builders[(first+i)%len(p.builders)]
+		if err = tx(builder); !IsInsufficientFunds(err) {
+			return err
+		}
+		log.WithContext(ctx).WithField("address", builder.Sender().Hex()).Warn("Pool wallet cannot cover the transaction, trying the next one")
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// brokeBackend rejects sends as a node does from an empty wallet, which the simulated backend panics on.
+type brokeBackend struct {
+	*backends.SimulatedBackend
+}
+
+func (b brokeBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return core.ErrInsufficientFunds
+}
+
+func TestSignerPool(t *testing.T) {
+	var signers []Signer
+	alloc := core.GenesisAlloc{}
+	for i, balance := range []int64{10000000000000000, 20000000000000000, 0} {
+		key, _ := crypto.GenerateKey()
+		signers = append(signers, NewKeySigner(key))
+		if balance > 0 {
+			alloc[signers[i].Address()] = core.GenesisAccount{Balance: big.NewInt(balance)}
+		}
+	}
+	simClient := backends.NewSimulatedBackend(alloc, 10000000)
+	defer simClient.Close()
+
+	pool := &SignerPool{}
+	for i, signer := range signers {
+		var client backend = simClient
+		if i == 2 {
+			client = brokeBackend{simClient}
+		}
+		pool.builders = append(pool.builders, &TxBuild{
+			client:      client,
+			signer:      signer,
+			chainID:     big.NewInt(1337),
+			fromAddress: signer.Address(),
+		})
+	}
+	ctx := context.Background()
+
+	balance, err := pool.Balance(ctx)
+	if err != nil || balance.Cmp(big.NewInt(30000000000000000)) != 0 {
+		t.Errorf("Balance() = %v, %v, want the sum of all wallets", balance, err)
+	}
+
+	// The third wallet is empty, its turn passes on to the first one
+	want := []common.Address{signers[0].Address(), signers[1].Address(), signers[0].Address(), signers[0].Address()}
+	for i, sender := range want {
+		txHash, err := pool.Transfer(ctx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+		if err != nil {
+			t.Fatalf("transfer %d error = %v", i, err)
+		}
+		tx, _, err := simClient.TransactionByHash(ctx, txHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, _ := types.Sender(types.NewLondonSigner(big.NewInt(1337)), tx)
+		if from != sender {
+			t.Errorf("transfer %d sent from %s, want %s", i, from.Hex(), sender.Hex())
+		}
+	}
+	simClient.Commit()
+
+	wallets, err := pool.Wallets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wallets) != 3 || wallets[2].Address != signers[2].Address() || wallets[2].Balance.Sign() != 0 {
+		t.Errorf("Wallets() = %v, want every wallet with its balance", wallets)
+	}
+	if pool.Sender() != signers[0].Address() {
+		t.Errorf("Sender() = %s, want the first wallet", pool.Sender().Hex())
+	}
+}
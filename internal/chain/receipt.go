@@ -0,0 +1,162 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+var receiptPollInterval = time.Second
+
+// WaitForReceipt looks the receipt up until the transaction is mined or ctx is done, on every
+// new head when the provider pushes them, see blockWaiter. A mined transaction with a failed
+// status is reported as ErrTxReverted.
+func (b *TxBuild) WaitForReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	blocks := b.newBlockWaiter(ctx)
+	defer blocks.stop()
+
+	for {
+		receipt, err := b.client.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				return receipt, ErrTxReverted
+			}
+			return receipt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, wrapError(err)
+		}
+
+		if err := blocks.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WaitForConfirmations waits until the transaction is mined and confirmations blocks were built
+// on top of it, or ctx is done. A transaction a reorg dropped from the chain is broadcast again
+// and waited for in its new block.
+func (b *TxBuild) WaitForConfirmations(ctx context.Context, txHash common.Hash, confirmations uint64) (*types.Receipt, error) {
+	receipt, err := b.WaitForReceipt(ctx, txHash)
+	if err != nil || confirmations == 0 {
+		return receipt, err
+	}
+	// The node drops the transaction from its pool once mined, keep it to resend after a reorg
+	tx, _, err := b.client.TransactionByHash(ctx, txHash)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	blocks := b.newBlockWaiter(ctx)
+	defer blocks.stop()
+
+	for {
+		receipt, err := b.client.TransactionReceipt(ctx, txHash)
+		switch {
+		case err == nil:
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				return receipt, ErrTxReverted
+			}
+			head, err := b.client.HeaderByNumber(ctx, nil)
+			if err != nil {
+				return nil, wrapError(err)
+			}
+			if head.Number.Uint64() >= receipt.BlockNumber.Uint64()+confirmations {
+				return receipt, nil
+			}
+		case errors.Is(err, ethereum.NotFound):
+			if err := b.rebroadcast(ctx, tx); err != nil {
+				return nil, wrapError(err)
+			}
+		default:
+			return nil, wrapError(err)
+		}
+
+		if err := blocks.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rebroadcast sends a transaction dropped by a reorg again, unless the node still holds it.
+func (b *TxBuild) rebroadcast(ctx context.Context, tx *types.Transaction) error {
+	_, _, err := b.client.TransactionByHash(ctx, tx.Hash())
+	if err == nil || !errors.Is(err, ethereum.NotFound) {
+		return err
+	}
+	log.WithContext(ctx).WithField("txHash", tx.Hash().String()).Warn("Transaction dropped by a reorg, resending it")
+	if err := b.client.SendTransaction(ctx, tx); err != nil && !isKnownTxError(err) {
+		return err
+	}
+	return nil
+}
+
+type headSubscriber interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+}
+
+// blockWaiter paces receipt lookups. Providers dialed over a WebSocket push new heads, so the
+// receipt is looked up once per block as soon as it arrives. Others are polled every
+// receiptPollInterval, as are WebSocket providers whose subscription failed.
+type blockWaiter struct {
+	heads  chan *types.Header
+	sub    ethereum.Subscription
+	ticker *time.Ticker
+}
+
+func (b *TxBuild) newBlockWaiter(ctx context.Context) *blockWaiter {
+	w := &blockWaiter{}
+	if subscriber, ok := b.client.(headSubscriber); ok && b.subscribeHeads {
+		w.heads = make(chan *types.Header, 1)
+		sub, err := subscriber.SubscribeNewHead(ctx, w.heads)
+		if err == nil {
+			w.sub = sub
+			return w
+		}
+		log.WithContext(ctx).WithError(err).Warn("Failed to subscribe to new heads, polling for receipts")
+	}
+	w.ticker = time.NewTicker(receiptPollInterval)
+	return w
+}
+
+// wait returns once the next lookup is due, or with the error of ctx.
+func (w *blockWaiter) wait(ctx context.Context) error {
+	var ticks <-chan time.Time
+	if w.ticker != nil {
+		ticks = w.ticker.C
+	}
+	var subErr <-chan error
+	if w.sub != nil {
+		subErr = w.sub.Err()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ticks:
+	case <-w.heads:
+		// Heads that queued up while looking up need no lookup of their own
+		for len(w.heads) > 0 {
+			<-w.heads
+		}
+	case err := <-subErr:
+		log.WithContext(ctx).WithError(err).Warn("New heads subscription failed, polling for receipts")
+		w.sub.Unsubscribe()
+		w.sub = nil
+		w.ticker = time.NewTicker(receiptPollInterval)
+	}
+	return nil
+}
+
+func (w *blockWaiter) stop() {
+	if w.sub != nil {
+		w.sub.Unsubscribe()
+	}
+	if w.ticker != nil {
+		w.ticker.Stop()
+	}
+}
@@ -0,0 +1,175 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestWaitForReceipt(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	txBuilder := &TxBuild{
+		client:      simClient,
+		signer:      NewKeySigner(privateKey),
+		chainID:     big.NewInt(1337),
+		fromAddress: fromAddress,
+	}
+	bgCtx := context.Background()
+	txHash, err := txBuilder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("could not send tx: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(bgCtx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := txBuilder.WaitForReceipt(ctx, txHash); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded for pending tx, got %v", err)
+	}
+
+	simClient.Commit()
+	receipt, err := txBuilder.WaitForReceipt(bgCtx, txHash)
+	if err != nil {
+		t.Fatalf("could not get receipt: %v", err)
+	}
+	if receipt.TxHash != txHash {
+		t.Errorf("receipt for %v, want %v", receipt.TxHash, txHash)
+	}
+
+	if _, err := txBuilder.WaitForReceipt(ctx, common.Hash{}); err == nil {
+		t.Error("expected error for unknown tx")
+	}
+}
+
+// reorgBackend runs a step of the test on every receipt lookup.
+type reorgBackend struct {
+	*backends.SimulatedBackend
+	lookups int
+	step    func(lookup int)
+}
+
+func (b *reorgBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	b.lookups++
+	b.step(b.lookups)
+	return b.SimulatedBackend.TransactionReceipt(ctx, txHash)
+}
+
+func TestWaitForConfirmations(t *testing.T) {
+	defer func(interval time.Duration) { receiptPollInterval = interval }(receiptPollInterval)
+	receiptPollInterval = time.Millisecond
+
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	bgCtx := context.Background()
+	genesis, _ := simClient.HeaderByNumber(bgCtx, big.NewInt(0))
+	client := &reorgBackend{SimulatedBackend: simClient}
+	txBuilder := &TxBuild{
+		client:      client,
+		signer:      NewKeySigner(privateKey),
+		chainID:     big.NewInt(1337),
+		fromAddress: fromAddress,
+	}
+	txHash, err := txBuilder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("could not send tx: %v", err)
+	}
+	simClient.Commit()
+
+	// The block of the tx is replaced by a longer chain without it on the third lookup, and
+	// a block is mined on each one after that
+	client.step = func(lookup int) {
+		switch {
+		case lookup == 3:
+			if err := simClient.Fork(bgCtx, genesis.Hash()); err != nil {
+				t.Fatalf("could not fork: %v", err)
+			}
+			simClient.Commit()
+			simClient.Commit()
+		case lookup > 3:
+			simClient.Commit()
+		}
+	}
+	ctx, cancel := context.WithTimeout(bgCtx, 5*time.Second)
+	defer cancel()
+	receipt, err := txBuilder.WaitForConfirmations(ctx, txHash, 2)
+	if err != nil {
+		t.Fatalf("WaitForConfirmations() error = %v", err)
+	}
+	if receipt.BlockNumber.Uint64() != 3 {
+		t.Errorf("receipt in block %s, want the tx resent into block 3", receipt.BlockNumber)
+	}
+	head, _ := simClient.HeaderByNumber(bgCtx, nil)
+	if head.Number.Uint64() < 5 {
+		t.Errorf("returned at block %s, want 2 blocks on top of the tx", head.Number)
+	}
+}
+
+func TestWaitForReceiptNewHeads(t *testing.T) {
+	// Lookups only run on new heads, a poll would not come before the test times out
+	defer func(interval time.Duration) { receiptPollInterval = interval }(receiptPollInterval)
+	receiptPollInterval = time.Hour
+
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	txBuilder := &TxBuild{
+		client:         simClient,
+		signer:         NewKeySigner(privateKey),
+		chainID:        big.NewInt(1337),
+		fromAddress:    fromAddress,
+		subscribeHeads: true,
+	}
+	bgCtx := context.Background()
+	txHash, err := txBuilder.Transfer(bgCtx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("could not send tx: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		simClient.Commit()
+	}()
+	ctx, cancel := context.WithTimeout(bgCtx, 5*time.Second)
+	defer cancel()
+	receipt, err := txBuilder.WaitForReceipt(ctx, txHash)
+	if err != nil {
+		t.Fatalf("WaitForReceipt() error = %v", err)
+	}
+	if receipt.TxHash != txHash {
+		t.Errorf("receipt for %v, want %v", receipt.TxHash, txHash)
+	}
+
+	for provider, want := range map[string]bool{"wss://rpc.example": true, "WS://localhost:8546": true, "https://rpc.example": false, "/tmp/geth.ipc": false} {
+		if got := isWebSocketURL(provider); got != want {
+			t.Errorf("isWebSocketURL(%q) = %v, want %v", provider, got, want)
+		}
+	}
+}
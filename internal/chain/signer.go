@@ -0,0 +1,76 @@
+package chain
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer signs the transactions of the faucet wallet. The key may be held by the process,
+// or by a remote signer the faucet never sees the key of.
+type Signer interface {
+	Address() common.Address
+	SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+type keySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+// NewKeySigner signs with a private key in memory, as read from a hex key or keystore file.
+func NewKeySigner(key *ecdsa.PrivateKey) Signer {
+	return &keySigner{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+func (s *keySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *keySigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.NewLondonSigner(chainID), s.key)
+}
+
+type externalSigner struct {
+	signer  *external.ExternalSigner
+	account accounts.Account
+}
+
+// NewExternalSigner signs through a clef compatible signer at endpoint, such as clef itself or
+// a signing service implementing account_signTransaction. The wallet is the given address, or
+// the first account the signer lists when empty.
+func NewExternalSigner(endpoint, address string) (Signer, error) {
+	signer, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	listed := signer.Accounts()
+	if address == "" {
+		if len(listed) == 0 {
+			return nil, fmt.Errorf("external signer %s lists no accounts", endpoint)
+		}
+		return &externalSigner{signer: signer, account: listed[0]}, nil
+	}
+	if !IsValidAddress(address, false) {
+		return nil, fmt.Errorf("invalid signer address %s", address)
+	}
+	account := accounts.Account{Address: common.HexToAddress(address)}
+	if !signer.Contains(account) {
+		return nil, fmt.Errorf("external signer %s does not hold %s", endpoint, account.Address.Hex())
+	}
+	return &externalSigner{signer: signer, account: account}, nil
+}
+
+func (s *externalSigner) Address() common.Address {
+	return s.account.Address
+}
+
+func (s *externalSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return s.signer.SignTx(s.account, tx, chainID)
+}
@@ -0,0 +1,81 @@
+package chain
+
+import (
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// fakeClef answers the account_ API of clef, signing with a key the faucet never sees.
+type fakeClef struct {
+	signer Signer
+}
+
+type signTxResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+func (c *fakeClef) Version() string {
+	return "6.1.0"
+}
+
+func (c *fakeClef) List() []common.Address {
+	return []common.Address{c.signer.Address()}
+}
+
+func (c *fakeClef) SignTransaction(args apitypes.SendTxArgs, methodSelector *string) (*signTxResult, error) {
+	tx, err := c.signer.SignTx(args.ToTransaction(), (*big.Int)(args.ChainID))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := tx.MarshalBinary()
+	return &signTxResult{Raw: raw, Tx: tx}, err
+}
+
+func TestSigners(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	keySigner := NewKeySigner(privateKey)
+
+	srv := rpc.NewServer()
+	defer srv.Stop()
+	if err := srv.RegisterName("account", &fakeClef{signer: keySigner}); err != nil {
+		t.Fatal(err)
+	}
+	clef := httptest.NewServer(srv)
+	defer clef.Close()
+
+	remote, err := NewExternalSigner(clef.URL, "")
+	if err != nil {
+		t.Fatalf("NewExternalSigner() error = %v", err)
+	}
+	if _, err := NewExternalSigner(clef.URL, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"); err == nil {
+		t.Error("NewExternalSigner() accepted an address the signer does not hold")
+	}
+
+	to := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	chainID := big.NewInt(1337)
+	for name, signer := range map[string]Signer{"key": keySigner, "external": remote} {
+		t.Run(name, func(t *testing.T) {
+			if signer.Address() != crypto.PubkeyToAddress(privateKey.PublicKey) {
+				t.Errorf("Address() = %s, want the key's address", signer.Address().Hex())
+			}
+			tx := types.NewTx(&types.DynamicFeeTx{Nonce: 1, To: &to, Value: big.NewInt(1000), Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)})
+			signed, err := signer.SignTx(tx, chainID)
+			if err != nil {
+				t.Fatalf("SignTx() error = %v", err)
+			}
+			sender, err := types.Sender(types.NewLondonSigner(chainID), signed)
+			if err != nil || sender != signer.Address() {
+				t.Errorf("sender = %s, %v, want %s", sender.Hex(), err, signer.Address().Hex())
+			}
+		})
+	}
+}
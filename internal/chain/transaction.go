@@ -2,100 +2,573 @@ package chain
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
 	"math/big"
+	"net"
+	"net/http"
 	"strings"
-	"sync/atomic"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	log "github.com/sirupsen/logrus"
 )
 
 type TxBuilder interface {
 	Sender() common.Address
+	ChainID() *big.Int
+	Balance(ctx context.Context) (*big.Int, error)
+	BalanceAt(ctx context.Context, account common.Address) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address) (uint64, error)
+	IsContract(ctx context.Context, account common.Address) (bool, error)
 	Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error)
+	TransferFee(ctx context.Context, to common.Address, value *big.Int) (*big.Int, error)
+	GasPrice(ctx context.Context) (*big.Int, error)
+	TransferERC20(ctx context.Context, token common.Address, to common.Address, amount *big.Int) (common.Hash, error)
+	DisperseEther(ctx context.Context, contract common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error)
+	WrapAndTransfer(ctx context.Context, weth common.Address, to common.Address, amount *big.Int) ([]common.Hash, error)
+	TokenDecimals(ctx context.Context, token common.Address) (uint8, error)
+	ResolveENSName(ctx context.Context, registry common.Address, name string) (common.Address, error)
+	WaitForReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	WaitForConfirmations(ctx context.Context, txHash common.Hash, confirmations uint64) (*types.Receipt, error)
+}
+
+const defaultFeeMultiplier = 2
+
+// transferGas is the gas of a native transfer to an account without code, it is the gas limit
+// of native transfers whose estimation fails unless a fallback is configured.
+const transferGas = 21000
+
+// ErrGasLimitExceeded is returned for transactions estimated to use more than the configured maximum gas.
+var ErrGasLimitExceeded = errors.New("estimated gas exceeds the maximum")
+
+// ErrSendThrottled is returned for transactions that would wait too long for their turn to be
+// broadcast, see WithSendInterval.
+var ErrSendThrottled = errors.New("sending too fast, no broadcast slot within the maximum wait")
+
+// ErrChainIDMismatch is returned when the provider serves another chain than the configured one.
+var ErrChainIDMismatch = errors.New("chain ID mismatch")
+
+type backend interface {
+	bind.ContractBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error)
 }
 
 type TxBuild struct {
-	client      bind.ContractTransactor
-	privateKey  *ecdsa.PrivateKey
-	signer      types.Signer
-	fromAddress common.Address
-	nonce       uint64
+	client        backend
+	signer        Signer
+	chainID       *big.Int
+	fromAddress   common.Address
+	nonceMu       sync.Mutex
+	nonce         uint64
+	feeMultiplier float64
+	sendRetries   int
+	sendBackoff   time.Duration
+	dryRun        bool
+	gasMultiplier float64
+	gasFallback   uint64
+	maxGas        uint64
+
+	// throttleMu guards nextSend, the earliest time the next transaction may be broadcast
+	throttleMu   sync.Mutex
+	nextSend     time.Time
+	sendInterval time.Duration
+	sendMaxWait  time.Duration
+
+	// subscribeHeads is set for WebSocket providers, which push the new heads receipts are waited on
+	subscribeHeads bool
 }
 
-func NewTxBuilder(provider string, privateKey *ecdsa.PrivateKey, chainID *big.Int) (TxBuilder, error) {
-	client, err := ethclient.Dial(provider)
+type Option func(*TxBuild)
+
+// WithFeeMultiplier sets how many times the latest base fee an EIP-1559 transaction is willing to pay.
+func WithFeeMultiplier(multiplier float64) Option {
+	return func(b *TxBuild) {
+		b.feeMultiplier = multiplier
+	}
+}
+
+// WithSendRetries resends a transaction up to retries times when the node fails transiently,
+// waiting backoff before the first retry and doubling it for each one after.
+func WithSendRetries(retries int, backoff time.Duration) Option {
+	return func(b *TxBuild) {
+		b.sendRetries = retries
+		b.sendBackoff = backoff
+	}
+}
+
+// WithGasEstimation buffers gas estimates by multiplier, uses fallback as the gas limit when
+// estimation fails and rejects transactions estimated above maxGas, so recipients with expensive
+// receive hooks cannot drain the wallet. Zero values keep the estimate, fail without fallback
+// and leave the gas uncapped.
+func WithGasEstimation(multiplier float64, fallback, maxGas uint64) Option {
+	return func(b *TxBuild) {
+		b.gasMultiplier = multiplier
+		b.gasFallback = fallback
+		b.maxGas = maxGas
+	}
+}
+
+// WithSendInterval broadcasts the transactions of the wallet at least interval apart, for chains
+// whose mempool drops transactions of an account sent faster. A transaction waits at most maxWait
+// for its turn, or else fails with ErrSendThrottled.
+func WithSendInterval(interval, maxWait time.Duration) Option {
+	return func(b *TxBuild) {
+		b.sendInterval = interval
+		b.sendMaxWait = maxWait
+	}
+}
+
+// WithDryRun signs and validates transactions without broadcasting them, their hashes are
+// returned as if they were sent. No nonce is consumed, so dry runs never reach the chain.
+func WithDryRun() Option {
+	return func(b *TxBuild) {
+		b.dryRun = true
+	}
+}
+
+// NewTxBuilder sends the transactions of signer's wallet through provider, an http(s) or ws(s)
+// RPC URL. Receipts are polled over HTTP and waited on new heads over a WebSocket. The chain ID is
+// read from the node, and must equal chainID unless it is nil, so a wrong provider cannot
+// sign transactions for another chain.
+func NewTxBuilder(provider string, signer Signer, chainID *big.Int, opts ...Option) (TxBuilder, error) {
+	rpcClient, err := rpc.Dial(provider)
 	if err != nil {
 		return nil, err
 	}
+	client := ethclient.NewClient(rpcClient)
 
-	if chainID == nil {
-		chainID, err = client.ChainID(context.Background())
-		if err != nil {
-			return nil, err
-		}
+	ctx := context.Background()
+	nodeChainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the chain ID: %w", err)
+	}
+	if chainID != nil && chainID.Cmp(nodeChainID) != 0 {
+		return nil, fmt.Errorf("%w: the node is on chain %s, expected chain %s", ErrChainIDMismatch, nodeChainID, chainID)
+	}
+	chainID = nodeChainID
+
+	// Not every provider answers web3_clientVersion, it is only logged
+	clientVersion := "unknown"
+	var version string
+	if err := rpcClient.CallContext(ctx, &version, "web3_clientVersion"); err == nil && version != "" {
+		clientVersion = version
 	}
+	log.WithFields(log.Fields{
+		"chainID":       chainID.String(),
+		"clientVersion": clientVersion,
+		"address":       signer.Address().Hex(),
+	}).Info("Connected to chain")
 
 	txBuilder := &TxBuild{
-		client:      client,
-		privateKey:  privateKey,
-		signer:      types.NewEIP155Signer(chainID),
-		fromAddress: crypto.PubkeyToAddress(privateKey.PublicKey),
+		client:         client,
+		signer:         signer,
+		chainID:        chainID,
+		fromAddress:    signer.Address(),
+		subscribeHeads: isWebSocketURL(provider),
+	}
+	for _, opt := range opts {
+		opt(txBuilder)
 	}
-	txBuilder.refreshNonce(context.Background())
+	txBuilder.refreshNonce(ctx)
 
 	return txBuilder, nil
 }
 
+func isWebSocketURL(provider string) bool {
+	provider = strings.ToLower(provider)
+	return strings.HasPrefix(provider, "ws://") || strings.HasPrefix(provider, "wss://")
+}
+
 func (b *TxBuild) Sender() common.Address {
 	return b.fromAddress
 }
 
+func (b *TxBuild) ChainID() *big.Int {
+	return b.chainID
+}
+
+func (b *TxBuild) Balance(ctx context.Context) (*big.Int, error) {
+	return b.BalanceAt(ctx, b.Sender())
+}
+
+// BalanceAt returns the latest balance of any account in wei.
+func (b *TxBuild) BalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	balance, err := b.client.BalanceAt(ctx, account, nil)
+	return balance, wrapError(err)
+}
+
+// NonceAt returns the number of transactions the account sent in the latest block.
+func (b *TxBuild) NonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	nonce, err := b.client.NonceAt(ctx, account, nil)
+	return nonce, wrapError(err)
+}
+
+// IsContract reports whether the account has code deployed, such as a contract or smart contract wallet.
+func (b *TxBuild) IsContract(ctx context.Context, account common.Address) (bool, error) {
+	code, err := b.client.CodeAt(ctx, account, nil)
+	if err != nil {
+		return false, wrapError(err)
+	}
+	return len(code) > 0, nil
+}
+
+// Transfer sends value to the account, estimating the gas so smart contract wallets with a
+// receive hook are funded too.
 func (b *TxBuild) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
-	gasLimit := uint64(21000)
-	gasPrice, err := b.client.SuggestGasPrice(ctx)
+	recipient := common.HexToAddress(to)
+	gasLimit, err := b.estimateGas(ctx, recipient, value, nil, transferGas)
 	if err != nil {
 		return common.Hash{}, err
 	}
+	return b.sendTx(ctx, recipient, value, nil, gasLimit)
+}
 
-	toAddress := common.HexToAddress(to)
-	unsignedTx := types.NewTx(&types.LegacyTx{
-		Nonce:    b.getAndIncrementNonce(),
-		To:       &toAddress,
-		Value:    value,
-		Gas:      gasLimit,
-		GasPrice: gasPrice,
+// estimateGas returns the node's gas estimate times the gas multiplier, at most the maximum gas.
+// When estimation fails the configured fallback is used, or else the given one, and the error
+// is returned when both are zero.
+func (b *TxBuild) estimateGas(ctx context.Context, to common.Address, value *big.Int, data []byte, fallback uint64) (uint64, error) {
+	gas, err := b.client.EstimateGas(ctx, ethereum.CallMsg{
+		From:  b.fromAddress,
+		To:    &to,
+		Value: value,
+		Data:  data,
 	})
+	if err != nil {
+		if b.gasFallback > 0 {
+			fallback = b.gasFallback
+		}
+		if fallback == 0 {
+			return 0, wrapError(err)
+		}
+		if b.maxGas > 0 && fallback > b.maxGas {
+			fallback = b.maxGas
+		}
+		log.WithContext(ctx).WithError(err).WithField("gasLimit", fallback).Warn("Gas estimation failed, using the fallback gas limit")
+		return fallback, nil
+	}
+	if b.maxGas > 0 && gas > b.maxGas {
+		return 0, fmt.Errorf("%w: %d > %d", ErrGasLimitExceeded, gas, b.maxGas)
+	}
+	if b.gasMultiplier > 1 {
+		gas = uint64(float64(gas) * b.gasMultiplier)
+	}
+	if b.maxGas > 0 && gas > b.maxGas {
+		gas = b.maxGas
+	}
+	return gas, nil
+}
 
-	signedTx, err := types.SignTx(unsignedTx, b.signer, b.privateKey)
+// TransferFee returns the most a Transfer of value to the account may pay for gas at the current
+// prices, its gas limit estimated and capped like the transfer's.
+func (b *TxBuild) TransferFee(ctx context.Context, to common.Address, value *big.Int) (*big.Int, error) {
+	gasLimit, err := b.estimateGas(ctx, to, value, nil, transferGas)
 	if err != nil {
-		return common.Hash{}, err
+		return nil, err
+	}
+	gasPrice, err := b.GasPrice(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return gasPrice.Mul(gasPrice, new(big.Int).SetUint64(gasLimit)), nil
+}
+
+// GasPrice returns the max fee per gas the next transaction would bid, or its gas price on legacy chains.
+func (b *TxBuild) GasPrice(ctx context.Context) (*big.Int, error) {
+	txData, err := b.buildTxData(ctx, 0, common.Address{}, nil, nil, transferGas)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return types.NewTx(txData).GasFeeCap(), nil
+}
 
-	if err = b.client.SendTransaction(ctx, signedTx); err != nil {
-		log.Error("failed to send tx", "tx hash", signedTx.Hash().String(), "err", err)
-		if strings.Contains(err.Error(), "nonce") {
-			b.refreshNonce(context.Background())
+// sendTx holds the nonce lock from building the transaction until the node accepts it,
+// so the local nonce only advances for broadcast transactions and never leaves a gap.
+func (b *TxBuild) sendTx(ctx context.Context, to common.Address, value *big.Int, data []byte, gasLimit uint64) (common.Hash, error) {
+	if !b.dryRun {
+		if err := b.throttle(ctx); err != nil {
+			return common.Hash{}, err
 		}
+	}
+	b.nonceMu.Lock()
+	defer b.nonceMu.Unlock()
+
+	txData, err := b.buildTxData(ctx, b.nonce, to, value, data, gasLimit)
+	if err != nil {
+		return common.Hash{}, wrapError(err)
+	}
+	unsignedTx := types.NewTx(txData)
+
+	signedTx, err := b.signer.SignTx(unsignedTx, b.chainID)
+	if err != nil {
 		return common.Hash{}, err
 	}
 
+	if b.dryRun {
+		if err := b.simulate(ctx, signedTx); err != nil {
+			return common.Hash{}, wrapError(err)
+		}
+		log.WithContext(ctx).WithFields(log.Fields{
+			"txHash": signedTx.Hash().String(),
+			"to":     to.String(),
+			"value":  value.String(),
+		}).Info("Dry run, transaction not broadcast")
+		return signedTx.Hash(), nil
+	}
+
+	err = b.broadcast(ctx, signedTx)
+	for bumps := 0; IsReplacementUnderpriced(err) && bumps < maxFeeBumps; bumps++ {
+		// A transaction of ours from a send that failed on the way back holds the nonce,
+		// replace it with this one rather than failing until it is mined
+		log.WithContext(ctx).WithField("txHash", signedTx.Hash().String()).Warn("Nonce taken by a pending tx, bumping the fee to replace it")
+		if signedTx, err = b.signer.SignTx(types.NewTx(bumpFee(signedTx)), b.chainID); err != nil {
+			return common.Hash{}, err
+		}
+		err = b.broadcast(ctx, signedTx)
+	}
+	if err != nil {
+		log.WithContext(ctx).WithFields(log.Fields{
+			"txHash": signedTx.Hash().String(),
+			"nonce":  b.nonce,
+		}).WithError(err).Error("Failed to send tx")
+		if isNonceError(err) {
+			b.refreshNonce(ctx)
+		}
+		return common.Hash{}, wrapError(err)
+	}
+	b.nonce++
+
 	return signedTx.Hash(), nil
 }
 
-func (b *TxBuild) getAndIncrementNonce() uint64 {
-	return atomic.AddUint64(&b.nonce, 1) - 1
+// throttle takes the next broadcast slot of the wallet and waits for it, see WithSendInterval.
+// Slots are handed out in order, so the wait of a send counts those queued ahead of it.
+func (b *TxBuild) throttle(ctx context.Context) error {
+	if b.sendInterval <= 0 {
+		return nil
+	}
+	b.throttleMu.Lock()
+	now := time.Now()
+	slot := b.nextSend
+	if slot.Before(now) {
+		slot = now
+	}
+	wait := slot.Sub(now)
+	if wait > b.sendMaxWait {
+		b.throttleMu.Unlock()
+		return ErrSendThrottled
+	}
+	b.nextSend = slot.Add(b.sendInterval)
+	b.throttleMu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// simulate estimates the gas of a dry run transaction, failing where the node would reject it.
+// The value is left out when the wallet cannot cover it, so dry runs also work with an unfunded key.
+func (b *TxBuild) simulate(ctx context.Context, tx *types.Transaction) error {
+	msg := ethereum.CallMsg{
+		From: b.fromAddress,
+		To:   tx.To(),
+		Data: tx.Data(),
+	}
+	balance, err := b.Balance(ctx)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(tx.Value()) >= 0 {
+		msg.Value = tx.Value()
+	}
+	_, err = b.client.EstimateGas(ctx, msg)
+	return err
+}
+
+// broadcast sends the signed transaction, retrying transient failures. Resending is safe since
+// the transaction and its hash stay the same, a node that already received it answers "already
+// known", which means it is in the mempool and counts as sent.
+func (b *TxBuild) broadcast(ctx context.Context, tx *types.Transaction) error {
+	backoff := b.sendBackoff
+	for attempt := 0; ; attempt++ {
+		err := b.client.SendTransaction(ctx, tx)
+		if err == nil || isKnownTxError(err) {
+			return nil
+		}
+		if attempt >= b.sendRetries || !isTransientError(err) {
+			return err
+		}
+
+		log.WithContext(ctx).WithField("txHash", tx.Hash().String()).WithError(err).Warn("Retrying tx send")
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// isTransientError reports whether a send failed on the way to the node, rather than being rejected by it.
+func isTransientError(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "connection reset") ||
+		strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "bad gateway") ||
+		strings.Contains(msg, "service unavailable") ||
+		strings.Contains(msg, "gateway timeout")
+}
+
+// isKnownTxError reports whether the node already holds the transaction, from an attempt that failed on the way back.
+func isKnownTxError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+// IsReplacementUnderpriced reports whether another transaction of the wallet holds the nonce in
+// the mempool and bids too little more to replace it.
+func IsReplacementUnderpriced(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "replacement transaction underpriced")
+}
+
+// maxFeeBumps bounds how often a transaction is resent with higher fees to replace a pending one.
+const maxFeeBumps = 3
+
+// bumpFee returns tx bidding 12.5% and a wei more, clearing the 10% nodes require of a replacement.
+func bumpFee(tx *types.Transaction) types.TxData {
+	bump := func(fee *big.Int) *big.Int {
+		return new(big.Int).Add(fee, new(big.Int).Add(new(big.Int).Rsh(fee, 3), big.NewInt(1)))
+	}
+	if tx.Type() == types.LegacyTxType {
+		return &types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Gas:      tx.Gas(),
+			GasPrice: bump(tx.GasPrice()),
+			Data:     tx.Data(),
+		}
+	}
+	return &types.DynamicFeeTx{
+		ChainID:   tx.ChainId(),
+		Nonce:     tx.Nonce(),
+		To:        tx.To(),
+		Value:     tx.Value(),
+		Gas:       tx.Gas(),
+		GasTipCap: bump(tx.GasTipCap()),
+		GasFeeCap: bump(tx.GasFeeCap()),
+		Data:      tx.Data(),
+	}
+}
+
+// IsInsufficientFunds reports whether the node rejected a transaction because the
+// wallet cannot pay its value and gas, as in "insufficient funds for gas * price + value".
+func IsInsufficientFunds(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrInsufficientFunds) || errors.Is(err, core.ErrInsufficientFunds) || errors.Is(err, core.ErrInsufficientFundsForTransfer) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "insufficient funds") || strings.Contains(msg, "insufficient balance")
+}
+
+// isNonceError reports whether the node rejected a transaction because the local nonce drifted.
+func isNonceError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "nonce too low") ||
+		strings.Contains(msg, "nonce too high") ||
+		strings.Contains(msg, "invalid nonce") ||
+		strings.Contains(msg, "invalid transaction nonce") ||
+		strings.Contains(msg, "nonce gap")
+}
+
+// buildTxData returns a dynamic fee transaction when the latest block carries a base fee,
+// and falls back to a legacy transaction on chains that have not activated London.
+func (b *TxBuild) buildTxData(ctx context.Context, nonce uint64, to common.Address, value *big.Int, data []byte, gasLimit uint64) (types.TxData, error) {
+	head, err := b.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if head.BaseFee == nil {
+		gasPrice, err := b.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &types.LegacyTx{
+			Nonce:    nonce,
+			To:       &to,
+			Value:    value,
+			Gas:      gasLimit,
+			GasPrice: gasPrice,
+			Data:     data,
+		}, nil
+	}
+
+	gasTipCap, err := b.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &types.DynamicFeeTx{
+		Nonce:     nonce,
+		To:        &to,
+		Value:     value,
+		Gas:       gasLimit,
+		GasTipCap: gasTipCap,
+		GasFeeCap: b.gasFeeCap(head.BaseFee, gasTipCap),
+		Data:      data,
+	}, nil
+}
+
+func (b *TxBuild) gasFeeCap(baseFee, gasTipCap *big.Int) *big.Int {
+	multiplier := b.feeMultiplier
+	if multiplier <= 0 {
+		multiplier = defaultFeeMultiplier
+	}
+	feeCap, _ := new(big.Float).Mul(new(big.Float).SetInt(baseFee), big.NewFloat(multiplier)).Int(nil)
+	return feeCap.Add(feeCap, gasTipCap)
 }
 
+// refreshNonce resyncs the local nonce with the node, callers must hold nonceMu
+// once the builder is shared.
 func (b *TxBuild) refreshNonce(ctx context.Context) {
 	nonce, err := b.client.PendingNonceAt(ctx, b.Sender())
 	if err != nil {
-		log.Error("failed to refresh nonce", "address", b.Sender(), "err", err)
+		log.WithContext(ctx).WithField("address", b.Sender().String()).WithError(err).Error("Failed to refresh nonce")
 		return
 	}
 
@@ -2,16 +2,24 @@ package chain
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/big"
+	"net/http/httptest"
 	"reflect"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 func TestTxBuilder(t *testing.T) {
@@ -31,8 +39,8 @@ func TestTxBuilder(t *testing.T) {
 
 	txBuilder := &TxBuild{
 		client:      simClient,
-		privateKey:  privateKey,
-		signer:      types.NewEIP155Signer(big.NewInt(1337)),
+		signer:      NewKeySigner(privateKey),
+		chainID:     big.NewInt(1337),
 		fromAddress: crypto.PubkeyToAddress(privateKey.PublicKey),
 	}
 	bgCtx := context.Background()
@@ -52,7 +60,15 @@ func TestTxBuilder(t *testing.T) {
 		t.Errorf("did not commit sent transaction. expected hash %v got hash %v", block.Transactions()[0].Hash(), txHash)
 	}
 
-	bal, err := simClient.BalanceAt(bgCtx, toAddress, nil)
+	nonce, err := txBuilder.NonceAt(bgCtx, fromAddress)
+	if err != nil {
+		t.Error(err)
+	}
+	if nonce != 1 {
+		t.Errorf("expected sender nonce 1 after one transfer, got %d", nonce)
+	}
+
+	bal, err := txBuilder.BalanceAt(bgCtx, toAddress)
 	if err != nil {
 		t.Error(err)
 	}
@@ -60,3 +76,467 @@ func TestTxBuilder(t *testing.T) {
 		t.Errorf("expected balance for to address not received. expected: %v actual: %v", value, bal)
 	}
 }
+
+func TestGasFeeCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		multiplier float64
+		want       *big.Int
+	}{
+		{name: "default", multiplier: 0, want: big.NewInt(2100)},
+		{name: "custom", multiplier: 1.5, want: big.NewInt(1600)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &TxBuild{feeMultiplier: tt.multiplier}
+			if got := b.gasFeeCap(big.NewInt(1000), big.NewInt(100)); got.Cmp(tt.want) != 0 {
+				t.Errorf("gasFeeCap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTxBuilderNonceResync(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	txBuilder := &TxBuild{
+		client:      simClient,
+		signer:      NewKeySigner(privateKey),
+		chainID:     big.NewInt(1337),
+		fromAddress: fromAddress,
+	}
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B").Hex()
+	for i := 0; i < 2; i++ {
+		if _, err := txBuilder.Transfer(bgCtx, toAddress, big.NewInt(1000)); err != nil {
+			t.Fatalf("could not send tx %d: %v", i, err)
+		}
+	}
+	simClient.Commit()
+	if txBuilder.nonce != 2 {
+		t.Errorf("expected local nonce 2 after two sends, got %d", txBuilder.nonce)
+	}
+
+	// Drift the local nonce behind the chain, the rejected send must resync it
+	txBuilder.nonce = 0
+	if _, err := txBuilder.Transfer(bgCtx, toAddress, big.NewInt(1000)); err == nil {
+		t.Fatal("expected nonce too low error")
+	}
+	if txBuilder.nonce != 2 {
+		t.Errorf("expected nonce resynced to 2, got %d", txBuilder.nonce)
+	}
+	if _, err := txBuilder.Transfer(bgCtx, toAddress, big.NewInt(1000)); err != nil {
+		t.Errorf("could not send tx after resync: %v", err)
+	}
+}
+
+func TestTransferFee(t *testing.T) {
+	simClient := backends.NewSimulatedBackend(core.GenesisAlloc{}, 10000000)
+	defer simClient.Close()
+
+	txBuilder := &TxBuild{client: simClient}
+	bgCtx := context.Background()
+	to := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	fee, err := txBuilder.TransferFee(bgCtx, to, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, _ := simClient.HeaderByNumber(bgCtx, nil)
+	tip, _ := simClient.SuggestGasTipCap(bgCtx)
+	want := new(big.Int).Mul(txBuilder.gasFeeCap(head.BaseFee, tip), big.NewInt(21000))
+	if fee.Cmp(want) != 0 {
+		t.Errorf("TransferFee() = %v, want %v", fee, want)
+	}
+
+	// The gas limit is the one Transfer would send with
+	txBuilder.gasMultiplier = 1.5
+	fee, err = txBuilder.TransferFee(bgCtx, to, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := new(big.Int).Mul(txBuilder.gasFeeCap(head.BaseFee, tip), big.NewInt(31500)); fee.Cmp(want) != 0 {
+		t.Errorf("TransferFee() with a gas multiplier = %v, want %v", fee, want)
+	}
+
+	gasPrice, err := txBuilder.GasPrice(bgCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := txBuilder.gasFeeCap(head.BaseFee, tip); gasPrice.Cmp(want) != 0 {
+		t.Errorf("GasPrice() = %v, want %v", gasPrice, want)
+	}
+}
+
+func TestIsContract(t *testing.T) {
+	contract := common.HexToAddress("0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984")
+	account := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			contract: {Balance: big.NewInt(0), Code: []byte{0x60, 0x00}},
+			account:  {Balance: big.NewInt(1000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	txBuilder := &TxBuild{client: simClient}
+	tests := []struct {
+		name    string
+		address common.Address
+		want    bool
+	}{
+		{name: "contract", address: contract, want: true},
+		{name: "account", address: account, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := txBuilder.IsContract(context.Background(), tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsContract() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// flakyBackend fails the first sends with err before passing them to the simulated backend.
+type flakyBackend struct {
+	*backends.SimulatedBackend
+	failures int
+	err      error
+	sends    int
+}
+
+func (f *flakyBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	f.sends++
+	if f.sends <= f.failures {
+		return f.err
+	}
+	return f.SimulatedBackend.SendTransaction(ctx, tx)
+}
+
+func TestTxBuilderSendRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantSends int
+		wantErr   bool
+	}{
+		{name: "transient error retried", failures: 2, err: rpc.HTTPError{StatusCode: 502, Status: "502 Bad Gateway"}, wantSends: 3},
+		{name: "connection reset retried", failures: 1, err: errors.New("read tcp: connection reset by peer"), wantSends: 2},
+		{name: "retries exhausted", failures: 5, err: rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"}, wantSends: 3, wantErr: true},
+		{name: "deterministic error not retried", failures: 1, err: errors.New("insufficient funds for gas * price + value"), wantSends: 1, wantErr: true},
+		{name: "already known is sent", failures: 1, err: errors.New("already known"), wantSends: 1},
+		{name: "underpriced replacement bumped", failures: 2, err: errors.New("replacement transaction underpriced"), wantSends: 3},
+		{name: "fee bumps exhausted", failures: 5, err: errors.New("replacement transaction underpriced"), wantSends: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+			fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+			simClient := backends.NewSimulatedBackend(
+				core.GenesisAlloc{
+					fromAddress: {Balance: big.NewInt(10000000000000000)},
+				}, 10000000,
+			)
+			defer simClient.Close()
+			client := &flakyBackend{SimulatedBackend: simClient, failures: tt.failures, err: tt.err}
+
+			txBuilder := &TxBuild{
+				client:      client,
+				signer:      NewKeySigner(privateKey),
+				chainID:     big.NewInt(1337),
+				fromAddress: fromAddress,
+				sendRetries: 2,
+				sendBackoff: time.Millisecond,
+			}
+			_, err := txBuilder.Transfer(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Transfer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if client.sends != tt.wantSends {
+				t.Errorf("sends = %d, want %d", client.sends, tt.wantSends)
+			}
+			if !tt.wantErr && txBuilder.nonce != 1 {
+				t.Errorf("expected local nonce 1 after a successful send, got %d", txBuilder.nonce)
+			}
+		})
+	}
+}
+
+func TestBumpFee(t *testing.T) {
+	to := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	dynamic := types.NewTx(&types.DynamicFeeTx{Nonce: 3, To: &to, Gas: 21000, GasTipCap: big.NewInt(800), GasFeeCap: big.NewInt(1600)})
+	bumped := types.NewTx(bumpFee(dynamic))
+	if bumped.GasTipCap().Int64() != 901 || bumped.GasFeeCap().Int64() != 1801 {
+		t.Errorf("bumped fees = %v/%v, want 901/1801", bumped.GasTipCap(), bumped.GasFeeCap())
+	}
+	if bumped.Nonce() != 3 || *bumped.To() != to || bumped.Gas() != 21000 {
+		t.Errorf("bumped tx changed nonce, recipient or gas")
+	}
+
+	legacy := types.NewTx(&types.LegacyTx{Nonce: 3, To: &to, Gas: 21000, GasPrice: big.NewInt(1000)})
+	if price := types.NewTx(bumpFee(legacy)).GasPrice().Int64(); price != 1126 {
+		t.Errorf("bumped gas price = %d, want 1126", price)
+	}
+}
+
+func TestTxBuilderDryRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance int64
+	}{
+		{name: "funded wallet", balance: 10000000000000000},
+		{name: "unfunded wallet", balance: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+			fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+			simClient := backends.NewSimulatedBackend(
+				core.GenesisAlloc{
+					fromAddress: {Balance: big.NewInt(tt.balance)},
+				}, 10000000,
+			)
+			defer simClient.Close()
+			client := &flakyBackend{SimulatedBackend: simClient}
+
+			txBuilder := &TxBuild{
+				client:      client,
+				signer:      NewKeySigner(privateKey),
+				chainID:     big.NewInt(1337),
+				fromAddress: fromAddress,
+				dryRun:      true,
+			}
+			txHash, err := txBuilder.Transfer(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+			if err != nil {
+				t.Fatalf("Transfer() error = %v", err)
+			}
+			if txHash == (common.Hash{}) {
+				t.Error("expected a synthetic tx hash")
+			}
+			if client.sends != 0 {
+				t.Errorf("dry run broadcast %d transactions", client.sends)
+			}
+			if txBuilder.nonce != 0 {
+				t.Errorf("dry run advanced the local nonce to %d", txBuilder.nonce)
+			}
+		})
+	}
+}
+
+func TestTxBuilderSendInterval(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+
+	txBuilder := &TxBuild{
+		client:      simClient,
+		signer:      NewKeySigner(privateKey),
+		chainID:     big.NewInt(1337),
+		fromAddress: fromAddress,
+	}
+	WithSendInterval(50*time.Millisecond, 60*time.Millisecond)(txBuilder)
+	ctx := context.Background()
+	send := func() error {
+		_, err := txBuilder.Transfer(ctx, "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+		return err
+	}
+
+	start := time.Now()
+	if err := send(); err != nil {
+		t.Fatalf("first send error = %v", err)
+	}
+	if err := send(); err != nil {
+		t.Fatalf("second send error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("second send after %s, want it to wait for the interval", elapsed)
+	}
+
+	// Two sends queued ahead would make a third one wait longer than allowed
+	txBuilder.nextSend = time.Now().Add(100 * time.Millisecond)
+	if err := send(); !errors.Is(err, ErrSendThrottled) {
+		t.Errorf("send error = %v, want %v", err, ErrSendThrottled)
+	}
+	if txBuilder.nonce != 2 {
+		t.Errorf("nonce = %d, want the throttled send to leave it", txBuilder.nonce)
+	}
+}
+
+// gasBackend answers gas estimates with a fixed value or error.
+type gasBackend struct {
+	*backends.SimulatedBackend
+	estimate uint64
+	err      error
+}
+
+func (g *gasBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return g.estimate, g.err
+}
+
+func TestTxBuilderGasEstimation(t *testing.T) {
+	tests := []struct {
+		name       string
+		estimate   uint64
+		err        error
+		multiplier float64
+		fallback   uint64
+		maxGas     uint64
+		want       uint64
+		wantErr    error
+	}{
+		{name: "estimate", estimate: 30000, want: 30000},
+		{name: "buffered estimate", estimate: 30000, multiplier: 1.5, want: 45000},
+		{name: "buffer capped", estimate: 30000, multiplier: 2, maxGas: 50000, want: 50000},
+		{name: "estimate above maximum", estimate: 60000, maxGas: 50000, wantErr: ErrGasLimitExceeded},
+		{name: "failed estimate uses transfer gas", err: errors.New("execution reverted"), want: 21000},
+		{name: "failed estimate uses fallback", err: errors.New("execution reverted"), fallback: 40000, want: 40000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+			fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+			simClient := backends.NewSimulatedBackend(
+				core.GenesisAlloc{
+					fromAddress: {Balance: big.NewInt(10000000000000000)},
+				}, 10000000,
+			)
+			defer simClient.Close()
+
+			txBuilder := &TxBuild{
+				client:      &gasBackend{SimulatedBackend: simClient, estimate: tt.estimate, err: tt.err},
+				signer:      NewKeySigner(privateKey),
+				chainID:     big.NewInt(1337),
+				fromAddress: fromAddress,
+			}
+			WithGasEstimation(tt.multiplier, tt.fallback, tt.maxGas)(txBuilder)
+			txHash, err := txBuilder.Transfer(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transfer() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			tx, _, err := simClient.TransactionByHash(context.Background(), txHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.Gas() != tt.want {
+				t.Errorf("gas limit = %d, want %d", tx.Gas(), tt.want)
+			}
+		})
+	}
+}
+
+func TestIsInsufficientFunds(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New("insufficient funds for gas * price + value"), want: true},
+		{err: fmt.Errorf("send failed: %w", core.ErrInsufficientFundsForTransfer), want: true},
+		{err: errors.New("Insufficient balance for transfer"), want: true},
+		{err: errors.New("nonce too low"), want: false},
+		{err: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := IsInsufficientFunds(tt.err); got != tt.want {
+			t.Errorf("IsInsufficientFunds(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{err: errors.New("insufficient funds for gas * price + value"), want: ErrInsufficientFunds},
+		{err: errors.New("nonce too low: next nonce 5, tx nonce 4"), want: ErrNonceTooLow},
+		{err: errors.New("nonce too high: next nonce 4, tx nonce 6"), want: ErrNonceTooHigh},
+		{err: errors.New("exceeds block gas limit"), want: ErrGasTooHigh},
+		{err: errors.New("execution reverted: not allowed"), want: ErrTxReverted},
+		{err: errors.New("503 Service Unavailable"), want: ErrNodeUnavailable},
+		{err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: ErrNodeUnavailable},
+	}
+	for _, tt := range tests {
+		err := wrapError(tt.err)
+		if !errors.Is(err, tt.want) || !errors.Is(err, tt.err) {
+			t.Errorf("wrapError(%v) = %v, want it to be %v and keep the node's error", tt.err, err, tt.want)
+		}
+		if err.Error() != tt.err.Error() {
+			t.Errorf("wrapError(%v) message = %q, want the node's message", tt.err, err.Error())
+		}
+	}
+	if err := wrapError(errors.New("nonce too high")); errors.Is(err, ErrNonceTooLow) {
+		t.Errorf("wrapError(nonce too high) = %v, want it not to be ErrNonceTooLow", err)
+	}
+	for _, err := range []error{nil, context.DeadlineExceeded, errors.New("unknown account")} {
+		if got := wrapError(err); got != err {
+			t.Errorf("wrapError(%v) = %v, want it unchanged", err, got)
+		}
+	}
+}
+
+// fakeNode answers the few calls NewTxBuilder makes on startup.
+type fakeNode struct {
+	chainID int64
+}
+
+func (n *fakeNode) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(n.chainID))
+}
+
+func (n *fakeNode) GetTransactionCount(account common.Address, block string) hexutil.Uint64 {
+	return 7
+}
+
+func (n *fakeNode) ClientVersion() string {
+	return "Geth/v1.10.26-stable"
+}
+
+func TestNewTxBuilderChainID(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	node := &fakeNode{chainID: 5}
+	srv := rpc.NewServer()
+	defer srv.Stop()
+	if err := srv.RegisterName("eth", node); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.RegisterName("web3", node); err != nil {
+		t.Fatal(err)
+	}
+	provider := httptest.NewServer(srv)
+	defer provider.Close()
+
+	for _, expected := range []*big.Int{nil, big.NewInt(5)} {
+		txBuilder, err := NewTxBuilder(provider.URL, NewKeySigner(privateKey), expected)
+		if err != nil {
+			t.Fatalf("NewTxBuilder(%v) error = %v", expected, err)
+		}
+		if txBuilder.ChainID().Int64() != 5 {
+			t.Errorf("ChainID() = %s, want the node's chain 5", txBuilder.ChainID())
+		}
+	}
+
+	_, err := NewTxBuilder(provider.URL, NewKeySigner(privateKey), big.NewInt(11155111))
+	if !errors.Is(err, ErrChainIDMismatch) {
+		t.Errorf("NewTxBuilder() error = %v, want %v", err, ErrChainIDMismatch)
+	}
+}
@@ -1,20 +1,69 @@
 package chain
 
 import (
-	"math"
+	"errors"
+	"fmt"
 	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 )
 
 func EtherToWei(amount float64) *big.Int {
-	//ether := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
-	//return new(big.Int).Mul(big.NewInt(amount), ether)
-	wei := math.Pow10(18) * amount
-	weiAmount := new(big.Float)
-	weiAmount.SetFloat64(wei)
-	result := new(big.Int)
-	weiAmount.Int(result)
+	return ToBaseUnits(amount, 18)
+}
+
+// ToBaseUnits converts a token amount into its smallest unit given the token decimals.
+// Digits beyond the token precision are truncated.
+func ToBaseUnits(amount float64, decimals int) *big.Int {
+	str := strconv.FormatFloat(amount, 'f', -1, 64)
+	if i := strings.IndexByte(str, '.'); i >= 0 && len(str)-i-1 > decimals {
+		str = strings.TrimSuffix(str[:i+1+decimals], ".")
+	}
+	result, err := EtherToWeiDecimal(str, decimals)
+	if err != nil {
+		return new(big.Int)
+	}
+	return result
+}
+
+// EtherToWeiDecimal exactly converts a base-10 amount string into its smallest unit given the decimals.
+func EtherToWeiDecimal(s string, decimals int) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if whole == "" && fraction == "" {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("amount %q has more than %d decimal places", s, decimals)
+	}
+	digits := whole + fraction + strings.Repeat("0", decimals-len(fraction))
+	if strings.Trim(digits, "0123456789") != "" {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+
+	result, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	return result, nil
+}
+
+// FromBaseUnits formats an amount of the smallest unit as a decimal string without trailing zeros.
+func FromBaseUnits(amount *big.Int, decimals int) string {
+	digits := new(big.Int).Abs(amount).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	result := whole
+	if fraction != "" {
+		result += "." + fraction
+	}
+	if amount.Sign() < 0 {
+		result = "-" + result
+	}
 	return result
 }
 
@@ -28,3 +77,80 @@ func IsValidAddress(address string, checksummed bool) bool {
 	}
 	return !checksummed || common.HexToAddress(address).Hex() == address
 }
+
+// chainShortNames maps the chain IDs of well known networks to their EIP-3770 short names,
+// as listed at https://github.com/ethereum-lists/chains.
+var chainShortNames = map[int64]string{
+	1:        "eth",
+	5:        "gor",
+	10:       "oeth",
+	56:       "bnb",
+	100:      "gno",
+	137:      "matic",
+	8453:     "base",
+	17000:    "holesky",
+	42161:    "arb1",
+	59144:    "linea",
+	84532:    "basesep",
+	11155111: "sep",
+}
+
+// ChainShortName returns the EIP-3770 short name of a well known chain, or "" when unknown.
+func ChainShortName(chainID *big.Int) string {
+	if chainID == nil || !chainID.IsInt64() {
+		return ""
+	}
+	return chainShortNames[chainID.Int64()]
+}
+
+// SplitChainPrefix splits an EIP-3770 chain specific address such as "gno:0x..." into its
+// short name and address. Addresses without a prefix return an empty short name.
+func SplitChainPrefix(address string) (shortName, hexAddress string) {
+	if prefix, rest, ok := strings.Cut(address, ":"); ok {
+		return prefix, rest
+	}
+	return "", address
+}
+
+const paymentURIScheme = "ethereum:"
+
+// IsPaymentURI reports whether s is an EIP-681 payment request, as encoded in wallet QR codes.
+func IsPaymentURI(s string) bool {
+	return len(s) > len(paymentURIScheme) && strings.EqualFold(s[:len(paymentURIScheme)], paymentURIScheme)
+}
+
+// ParsePaymentURI returns the recipient of an EIP-681 payment request such as
+// "ethereum:0x...@11155111" and its chain ID, nil when the request names none. ERC-20 transfer
+// requests, as in "ethereum:0xToken@1/transfer?address=0x...", name the recipient in their
+// address parameter. The recipient is returned as written, it may be an ENS name.
+func ParsePaymentURI(uri string) (string, *big.Int, error) {
+	if !IsPaymentURI(uri) {
+		return "", nil, errors.New("not an ethereum: URI")
+	}
+	rest, query, _ := strings.Cut(uri[len(paymentURIScheme):], "?")
+	target, function, _ := strings.Cut(rest, "/")
+	target, chain, hasChain := strings.Cut(strings.TrimPrefix(target, "pay-"), "@")
+	var chainID *big.Int
+	if hasChain {
+		id, ok := new(big.Int).SetString(chain, 10)
+		if !ok || id.Sign() <= 0 {
+			return "", nil, fmt.Errorf("invalid chain ID %q", chain)
+		}
+		chainID = id
+	}
+	switch function {
+	case "":
+	case "transfer":
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return "", nil, err
+		}
+		target = values.Get("address")
+	default:
+		return "", nil, fmt.Errorf("unsupported function %q", function)
+	}
+	if target == "" {
+		return "", nil, errors.New("no recipient")
+	}
+	return target, chainID, nil
+}
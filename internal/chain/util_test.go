@@ -39,6 +39,8 @@ func TestEtherToWei(t *testing.T) {
 		want   *big.Int
 	}{
 		{name: "1ether", amount: 1, want: new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)},
+		{name: "0.1ether", amount: 0.1, want: big.NewInt(100000000000000000)},
+		{name: "1.337ether", amount: 1.337, want: big.NewInt(1337000000000000000)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -48,3 +50,137 @@ func TestEtherToWei(t *testing.T) {
 		})
 	}
 }
+
+func TestToBaseUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		decimals int
+		want     *big.Int
+	}{
+		{name: "6 decimals", amount: 100, decimals: 6, want: big.NewInt(100000000)},
+		{name: "0 decimals", amount: 42, decimals: 0, want: big.NewInt(42)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToBaseUnits(tt.amount, tt.decimals); got.Cmp(tt.want) != 0 {
+				t.Errorf("ToBaseUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromBaseUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   *big.Int
+		decimals int
+		want     string
+	}{
+		{name: "whole", amount: big.NewInt(2000000000000000000), decimals: 18, want: "2"},
+		{name: "fraction", amount: big.NewInt(1500000), decimals: 6, want: "1.5"},
+		{name: "below one", amount: big.NewInt(1), decimals: 18, want: "0.000000000000000001"},
+		{name: "zero", amount: big.NewInt(0), decimals: 18, want: "0"},
+		{name: "0 decimals", amount: big.NewInt(42), decimals: 0, want: "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromBaseUnits(tt.amount, tt.decimals); got != tt.want {
+				t.Errorf("FromBaseUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEtherToWeiDecimal(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		decimals int
+		want     *big.Int
+		wantErr  bool
+	}{
+		{name: "integer", amount: "2", decimals: 18, want: big.NewInt(2000000000000000000)},
+		{name: "fraction", amount: "0.000000000000000001", decimals: 18, want: big.NewInt(1)},
+		{name: "leading dot", amount: ".5", decimals: 6, want: big.NewInt(500000)},
+		{name: "too precise", amount: "0.0000001", decimals: 6, wantErr: true},
+		{name: "negative", amount: "-1", decimals: 18, wantErr: true},
+		{name: "garbage", amount: "1e18", decimals: 18, wantErr: true},
+		{name: "empty", amount: "", decimals: 18, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EtherToWeiDecimal(tt.amount, tt.decimals)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EtherToWeiDecimal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.Cmp(tt.want) != 0 {
+				t.Errorf("EtherToWeiDecimal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitChainPrefix(t *testing.T) {
+	tests := []struct {
+		address   string
+		wantName  string
+		wantHex   string
+		wantValid bool
+	}{
+		{address: "gno:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantName: "gno", wantHex: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantValid: true},
+		{address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantName: "", wantHex: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantValid: true},
+		{address: "eth:invalid", wantName: "eth", wantHex: "invalid", wantValid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			name, hex := SplitChainPrefix(tt.address)
+			if name != tt.wantName || hex != tt.wantHex {
+				t.Errorf("SplitChainPrefix() = %q, %q, want %q, %q", name, hex, tt.wantName, tt.wantHex)
+			}
+			if valid := IsValidAddress(hex, false); valid != tt.wantValid {
+				t.Errorf("IsValidAddress() = %v, want %v", valid, tt.wantValid)
+			}
+		})
+	}
+	if name := ChainShortName(big.NewInt(100)); name != "gno" {
+		t.Errorf("ChainShortName(100) = %q, want gno", name)
+	}
+}
+
+func TestParsePaymentURI(t *testing.T) {
+	tests := []struct {
+		uri         string
+		wantAddress string
+		wantChainID *big.Int
+		wantErr     bool
+	}{
+		{uri: "ethereum:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantAddress: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"},
+		{uri: "ethereum:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B@11155111", wantAddress: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantChainID: big.NewInt(11155111)},
+		{uri: "ETHEREUM:pay-0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B@5?value=1e18", wantAddress: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantChainID: big.NewInt(5)},
+		{uri: "ethereum:vitalik.eth", wantAddress: "vitalik.eth"},
+		{uri: "ethereum:0x6B175474E89094C44Da98b954EedeAC495271d0F@1/transfer?address=0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B&uint256=1", wantAddress: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantChainID: big.NewInt(1)},
+		{uri: "ethereum:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B@sepolia", wantErr: true},
+		{uri: "ethereum:0x6B175474E89094C44Da98b954EedeAC495271d0F/approve?address=0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", wantErr: true},
+		{uri: "ethereum:0x6B175474E89094C44Da98b954EedeAC495271d0F/transfer", wantErr: true},
+		{uri: "ethereum:@1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if !IsPaymentURI(tt.uri) {
+				t.Fatal("IsPaymentURI() = false")
+			}
+			address, chainID, err := ParsePaymentURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePaymentURI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if address != tt.wantAddress || (chainID == nil) != (tt.wantChainID == nil) || (chainID != nil && chainID.Cmp(tt.wantChainID) != 0) {
+				t.Errorf("ParsePaymentURI() = %q, %v, want %q, %v", address, chainID, tt.wantAddress, tt.wantChainID)
+			}
+		})
+	}
+	if IsPaymentURI("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B") || IsPaymentURI("eth:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B") {
+		t.Error("IsPaymentURI() accepted a plain or EIP-3770 address")
+	}
+}
@@ -0,0 +1,48 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const wethABIJSON = `[
+	{"constant":false,"inputs":[],"name":"deposit","outputs":[],"payable":true,"type":"function"}
+]`
+
+// wethTransferGas bounds the transfer following a deposit. It cannot be estimated up front,
+// since the wallet only holds the wrapped tokens once the deposit is mined, and covers the
+// WETH9 transfer with room to spare.
+const wethTransferGas = 65000
+
+var wethABI = mustParseABI(wethABIJSON)
+
+// WrapAndTransfer deposits amount into the WETH contract and transfers the wrapped tokens to the
+// recipient, returning the hashes of both transactions. A failed transfer returns the deposit hash
+// along with the error, the wrapped tokens then stay with the faucet.
+func (b *TxBuild) WrapAndTransfer(ctx context.Context, weth common.Address, to common.Address, amount *big.Int) ([]common.Hash, error) {
+	deposit, err := wethABI.Pack("deposit")
+	if err != nil {
+		return nil, err
+	}
+	gasLimit, err := b.estimateGas(ctx, weth, amount, deposit, 0)
+	if err != nil {
+		return nil, err
+	}
+	depositHash, err := b.sendTx(ctx, weth, amount, deposit, gasLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer, err := erc20ABI.Pack("transfer", to, amount)
+	if err != nil {
+		return []common.Hash{depositHash}, err
+	}
+	// The nonce follows the deposit, so the node executes the transfer after it
+	transferHash, err := b.sendTx(ctx, weth, new(big.Int), transfer, wethTransferGas)
+	if err != nil {
+		return []common.Hash{depositHash}, err
+	}
+	return []common.Hash{depositHash, transferHash}, nil
+}
@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestWrapAndTransfer(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+		}, 10000000,
+	)
+	defer simClient.Close()
+	var s *backends.SimulatedBackend
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(s), "SuggestGasPrice", func(_ *backends.SimulatedBackend, _ context.Context) (*big.Int, error) {
+		return big.NewInt(875000000), nil
+	})
+	defer patches.Reset()
+
+	txBuilder := &TxBuild{
+		client:      simClient,
+		signer:      NewKeySigner(privateKey),
+		chainID:     big.NewInt(1337),
+		fromAddress: fromAddress,
+	}
+	bgCtx := context.Background()
+	weth := common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	txHashes, err := txBuilder.WrapAndTransfer(bgCtx, weth, toAddress, big.NewInt(1000))
+	if err != nil {
+		t.Fatalf("could not add txs to pending block: %v", err)
+	}
+	simClient.Commit()
+	if len(txHashes) != 2 {
+		t.Fatalf("got %d tx hashes, want the deposit and the transfer", len(txHashes))
+	}
+
+	deposit, _, err := simClient.TransactionByHash(bgCtx, txHashes[0])
+	if err != nil {
+		t.Fatalf("could not get deposit transaction: %v", err)
+	}
+	wantDeposit, _ := wethABI.Pack("deposit")
+	if *deposit.To() != weth || deposit.Value().Cmp(big.NewInt(1000)) != 0 || !bytes.Equal(deposit.Data(), wantDeposit) {
+		t.Errorf("unexpected deposit to %v of %v with calldata %x", deposit.To(), deposit.Value(), deposit.Data())
+	}
+
+	transfer, _, err := simClient.TransactionByHash(bgCtx, txHashes[1])
+	if err != nil {
+		t.Fatalf("could not get transfer transaction: %v", err)
+	}
+	wantTransfer, _ := erc20ABI.Pack("transfer", toAddress, big.NewInt(1000))
+	if *transfer.To() != weth || !bytes.Equal(transfer.Data(), wantTransfer) {
+		t.Errorf("unexpected transfer to %v with calldata %x", transfer.To(), transfer.Data())
+	}
+	if transfer.Nonce() != deposit.Nonce()+1 {
+		t.Errorf("transfer nonce = %d, want it to follow the deposit nonce %d", transfer.Nonce(), deposit.Nonce())
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// burnAddresses can never spend what they receive, claims to them are always rejected.
+var burnAddresses = []string{
+	"0x0000000000000000000000000000000000000000",
+	"0x000000000000000000000000000000000000dEaD",
+}
+
+// AccessList matches claim addresses case-insensitively and client IPs by CIDR range.
+type AccessList struct {
+	addresses map[string]struct{}
+	networks  []*net.IPNet
+}
+
+// NewAccessList parses entries that are either addresses, IPs or CIDR ranges.
+func NewAccessList(entries []string) (*AccessList, error) {
+	list := &AccessList{addresses: make(map[string]struct{})}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case chain.IsValidAddress(entry, false):
+			list.addresses[strings.ToLower(entry)] = struct{}{}
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, err
+			}
+			list.networks = append(list.networks, network)
+		default:
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid access list entry %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			list.networks = append(list.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return list, nil
+}
+
+// LoadAccessList combines static entries with the ones read from path, one per line.
+// Blank lines and lines starting with # are ignored. An empty path skips the file.
+func LoadAccessList(entries []string, path string) (*AccessList, error) {
+	if path == "" {
+		return NewAccessList(entries)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	all := append([]string{}, entries...)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		all = append(all, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewAccessList(all)
+}
+
+func (a *AccessList) ContainsAddress(address string) bool {
+	if a == nil {
+		return false
+	}
+	_, ok := a.addresses[strings.ToLower(address)]
+	return ok
+}
+
+func (a *AccessList) ContainsIP(clientIP string) bool {
+	if a == nil {
+		return false
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
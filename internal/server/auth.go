@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/urfave/negroni"
+)
+
+// APIKeyAuth marks requests carrying one of the configured keys, either as
+// "Authorization: Bearer <key>" or "X-API-Key: <key>". Requests without a key
+// pass unchanged, those with an unknown key are rejected.
+type APIKeyAuth struct {
+	keys [][]byte
+}
+
+func NewAPIKeyAuth(keys []string) *APIKeyAuth {
+	auth := &APIKeyAuth{}
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			auth.keys = append(auth.keys, []byte(key))
+		}
+	}
+	return auth
+}
+
+func (a *APIKeyAuth) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	key := requestAPIKey(r)
+	if key == "" || len(a.keys) == 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if !a.valid(key) {
+		renderFailure(w, r, codeInvalidAPIKey, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, true)))
+}
+
+// valid compares against every key in constant time, so timing reveals neither the key nor which one matched.
+func (a *APIKeyAuth) valid(key string) bool {
+	var match int
+	for _, k := range a.keys {
+		match |= subtle.ConstantTimeCompare(k, []byte(key))
+	}
+	return match == 1
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func authenticated(r *http.Request) bool {
+	ok, _ := r.Context().Value(apiKeyContextKey).(bool)
+	return ok
+}
+
+// byAPIKey runs public for requests without a valid API key and keyed for those with one,
+// a nil handler lets the request through.
+func byAPIKey(public, keyed negroni.Handler) negroni.Handler {
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		h := public
+		if authenticated(r) {
+			h = keyed
+		}
+		if h == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r, next)
+	})
+}
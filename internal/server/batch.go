@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Defaults for batching native payouts, see Config.BatchWindow and Config.BatchSize.
+const (
+	DefaultBatchWindow = 2 * time.Second
+	DefaultBatchSize   = 50
+)
+
+// batchSender pays every recipient the value at the same index in one transaction.
+type batchSender func(ctx context.Context, recipients []common.Address, values []*big.Int) (common.Hash, error)
+
+type batchItem struct {
+	to    common.Address
+	value *big.Int
+	done  chan batchResult
+}
+
+type batchResult struct {
+	txHash common.Hash
+	err    error
+}
+
+// Batcher collects the native payouts of concurrent claims for up to window, or until size
+// are pending, and sends them in a single transaction whose hash every claim receives.
+type Batcher struct {
+	mu      sync.Mutex
+	pending []*batchItem
+	timer   *time.Timer
+	window  time.Duration
+	size    int
+	timeout time.Duration
+	send    batchSender
+}
+
+func NewBatcher(send batchSender, window time.Duration, size int, timeout time.Duration) *Batcher {
+	if window <= 0 {
+		window = DefaultBatchWindow
+	}
+	if size < 1 {
+		size = DefaultBatchSize
+	}
+	return &Batcher{
+		window:  window,
+		size:    size,
+		timeout: timeout,
+		send:    send,
+	}
+}
+
+// Add queues a payout of value to the recipient and waits for the batch it joins to be sent.
+// Once the batch is flushed it is sent regardless of ctx, so a payout returned as cancelled may still be made.
+func (b *Batcher) Add(ctx context.Context, to common.Address, value *big.Int) (common.Hash, error) {
+	item := &batchItem{to: to, value: value, done: make(chan batchResult, 1)}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, item)
+	var full []*batchItem
+	switch {
+	case len(b.pending) >= b.size:
+		full = b.take()
+	case len(b.pending) == 1:
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+	b.mu.Unlock()
+
+	if full != nil {
+		b.sendBatch(full)
+	}
+	select {
+	case result := <-item.done:
+		return result.txHash, result.err
+	case <-ctx.Done():
+		return common.Hash{}, ctx.Err()
+	}
+}
+
+func (b *Batcher) flush() {
+	b.mu.Lock()
+	items := b.take()
+	b.mu.Unlock()
+
+	if len(items) > 0 {
+		b.sendBatch(items)
+	}
+}
+
+// take empties the pending batch, the caller must hold mu.
+func (b *Batcher) take() []*batchItem {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	items := b.pending
+	b.pending = nil
+	return items
+}
+
+func (b *Batcher) sendBatch(items []*batchItem) {
+	// The batch serves several claims, so it runs detached from any one of their contexts
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	recipients := make([]common.Address, len(items))
+	values := make([]*big.Int, len(items))
+	for i, item := range items {
+		recipients[i] = item.to
+		values[i] = item.value
+	}
+	txHash, err := b.send(ctx, recipients, values)
+	for _, item := range items {
+		item.done <- batchResult{txHash: txHash, err: err}
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestBatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		claims  int
+		batches []int // recipients per sent batch
+	}{
+		{name: "window flush", size: 10, claims: 3, batches: []int{3}},
+		{name: "full batch", size: 2, claims: 4, batches: []int{2, 2}},
+		{name: "single claim", size: 10, claims: 1, batches: []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var sent []int
+			batcher := NewBatcher(func(ctx context.Context, recipients []common.Address, values []*big.Int) (common.Hash, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				sent = append(sent, len(recipients))
+				return common.BigToHash(big.NewInt(int64(len(sent)))), nil
+			}, 50*time.Millisecond, tt.size, time.Second)
+
+			var wg sync.WaitGroup
+			hashes := make([]common.Hash, tt.claims)
+			for i := 0; i < tt.claims; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					txHash, err := batcher.Add(context.Background(), common.BigToAddress(big.NewInt(int64(i+1))), big.NewInt(1))
+					if err != nil {
+						t.Errorf("claim %d: %v", i, err)
+					}
+					hashes[i] = txHash
+				}(i)
+			}
+			wg.Wait()
+
+			if len(sent) != len(tt.batches) {
+				t.Fatalf("sent %d batches %v, want %v", len(sent), sent, tt.batches)
+			}
+			for i, n := range tt.batches {
+				if sent[i] != n {
+					t.Errorf("batch %d has %d recipients, want %d", i, sent[i], n)
+				}
+			}
+			perHash := map[common.Hash]int{}
+			for _, txHash := range hashes {
+				perHash[txHash]++
+			}
+			if len(perHash) != len(tt.batches) {
+				t.Errorf("claims got %d distinct tx hashes, want one per batch", len(perHash))
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"math/big"
+	"sync"
+	"time"
+)
+
+const budgetWindow = 24 * time.Hour
+
+// Budget caps the wei a faucet dispenses per 24 hour window, on top of the per user limits.
+// The window starts with the first claim and the spent amount resets once it has passed.
+type Budget struct {
+	mu      sync.Mutex
+	limit   *big.Int
+	spent   *big.Int
+	started time.Time
+}
+
+// NewBudget returns a budget of limit wei per day, or nil when limit is not positive.
+func NewBudget(limit *big.Int) *Budget {
+	if limit == nil || limit.Sign() <= 0 {
+		return nil
+	}
+	return &Budget{
+		limit: limit,
+		spent: new(big.Int),
+	}
+}
+
+// reserve records amount as spent, unless it would exceed the remaining budget.
+func (b *Budget) reserve(amount *big.Int) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll()
+	spent := new(big.Int).Add(b.spent, amount)
+	if spent.Cmp(b.limit) > 0 {
+		return false
+	}
+	b.spent = spent
+	return true
+}
+
+// refund returns the amount of a failed claim to the budget.
+func (b *Budget) refund(amount *big.Int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.spent.Sub(b.spent, amount)
+	if b.spent.Sign() < 0 {
+		b.spent.SetInt64(0)
+	}
+}
+
+// remaining returns the wei left in the current window.
+func (b *Budget) remaining() *big.Int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll()
+	return new(big.Int).Sub(b.limit, b.spent)
+}
+
+func (b *Budget) roll() {
+	if now := time.Now(); now.Sub(b.started) >= budgetWindow {
+		b.started = now
+		b.spent.SetInt64(0)
+	}
+}
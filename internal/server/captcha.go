@@ -0,0 +1,388 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	HCaptchaProvider  = "hcaptcha"
+	TurnstileProvider = "turnstile"
+	ReCaptchaProvider = "recaptcha"
+
+	hcaptchaVerifyURL  = "https://hcaptcha.com/siteverify"
+	turnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+	recaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+)
+
+// CaptchaProvider reports false for tokens that fail verification, and an error only when
+// the provider could not give a verdict, see ErrCaptchaUnavailable.
+type CaptchaProvider interface {
+	Verify(token, remoteIP string) (bool, error)
+}
+
+// ErrCaptchaUnavailable wraps transport errors and 5xx answers of a provider, as opposed to rejected tokens.
+var ErrCaptchaUnavailable = errors.New("captcha provider unavailable")
+
+// ScoredCaptchaProvider is implemented by providers that grade a request instead of passing or failing it.
+// Score reports ok false for tokens that failed verification, which are rejected whatever the minimum score.
+type ScoredCaptchaProvider interface {
+	CaptchaProvider
+	Score(token, remoteIP string) (score float64, ok bool, err error)
+}
+
+// DefaultCaptchaFailureStatus answers claims whose captcha fails verification.
+const DefaultCaptchaFailureStatus = http.StatusForbidden
+
+// DefaultCaptchaTimeout bounds the verification calls to a provider unless configured otherwise.
+const DefaultCaptchaTimeout = 10 * time.Second
+
+type Captcha struct {
+	provider      CaptchaProvider
+	header        string
+	minScore      float64
+	failureStatus int
+	// clientIP is forwarded to the provider for scoring, when set
+	clientIP *ClientIPResolver
+	// failOpen lets claims through while the provider is unavailable
+	failOpen bool
+	// bypassToken passes verification without asking the provider, when set
+	bypassToken string
+	// slots bounds the verifications in flight, unbounded when nil
+	slots chan struct{}
+}
+
+type CaptchaOption func(*Captcha)
+
+// WithFailureStatus answers failed verifications with status instead of DefaultCaptchaFailureStatus,
+// e.g. 429 for clients relying on the status of earlier versions.
+func WithFailureStatus(status int) CaptchaOption {
+	return func(c *Captcha) {
+		if status > 0 {
+			c.failureStatus = status
+		}
+	}
+}
+
+// WithCaptchaClientIP passes the client IP derived by clientIP along with the token,
+// which providers use to score the request. Verification goes on without it when
+// no valid IP can be derived.
+func WithCaptchaClientIP(clientIP *ClientIPResolver) CaptchaOption {
+	return func(c *Captcha) {
+		c.clientIP = clientIP
+	}
+}
+
+// WithFailOpen accepts claims unverified while the provider cannot be reached or answers
+// with a server error, instead of rejecting them. Rejected tokens are rejected either way.
+func WithFailOpen(enabled bool) CaptchaOption {
+	return func(c *Captcha) {
+		c.failOpen = enabled
+	}
+}
+
+// WithBypassToken accepts token as valid without asking the provider, so integration tests can
+// claim through the captcha middleware. Anyone who learns the token skips the captcha, it must
+// never be set in production.
+func WithBypassToken(token string) CaptchaOption {
+	return func(c *Captcha) {
+		c.bypassToken = token
+	}
+}
+
+// WithMaxInFlight answers claims with 503 while limit verifications are in flight, instead of
+// letting them pile up waiting on the provider during a flood. Zero leaves them unbounded.
+func WithMaxInFlight(limit int) CaptchaOption {
+	return func(c *Captcha) {
+		if limit > 0 {
+			c.slots = make(chan struct{}, limit)
+		}
+	}
+}
+
+// NewCaptcha creates the captcha middleware, a nil provider disables verification.
+// minScore only applies to providers implementing ScoredCaptchaProvider.
+func NewCaptcha(provider CaptchaProvider, header string, minScore float64, opts ...CaptchaOption) *Captcha {
+	c := &Captcha{
+		provider:      provider,
+		header:        header,
+		minScore:      minScore,
+		failureStatus: DefaultCaptchaFailureStatus,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewCaptchaProvider returns the provider registered under name along with the
+// header its frontend widget submits the token in. It returns a nil provider
+// when no secret is configured. Verifications time out after timeout, or
+// DefaultCaptchaTimeout when it is not positive.
+func NewCaptchaProvider(name, siteKey, secret, action string, timeout time.Duration) (CaptchaProvider, string, error) {
+	if timeout <= 0 {
+		timeout = DefaultCaptchaTimeout
+	}
+	switch strings.ToLower(name) {
+	case "", HCaptchaProvider:
+		if secret == "" {
+			return nil, "h-captcha-response", nil
+		}
+		return NewHCaptcha(siteKey, secret, timeout), "h-captcha-response", nil
+	case TurnstileProvider:
+		if secret == "" {
+			return nil, "cf-turnstile-response", nil
+		}
+		return NewTurnstile(secret, timeout), "cf-turnstile-response", nil
+	case ReCaptchaProvider:
+		if secret == "" {
+			return nil, "g-recaptcha-response", nil
+		}
+		return NewReCaptcha(secret, action, timeout), "g-recaptcha-response", nil
+	default:
+		return nil, "", fmt.Errorf("unknown captcha provider %q", name)
+	}
+}
+
+func (c *Captcha) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if c.provider == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	token := r.Header.Get(c.header)
+	if c.bypassToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.bypassToken)) == 1 {
+		log.WithContext(r.Context()).Debug("Captcha bypassed with the bypass token")
+		next.ServeHTTP(w, r)
+		return
+	}
+	if !c.acquire() {
+		captchaOverloadsTotal.Inc()
+		log.WithContext(r.Context()).Debug("Too many captcha verifications in flight, rejecting claim")
+		renderFailure(w, r, codeCaptchaUnavailable, "Too many captcha verifications in progress, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	ok, err := c.verify(token, c.remoteIP(r))
+	c.release()
+	if err != nil && c.failOpen && errors.Is(err, ErrCaptchaUnavailable) {
+		log.WithContext(r.Context()).WithError(err).Warn("Captcha provider unavailable, accepting claim unverified")
+		next.ServeHTTP(w, r)
+		return
+	}
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).Error("Failed to verify captcha")
+	}
+	if !ok {
+		captchaFailuresTotal.Inc()
+		code := codeCaptchaFailed
+		if errors.Is(err, ErrCaptchaUnavailable) {
+			code = codeCaptchaUnavailable
+		}
+		renderFailure(w, r, code, "Captcha verification failed, please try again", c.failureStatus)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// acquire takes a verification slot without waiting, it reports false when none is free.
+func (c *Captcha) acquire() bool {
+	if c.slots == nil {
+		return true
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Captcha) release() {
+	if c.slots != nil {
+		<-c.slots
+	}
+}
+
+func (c *Captcha) remoteIP(r *http.Request) string {
+	if c.clientIP == nil {
+		return ""
+	}
+	if ip := c.clientIP.ClientIP(r); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return ""
+}
+
+func (c *Captcha) verify(token, remoteIP string) (bool, error) {
+	if scorer, ok := c.provider.(ScoredCaptchaProvider); ok {
+		score, ok, err := scorer.Score(token, remoteIP)
+		if err != nil || !ok {
+			return false, err
+		}
+		return score >= c.minScore, nil
+	}
+	return c.provider.Verify(token, remoteIP)
+}
+
+// siteVerify posts values to a provider's verification endpoint and decodes its answer into result.
+// Failures to reach the provider, server errors and undecodable answers wrap ErrCaptchaUnavailable.
+func siteVerify(client *http.Client, verifyURL string, values url.Values, result interface{}) error {
+	resp, err := client.PostForm(verifyURL, values)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCaptchaUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %s", ErrCaptchaUnavailable, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("%w: %v", ErrCaptchaUnavailable, err)
+	}
+	return nil
+}
+
+// HCaptcha verifies hCaptcha tokens through siteVerify like the other providers. The
+// kataras/hcaptcha client it replaces folds transport errors into the error codes of a failed
+// verification, so outages could not fail open, and keeps the remote IP on the shared client.
+type HCaptcha struct {
+	client  *http.Client
+	siteKey string
+	secret  string
+}
+
+func NewHCaptcha(siteKey, secret string, timeout time.Duration) *HCaptcha {
+	return &HCaptcha{
+		client:  &http.Client{Timeout: timeout},
+		siteKey: siteKey,
+		secret:  secret,
+	}
+}
+
+type hcaptchaResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (h *HCaptcha) Verify(token, remoteIP string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	values := url.Values{
+		"secret":   {h.secret},
+		"response": {token},
+	}
+	if h.siteKey != "" {
+		values.Set("sitekey", h.siteKey)
+	}
+	if remoteIP != "" {
+		values.Set("remoteip", remoteIP)
+	}
+
+	var result hcaptchaResponse
+	if err := siteVerify(h.client, hcaptchaVerifyURL, values, &result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+type Turnstile struct {
+	client *http.Client
+	secret string
+}
+
+func NewTurnstile(secret string, timeout time.Duration) *Turnstile {
+	return &Turnstile{
+		client: &http.Client{Timeout: timeout},
+		secret: secret,
+	}
+}
+
+type turnstileResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (t *Turnstile) Verify(token, remoteIP string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	values := url.Values{
+		"secret":   {t.secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		values.Set("remoteip", remoteIP)
+	}
+
+	var result turnstileResponse
+	if err := siteVerify(t.client, turnstileVerifyURL, values, &result); err != nil {
+		return false, err
+	}
+
+	return result.Success, nil
+}
+
+// ReCaptcha verifies Google reCAPTCHA v3 tokens, which carry a score in [0, 1] instead of a verdict.
+type ReCaptcha struct {
+	client *http.Client
+	secret string
+	action string
+}
+
+func NewReCaptcha(secret, action string, timeout time.Duration) *ReCaptcha {
+	return &ReCaptcha{
+		client: &http.Client{Timeout: timeout},
+		secret: secret,
+		action: action,
+	}
+}
+
+type recaptchaResponse struct {
+	Success    bool     `json:"success"`
+	Score      float64  `json:"score"`
+	Action     string   `json:"action"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (c *ReCaptcha) Verify(token, remoteIP string) (bool, error) {
+	score, ok, err := c.Score(token, remoteIP)
+	return ok && score > 0, err
+}
+
+// Score is not ok for missing tokens, unsuccessful verifications and tokens issued for a different action.
+func (c *ReCaptcha) Score(token, remoteIP string) (float64, bool, error) {
+	if token == "" {
+		return 0, false, nil
+	}
+
+	values := url.Values{
+		"secret":   {c.secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		values.Set("remoteip", remoteIP)
+	}
+
+	var result recaptchaResponse
+	if err := siteVerify(c.client, recaptchaVerifyURL, values, &result); err != nil {
+		return 0, false, err
+	}
+	if !result.Success || (c.action != "" && result.Action != c.action) {
+		return 0, false, nil
+	}
+
+	return result.Score, true, nil
+}
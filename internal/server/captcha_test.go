@@ -0,0 +1,296 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/urfave/negroni"
+)
+
+type stubCaptchaProvider struct {
+	valid    string
+	remoteIP *string
+	err      error
+}
+
+func (p stubCaptchaProvider) Verify(token, remoteIP string) (bool, error) {
+	if p.remoteIP != nil {
+		*p.remoteIP = remoteIP
+	}
+	if p.err != nil {
+		return false, p.err
+	}
+	return token == p.valid, nil
+}
+
+func TestCaptchaFailureStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []CaptchaOption
+		token string
+		want  int
+	}{
+		{name: "valid token", token: "valid", want: http.StatusOK},
+		{name: "default failure status", token: "invalid", want: http.StatusForbidden},
+		{name: "missing token", token: "", want: http.StatusForbidden},
+		{name: "configured failure status", opts: []CaptchaOption{WithFailureStatus(http.StatusTooManyRequests)}, token: "invalid", want: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captcha := NewCaptcha(stubCaptchaProvider{valid: "valid"}, "h-captcha-response", 0, tt.opts...)
+			handler := negroni.New(captcha)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+			req.Header.Set("h-captcha-response", tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// stubScoredProvider scores valid tokens with score and fails every other.
+type stubScoredProvider struct {
+	stubCaptchaProvider
+	score float64
+}
+
+func (p stubScoredProvider) Score(token, remoteIP string) (float64, bool, error) {
+	if token != p.valid {
+		return 0, false, nil
+	}
+	return p.score, true, nil
+}
+
+func TestCaptchaMinScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		minScore float64
+		token    string
+		want     int
+	}{
+		{name: "score above minimum", minScore: 0.5, token: "valid", want: http.StatusOK},
+		{name: "score below minimum", minScore: 0.95, token: "valid", want: http.StatusForbidden},
+		{name: "zero minimum", minScore: 0, token: "valid", want: http.StatusOK},
+		{name: "invalid token with zero minimum", minScore: 0, token: "invalid", want: http.StatusForbidden},
+		{name: "missing token with zero minimum", minScore: 0, token: "", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := stubScoredProvider{stubCaptchaProvider: stubCaptchaProvider{valid: "valid"}, score: 0.9}
+			handler := negroni.New(NewCaptcha(provider, "g-recaptcha-response", tt.minScore))
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+			req.Header.Set("g-recaptcha-response", tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptchaRemoteIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientIP   *ClientIPResolver
+		remoteAddr string
+		want       string
+	}{
+		{name: "no resolver", remoteAddr: "10.0.0.1:5678", want: ""},
+		{name: "forwarded client", clientIP: NewClientIPResolver(1, false, nil), remoteAddr: "10.0.0.1:5678", want: "203.0.113.7"},
+		{name: "undetermined client", clientIP: NewClientIPResolver(0, false, nil), remoteAddr: "unknown", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var remoteIP string
+			captcha := NewCaptcha(stubCaptchaProvider{valid: "valid", remoteIP: &remoteIP}, "h-captcha-response", 0, WithCaptchaClientIP(tt.clientIP))
+			handler := negroni.New(captcha)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("h-captcha-response", "valid")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if remoteIP != tt.want {
+				t.Errorf("provider got remote IP %q, want %q", remoteIP, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptchaFailOpen(t *testing.T) {
+	unavailable := fmt.Errorf("%w: 502 Bad Gateway", ErrCaptchaUnavailable)
+	tests := []struct {
+		name     string
+		failOpen bool
+		err      error
+		token    string
+		want     int
+		wantCode string
+	}{
+		{name: "fail closed", err: unavailable, token: "valid", want: http.StatusForbidden, wantCode: codeCaptchaUnavailable},
+		{name: "fail open", failOpen: true, err: unavailable, token: "valid", want: http.StatusOK},
+		{name: "fail open rejects invalid token", failOpen: true, token: "invalid", want: http.StatusForbidden, wantCode: codeCaptchaFailed},
+		{name: "fail open rejects other errors", failOpen: true, err: errors.New("unexpected"), token: "valid", want: http.StatusForbidden, wantCode: codeCaptchaFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captcha := NewCaptcha(stubCaptchaProvider{valid: "valid", err: tt.err}, "h-captcha-response", 0, WithFailOpen(tt.failOpen))
+			handler := negroni.New(captcha)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+			req.Header.Set("h-captcha-response", tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			var resp claimResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSiteVerify(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		wantSuccess     bool
+		wantUnavailable bool
+	}{
+		{name: "verified", status: http.StatusOK, body: `{"success":true}`, wantSuccess: true},
+		{name: "rejected token", status: http.StatusOK, body: `{"success":false,"error-codes":["invalid-input-response"]}`},
+		{name: "server error", status: http.StatusServiceUnavailable, body: "unavailable", wantUnavailable: true},
+		{name: "undecodable answer", status: http.StatusOK, body: "<html>", wantUnavailable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			var result hcaptchaResponse
+			err := siteVerify(server.Client(), server.URL, url.Values{"response": {"token"}}, &result)
+			if errors.Is(err, ErrCaptchaUnavailable) != tt.wantUnavailable {
+				t.Fatalf("siteVerify() error = %v, want unavailable %v", err, tt.wantUnavailable)
+			}
+			if err == nil && result.Success != tt.wantSuccess {
+				t.Errorf("success = %v, want %v", result.Success, tt.wantSuccess)
+			}
+		})
+	}
+}
+
+func TestCaptchaBypassToken(t *testing.T) {
+	const bypass = "integration-test-token"
+	tests := []struct {
+		name  string
+		opts  []CaptchaOption
+		token string
+		want  int
+	}{
+		{name: "bypass token", opts: []CaptchaOption{WithBypassToken(bypass)}, token: bypass, want: http.StatusOK},
+		{name: "other tokens verified", opts: []CaptchaOption{WithBypassToken(bypass)}, token: "valid", want: http.StatusOK},
+		{name: "invalid token rejected", opts: []CaptchaOption{WithBypassToken(bypass)}, token: "invalid", want: http.StatusForbidden},
+		{name: "missing token rejected", opts: []CaptchaOption{WithBypassToken(bypass)}, token: "", want: http.StatusForbidden},
+		{name: "not enabled", token: bypass, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captcha := NewCaptcha(stubCaptchaProvider{valid: "valid"}, "h-captcha-response", 0, tt.opts...)
+			handler := negroni.New(captcha)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+			req.Header.Set("h-captcha-response", tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+type blockingCaptchaProvider struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (p blockingCaptchaProvider) Verify(token, remoteIP string) (bool, error) {
+	p.started <- struct{}{}
+	<-p.unblock
+	return true, nil
+}
+
+func TestCaptchaMaxInFlight(t *testing.T) {
+	provider := blockingCaptchaProvider{started: make(chan struct{}), unblock: make(chan struct{})}
+	captcha := NewCaptcha(provider, "h-captcha-response", 0, WithMaxInFlight(1))
+	handler := negroni.New(captcha)
+	handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	claim := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+		req.Header.Set("h-captcha-response", "token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	first := make(chan int)
+	go func() { first <- claim().Code }()
+	<-provider.started
+	w := claim()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status over the limit = %d, want 503", w.Code)
+	}
+	var resp claimResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Code != codeCaptchaUnavailable {
+		t.Errorf("code = %q, want %q", resp.Code, codeCaptchaUnavailable)
+	}
+	close(provider.unblock)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("verified claim status = %d, want 200", code)
+	}
+
+	// The slot is released once the verification is done
+	go func() { <-provider.started }()
+	if w := claim(); w.Code != http.StatusOK {
+		t.Errorf("status after the verification finished = %d, want 200", w.Code)
+	}
+}
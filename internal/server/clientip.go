@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPResolver derives the client IP of requests arriving through reverse proxies.
+// One resolver is shared by every middleware keying on the client, so they cannot disagree on who it is.
+type ClientIPResolver struct {
+	proxyCount int
+	realIP     bool
+	trusted    *AccessList
+}
+
+// NewClientIPResolver reads the client from the X-Forwarded-For entry added by the outermost of
+// proxyCount proxies, or the first entry outside trusted when it is set. realIP trusts the
+// X-Real-IP header set by the reverse proxy.
+func NewClientIPResolver(proxyCount int, realIP bool, trusted *AccessList) *ClientIPResolver {
+	return &ClientIPResolver{
+		proxyCount: proxyCount,
+		realIP:     realIP,
+		trusted:    trusted,
+	}
+}
+
+// ClientIP returns the IP of the client, a nil resolver uses the connection's remote address.
+func (c *ClientIPResolver) ClientIP(r *http.Request) string {
+	if c == nil {
+		return getClientIPFromRequest(0, false, nil, r)
+	}
+	return getClientIPFromRequest(c.proxyCount, c.realIP, c.trusted, r)
+}
+
+// getClientIPFromRequest prefers X-Real-IP when realIP is enabled. Otherwise, with trusted proxies configured,
+// it walks X-Forwarded-For from the right and returns the first entry outside the trusted ranges, or else takes
+// the entry added by the outermost of proxyCount proxies. It falls back to RemoteAddr when no valid IP is found.
+func getClientIPFromRequest(proxyCount int, realIP bool, trusted *AccessList, r *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	if realIP {
+		if xRealIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xRealIP) != nil {
+			return xRealIP
+		}
+	}
+
+	xForwardedFor := r.Header.Get("X-Forwarded-For")
+	if trusted != nil {
+		// Entries left of an untrusted hop may be forged by the client, so never look past it
+		if !trusted.ContainsIP(remoteIP) || xForwardedFor == "" {
+			return remoteIP
+		}
+		xForwardedForParts := strings.Split(xForwardedFor, ",")
+		for i := len(xForwardedForParts) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(xForwardedForParts[i])
+			if net.ParseIP(hop) == nil {
+				return remoteIP
+			}
+			if !trusted.ContainsIP(hop) {
+				return hop
+			}
+		}
+		return remoteIP
+	}
+
+	if proxyCount > 0 && xForwardedFor != "" {
+		xForwardedForParts := strings.Split(xForwardedFor, ",")
+		// Avoid reading the user's forged request header by configuring the count of reverse proxies
+		partIndex := len(xForwardedForParts) - proxyCount
+		if partIndex < 0 {
+			partIndex = 0
+		}
+		if clientIP := strings.TrimSpace(xForwardedForParts[partIndex]); net.ParseIP(clientIP) != nil {
+			return clientIP
+		}
+	}
+
+	return remoteIP
+}
@@ -1,25 +1,253 @@
 package server
 
-type Config struct {
-	network         string
-	symbol          string
-	httpPort        int
-	interval        int
-	payout          float64
-	proxyCount      int
-	hcaptchaSiteKey string
-	hcaptchaSecret  string
+import (
+	"time"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// DefaultRPCTimeout bounds chain calls unless Config.RPCTimeout is set.
+const DefaultRPCTimeout = 5 * time.Second
+
+// Handling of claims to addresses with deployed code, see Config.ContractRecipients.
+const (
+	ContractsAllow  = "allow"
+	ContractsWarn   = "warn"
+	ContractsReject = "reject"
+)
+
+// Rate limit keying of claims, see Config.LimitKey.
+const (
+	LimitKeyEither = "either"
+	LimitKeyPair   = "pair"
+)
+
+// Handling of claims while the rate limit store fails, see Config.StoreFailure.
+const (
+	StoreFailOpen   = "open"
+	StoreFailClosed = "closed"
+)
+
+// ChainConfig holds the settings that differ between the chains served by one process.
+type ChainConfig struct {
+	// Name is the path segment the chain is served under, as in /api/{name}/claim
+	Name    string
+	Network string
+	Symbol  string
+	Payout  float64
+	// PayoutMax above Payout pays claims a random amount between the two, see Faucet.drawPayout
+	PayoutMax float64
+
+	// Tokens adds an ERC-20 transfer to every claim, which counts as one claim
+	// and answers with the hashes of all its transactions
+	Tokens []TokenPayout
+
+	// ShortName is the EIP-3770 prefix claimed addresses may carry, as in gno:0x...
+	ShortName string
+
+	// AddressFormat parses the recipient addresses of chains that do not write them in hex,
+	// nil accepts hex addresses only
+	AddressFormat chain.AddressFormat
+
+	// WrappedNative optionally pays the native payout as the WETH style token at this address,
+	// by depositing the amount and transferring the wrapped tokens
+	WrappedNative string
+
+	// BatchContract optionally sends the native payouts of concurrent claims in one
+	// disperseEther call of this Disperse style contract
+	BatchContract string
+}
+
+// TokenPayout is the Amount of an ERC-20 token sent with every claim. A token with a Cooldown
+// is sent to an address at most once per Cooldown and left out of its claims in between.
+type TokenPayout struct {
+	Address  string
+	Amount   float64
+	Decimals int
+	Cooldown time.Duration
 }
 
-func NewConfig(network, symbol string, httpPort, interval int, payout float64, proxyCount int, hcaptchaSiteKey, hcaptchaSecret string) *Config {
-	return &Config{
-		network:         network,
-		symbol:          symbol,
-		httpPort:        httpPort,
-		interval:        interval,
-		payout:          payout,
-		proxyCount:      proxyCount,
-		hcaptchaSiteKey: hcaptchaSiteKey,
-		hcaptchaSecret:  hcaptchaSecret,
-	}
+// Config holds the settings shared by all chains.
+type Config struct {
+	HTTPPort   int
+	Interval   int
+	IPInterval int
+	// IPBuckets is the number of claims allowed per IP within IPInterval
+	IPBuckets int
+	// NewAddressInterval and NewAddressPayout replace Interval and the payout of claims to
+	// addresses that never sent a transaction and hold no balance, 0 keeps them
+	NewAddressInterval int
+	NewAddressPayout   float64
+	// IPv6Prefix is the prefix length IPv6 clients are limited by
+	IPv6Prefix int
+	// ReadLimit is the number of info, status, job and claims requests a client network may make
+	// per ReadWindow, 0 leaves them unlimited
+	ReadLimit  int
+	ReadWindow time.Duration
+	// SlidingWindow restarts a cooldown on every claim it rejects, see WithSlidingWindow
+	SlidingWindow bool
+	// TokenBucket limits claims by token buckets of AddressBurst and IPBurst claims that refill at
+	// the average rate of the windows, instead of fixed windows, see WithTokenBucket
+	TokenBucket  bool
+	AddressBurst int
+	IPBurst      int
+	// WaitRounding is the granularity rate limit waits are shown to users in, a second when 0
+	WaitRounding time.Duration
+	// LimitKey is LimitKeyEither to limit addresses and IPs separately, or LimitKeyPair to
+	// limit each address per IP, see KeyAddressOrIP and KeyAddressAndIP
+	LimitKey string
+	// StoreFailure is StoreFailOpen to let claims through unlimited while the rate limit store
+	// fails, or StoreFailClosed to reject them, see WithStoreFailure
+	StoreFailure string
+	// SharedCooldowns lets a claim on one chain count against the cooldowns of all chains,
+	// instead of limiting every chain on its own
+	SharedCooldowns bool
+	// ClaimPath optionally serves the claims of the primary chain at this path besides /api/claim
+	ClaimPath string
+	// JSONRPC serves faucet_claim and faucet_info as JSON-RPC 2.0 methods at /api/rpc
+	JSONRPC bool
+	// Messages optionally replaces the English claim responses by templates per language
+	Messages Messages
+	// MinPayout and MaxPayout bound the amount a claim may request, MaxPayout defaults to the chain's Payout
+	MinPayout  float64
+	MaxPayout  float64
+	ProxyCount int
+	// RealIP reads the client IP from X-Real-IP, taking precedence over X-Forwarded-For
+	RealIP bool
+	// TrustedProxies lists proxy IPs and CIDR ranges skipped in X-Forwarded-For, replacing ProxyCount
+	TrustedProxies []string
+	// TLSCertFile and TLSKeyFile serve HTTPS and HTTP/2 on HTTPPort without a reverse proxy.
+	// TLSDomain obtains the certificate of that domain from Let's Encrypt instead, cached in
+	// TLSCacheDir. Clients then connect directly, so the proxy settings above must not be set,
+	// forwarding headers could only come from the client
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSDomain   string
+	TLSCacheDir string
+	// GeoIPDatabase optionally looks up the country of claiming clients in a MaxMind database.
+	// GeoIPMode GeoAllow funds only clients in GeoIPCountries, GeoBlock rejects them
+	GeoIPDatabase  string
+	GeoIPMode      string
+	GeoIPCountries []string
+	// CORSOrigins may call the API from other domains, with CORSMethods and CORSHeaders allowed in
+	// preflight requests. CORSHeaders defaults to Content-Type and the captcha header
+	CORSOrigins []string
+	CORSMethods []string
+	CORSHeaders []string
+	// DailyBudget caps the Ethers each chain dispenses per 24 hours, 0 disables the cap
+	DailyBudget float64
+	// MaxRecipientBalance rejects claims to addresses already holding more Ethers, 0 disables the check
+	MaxRecipientBalance float64
+	// MinRecipientNonce only funds addresses that sent at least this many transactions
+	// or hold a balance, 0 disables the check
+	MinRecipientNonce uint64
+	// Allowlist holds addresses, IPs and CIDR ranges exempt from rate limiting
+	Allowlist []string
+	// Denylist holds addresses, IPs and CIDR ranges that are never funded
+	Denylist []string
+	// AllowlistFile and DenylistFile add entries from files that are reloaded
+	// on SIGHUP, and every AccessListInterval when it is positive
+	AllowlistFile      string
+	DenylistFile       string
+	AccessListInterval time.Duration
+	// RedisURL switches the rate limit store from process memory to Redis
+	RedisURL string
+	// StateFile keeps the in memory rate limits across restarts, saved every StateInterval and on shutdown
+	StateFile     string
+	StateInterval time.Duration
+	// TotalsFile keeps the lifetime totals of /api/info and /metrics across restarts when
+	// RedisURL is not set, which keeps them in Redis
+	TotalsFile string
+	// ContractRecipients is one of ContractsAllow, ContractsWarn or ContractsReject
+	ContractRecipients string
+	// BlockedAddresses are never funded in addition to the zero and dead addresses
+	BlockedAddresses []string
+	// AddressFields names the claim JSON fields the address is read from, the first present wins.
+	// Claims without any of them may pass the address as a query parameter of the same names.
+	AddressFields []string
+	// MaxBodySize is the largest claim body accepted in bytes, DefaultMaxBodySize when 0
+	MaxBodySize int64
+	// RequireSignature only funds claims signed by the claimed address over a nonce
+	// issued by /api/nonce, which expires after NonceTTL
+	RequireSignature bool
+	NonceTTL         time.Duration
+	// StrictChecksum rejects addresses that are not EIP-55 checksummed instead of normalizing them
+	StrictChecksum bool
+	// ENSRegistry enables resolving ENS names in claims against the given registry contract
+	ENSRegistry string
+
+	// QueueWorkers transactions are sent concurrently from a queue holding up to QueueSize claims.
+	// AsyncClaims answers 202 with a job ID instead of waiting for the transaction.
+	QueueWorkers int
+	QueueSize    int
+	AsyncClaims  bool
+	// BatchWindow and BatchSize bound how long and how many claims are collected into
+	// one transaction on chains with a BatchContract, DefaultBatchWindow and DefaultBatchSize when 0
+	BatchWindow time.Duration
+	BatchSize   int
+	// HistorySize enables /api/claims, listing the latest funded claims with shortened
+	// addresses, or hashed ones in HistoryPrivacy mode. 0 disables the endpoint
+	HistorySize    int
+	HistoryPrivacy bool
+	// ShutdownTimeout bounds how long shutdown waits for pending claims
+	ShutdownTimeout time.Duration
+
+	// MaxGasPrice rejects claims while the max fee per gas is above this many gwei, 0 disables the cap
+	MaxGasPrice float64
+	// RPCTimeout bounds every chain call made for a claim, DefaultRPCTimeout when 0
+	RPCTimeout time.Duration
+
+	// WaitReceipt only reports success once the transactions are mined successfully,
+	// reverted claims are rolled back in the limiter
+	WaitReceipt    bool
+	ReceiptTimeout time.Duration
+	// Confirmations waits for that many blocks on top of the receipt's block within the receipt
+	// timeout, resending transactions dropped by a reorg. It implies WaitReceipt
+	Confirmations uint64
+	// DryRun reports claims as funded without broadcasting, the chain senders must be built
+	// with chain.WithDryRun. Low balances are logged instead of rejecting claims
+	DryRun bool
+	// LogPrivacy logs the HMAC of addresses and client IPs under LogPrivacyKey instead of the
+	// raw values, a random key is used when empty
+	LogPrivacy    bool
+	LogPrivacyKey string
+
+	// DiscordToken enables the /faucet slash command for the primary chain,
+	// registered in DiscordGuildID only when set
+	DiscordToken   string
+	DiscordGuildID string
+	// TelegramToken enables the /faucet bot command for the primary chain
+	TelegramToken string
+
+	// WebhookURL receives a JSON post for each of WebhookEvents, see EventClaim and EventLowBalance.
+	// LowBalance is the wallet balance in Ethers below which low balance events are sent,
+	// they are sent whenever a claim cannot be funded otherwise
+	WebhookURL    string
+	WebhookEvents []string
+	LowBalance    float64
+
+	// APIKeys authenticate trusted clients, whose claims skip the captcha and are limited
+	// per address every APIKeyInterval minutes instead, 0 disables their limit
+	APIKeys        []string
+	APIKeyInterval int
+
+	// CaptchaProvider selects the verification backend, one of "hcaptcha", "turnstile" or "recaptcha"
+	CaptchaProvider string
+	CaptchaSiteKey  string
+	CaptchaSecret   string
+	// CaptchaMinScore and CaptchaAction only apply to score based providers like reCAPTCHA v3
+	CaptchaMinScore float64
+	CaptchaAction   string
+	// CaptchaHeader overrides the request header the token is read from
+	CaptchaHeader string
+	// CaptchaStatus answers failed verifications, DefaultCaptchaFailureStatus when 0
+	CaptchaStatus int
+	// CaptchaFailOpen accepts claims unverified while the provider is unavailable
+	CaptchaFailOpen bool
+	// CaptchaBypassToken is accepted as a valid captcha token, for integration tests only
+	CaptchaBypassToken string
+	// CaptchaTimeout bounds every verification call, DefaultCaptchaTimeout when 0. At most
+	// CaptchaMaxInFlight verifications run at once, 0 leaves them unbounded
+	CaptchaTimeout     time.Duration
+	CaptchaMaxInFlight int
 }
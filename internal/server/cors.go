@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CORS answers cross-origin requests from the allowed origins, and rejects those from any other.
+// Same-origin requests always pass, so with no origins configured only the bundled frontend may claim.
+type CORS struct {
+	origins map[string]bool
+	any     bool
+	methods string
+	headers string
+}
+
+// NewCORS creates the CORS middleware, an origin of "*" allows every origin.
+func NewCORS(origins, methods, headers []string) *CORS {
+	c := &CORS{
+		origins: make(map[string]bool, len(origins)),
+		methods: strings.Join(methods, ", "),
+		headers: strings.Join(headers, ", "),
+	}
+	for _, origin := range origins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "*" {
+			c.any = true
+		}
+		c.origins[strings.ToLower(origin)] = true
+	}
+	return c
+}
+
+func (c *CORS) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameOrigin(origin, r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if !c.any && !c.origins[strings.ToLower(origin)] {
+		renderFailure(w, r, codeOriginNotAllowed, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	// The allowed origin is echoed rather than "*", so responses must not be cached across origins
+	w.Header().Add("Vary", "Origin")
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", c.methods)
+		w.Header().Set("Access-Control-Allow-Headers", c.headers)
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// Lets cross-origin clients read when a rate limited claim may be retried
+	w.Header().Set("Access-Control-Expose-Headers", "Retry-After, "+RequestIDHeader)
+	next.ServeHTTP(w, r)
+}
+
+func sameOrigin(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
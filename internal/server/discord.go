@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+const discordCommand = "faucet"
+
+// DiscordBot funds addresses submitted through the /faucet slash command,
+// limiting each Discord user to one claim per faucet interval.
+type DiscordBot struct {
+	session *discordgo.Session
+	faucet  *Faucet
+	guildID string
+}
+
+// NewDiscordBot creates the bot, the command is registered globally unless guildID is set.
+func NewDiscordBot(token, guildID string, faucet *Faucet) (*DiscordBot, error) {
+	session, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return nil, err
+	}
+	session.Identify.Intents = discordgo.IntentsGuilds
+
+	bot := &DiscordBot{
+		session: session,
+		faucet:  faucet,
+		guildID: guildID,
+	}
+	session.AddHandler(bot.handleInteraction)
+	return bot, nil
+}
+
+// Open connects to the gateway and registers the slash command.
+func (b *DiscordBot) Open() error {
+	if err := b.session.Open(); err != nil {
+		return err
+	}
+	_, err := b.session.ApplicationCommandCreate(b.session.State.User.ID, b.guildID, &discordgo.ApplicationCommand{
+		Name:        discordCommand,
+		Description: fmt.Sprintf("Request %s %s", formatAmount(b.faucet.chainCfg.Payout), b.faucet.chainCfg.Symbol),
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "address",
+				Description: "Address to fund",
+				Required:    true,
+			},
+		},
+	})
+	if err != nil {
+		b.session.Close()
+		return err
+	}
+	return nil
+}
+
+func (b *DiscordBot) Close() error {
+	return b.session.Close()
+}
+
+func (b *DiscordBot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand || i.ApplicationCommandData().Name != discordCommand {
+		return
+	}
+
+	var userID string
+	if i.Member != nil && i.Member.User != nil {
+		userID = i.Member.User.ID
+	} else if i.User != nil {
+		userID = i.User.ID
+	}
+	options := i.ApplicationCommandData().Options
+	if userID == "" || len(options) == 0 {
+		return
+	}
+
+	// Sending takes longer than the three seconds Discord waits for a reply
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	}); err != nil {
+		log.WithError(err).Warn("Failed to acknowledge Discord command")
+		return
+	}
+
+	result, err := b.faucet.claimFor(context.Background(), "discord:"+userID, strings.TrimSpace(options[0].StringValue()))
+	if err != nil {
+		b.edit(i, botErrorMessage(err))
+		return
+	}
+	b.edit(i, fmt.Sprintf("Sent %s %s, txhash: %s", formatAmount(b.faucet.chainCfg.Payout), b.faucet.chainCfg.Symbol, strings.Join(result.txHashes, ", "))+botCoolingDown(result))
+}
+
+func (b *DiscordBot) edit(i *discordgo.InteractionCreate, content string) {
+	if _, err := b.session.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+		log.WithError(err).Warn("Failed to reply to Discord command")
+	}
+}
@@ -2,47 +2,224 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/chainflag/eth-faucet/internal/chain"
 )
 
+type contextKey int
+
+const (
+	claimContextKey contextKey = iota
+	apiKeyContextKey
+	messagesContextKey
+	requestIDContextKey
+)
+
+// NameResolver resolves a human readable name such as an ENS name into an address.
+type NameResolver func(ctx context.Context, name string) (common.Address, error)
+
+// claimRequest is the decoded claim, its address may be submitted under any of Config.AddressFields.
 type claimRequest struct {
-	Address string `json:"address"`
+	Address string
+	Amount  *float64
+	// Nonce and Signature prove ownership of the address, see OwnershipProof
+	Nonce     string
+	Signature string
+	// Tag is an optional note of the claimant, such as a username, kept for reconciliation
+	Tag string
+	// newAddress is set for addresses that never transacted, see Faucet.checkNewAddress
+	newAddress bool
+	// outcome is set by handlers that wait for the claim, the limiter settles by it rather than the response status
+	outcome claimOutcome
 }
 
+type claimOutcome int
+
+const (
+	outcomeUnknown claimOutcome = iota
+	outcomeSent
+	outcomeNotSent
+)
+
+// maxTagLength is the maximum number of characters of a claim tag.
+const maxTagLength = 64
+
 type claimResponse struct {
-	Message string `json:"msg"`
+	Message       string `json:"msg"`
+	Amount        string `json:"amount,omitempty"`
+	TxHash        string `json:"tx_hash,omitempty"`
+	JobID         string `json:"job_id,omitempty"`
+	Code          string `json:"code,omitempty"`
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	// Tokens lists the bundle tokens sent with the claim, CoolingDown those left out
+	Tokens      []string        `json:"tokens,omitempty"`
+	CoolingDown []tokenCooldown `json:"cooling_down,omitempty"`
+}
+
+// tokenCooldown is a bundle token left out of a claim until its cooldown for the address ends.
+type tokenCooldown struct {
+	Address     string  `json:"address"`
+	WaitSeconds float64 `json:"wait_seconds"`
+	wait        time.Duration
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type jobResponse struct {
+	ID            string   `json:"id"`
+	Status        string   `json:"status"`
+	TxHashes      []string `json:"tx_hashes,omitempty"`
+	Message       string   `json:"msg,omitempty"`
+	Code          string   `json:"code,omitempty"`
+	Confirmations uint64   `json:"confirmations,omitempty"`
+	// Tokens and CoolingDown are those of claimResponse
+	Tokens      []string        `json:"tokens,omitempty"`
+	CoolingDown []tokenCooldown `json:"cooling_down,omitempty"`
 }
 
 type infoResponse struct {
-	Account         string `json:"account"`
-	Network         string `json:"network"`
-	Payout          string `json:"payout"`
-	Interval        int    `json:"interval"`
-	Symbol          string `json:"symbol"`
-	HcaptchaSiteKey string `json:"hcaptcha_sitekey,omitempty"`
+	Account           string      `json:"account"`
+	Network           string      `json:"network"`
+	ChainID           string      `json:"chain_id"`
+	Payout            string      `json:"payout"`
+	PayoutWei         string      `json:"payout_wei"`
+	Balance           string      `json:"balance,omitempty"`
+	BalanceWei        string      `json:"balance_wei,omitempty"`
+	BudgetRemaining   string      `json:"budget_remaining,omitempty"`
+	GasPrice          string      `json:"gas_price,omitempty"`
+	MaxGasPrice       string      `json:"max_gas_price,omitempty"`
+	Interval          int         `json:"interval"`
+	Symbol            string      `json:"symbol"`
+	Token             string      `json:"token,omitempty"`
+	TokenPayout       string      `json:"token_payout,omitempty"`
+	Tokens            []tokenInfo `json:"tokens,omitempty"`
+	CaptchaProvider   string      `json:"captcha_provider,omitempty"`
+	CaptchaSiteKey    string      `json:"captcha_sitekey,omitempty"`
+	CaptchaAction     string      `json:"captcha_action,omitempty"`
+	SignatureRequired bool        `json:"signature_required,omitempty"`
+	DryRun            bool        `json:"dry_run,omitempty"`
+	Confirmations     uint64      `json:"confirmations,omitempty"`
+	Totals            *totalsInfo `json:"totals,omitempty"`
+}
+
+// totalsInfo is the lifetime totals of a faucet, token amounts are in base units keyed by token address
+type totalsInfo struct {
+	Claims       string            `json:"claims"`
+	DispensedWei string            `json:"dispensed_wei"`
+	Tokens       map[string]string `json:"tokens,omitempty"`
+}
+
+type claimRecord struct {
+	Address   string    `json:"address"`
+	Amount    string    `json:"amount"`
+	Tag       string    `json:"tag,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	TxHashes  []string  `json:"tx_hashes"`
+}
+
+type claimsResponse struct {
+	Claims []claimRecord `json:"claims"`
+}
+
+type tokenInfo struct {
+	Address string `json:"address"`
+	Payout  string `json:"payout"`
+	// Cooldown is the number of minutes between two payouts of the token to an address,
+	// when it has a cooldown of its own
+	Cooldown int `json:"cooldown,omitempty"`
+}
+
+type nonceResponse struct {
+	Nonce     string  `json:"nonce"`
+	Message   string  `json:"message"`
+	ExpiresIn float64 `json:"expires_in"`
+}
+
+type statusResponse struct {
+	Eligible    bool    `json:"eligible"`
+	WaitSeconds float64 `json:"wait_seconds"`
 }
 
 type malformedRequest struct {
 	status  int
+	code    string
 	message string
+	// id and args pick a more specific response template than the code, see Messages
+	id   string
+	args map[string]string
 }
 
+// Error codes let clients tell failed requests apart without matching messages, successful
+// claims carry none. The README lists them.
+const (
+	codeInvalidRequest     = "INVALID_REQUEST"
+	codeInvalidAddress     = "INVALID_ADDRESS"
+	codeInvalidAmount      = "INVALID_AMOUNT"
+	codeRecipientRejected  = "RECIPIENT_REJECTED"
+	codeDenied             = "DENIED"
+	codeCountryBlocked     = "COUNTRY_BLOCKED"
+	codeRateLimited        = "RATE_LIMITED"
+	codeLimitUnavailable   = "RATE_LIMIT_UNAVAILABLE"
+	codeCaptchaFailed      = "CAPTCHA_FAILED"
+	codeCaptchaUnavailable = "CAPTCHA_UNAVAILABLE"
+	codeSignatureRequired  = "SIGNATURE_REQUIRED"
+	codeInvalidSignature   = "INVALID_SIGNATURE"
+	codeInvalidAPIKey      = "INVALID_API_KEY"
+	codeOriginNotAllowed   = "ORIGIN_NOT_ALLOWED"
+	codeMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	codeOutOfFunds         = "OUT_OF_FUNDS"
+	codeBudgetExhausted    = "BUDGET_EXHAUSTED"
+	codeGasPriceTooHigh    = "GAS_PRICE_TOO_HIGH"
+	codeBusy               = "FAUCET_BUSY"
+	codeNodeTimeout        = "NODE_TIMEOUT"
+	codeNodeUnavailable    = "NODE_UNAVAILABLE"
+	codeTxFailed           = "TX_FAILED"
+	codeNotFound           = "NOT_FOUND"
+	codeInternal           = "INTERNAL_ERROR"
+)
+
 func (mr *malformedRequest) Error() string {
 	return mr.message
 }
 
-func decodeJSONBody(r *http.Request, dst interface{}) error {
-	body, err := io.ReadAll(io.LimitReader(r.Body, 1024))
+var errOutOfFunds = &malformedRequest{status: http.StatusServiceUnavailable, code: codeOutOfFunds, message: "Faucet temporarily out of funds"}
+
+var errBusy = &malformedRequest{status: http.StatusServiceUnavailable, code: codeBusy, message: "Faucet is busy, please try again later"}
+
+var errLimitUnavailable = &malformedRequest{status: http.StatusServiceUnavailable, code: codeLimitUnavailable, message: "Rate limits cannot be checked right now, please try again later"}
+
+var errGasLimitExceeded = &malformedRequest{status: http.StatusBadRequest, code: codeRecipientRejected, message: "Funding this address would use too much gas, please use an account address"}
+
+var errEmptyBody = &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: "Request body must not be empty"}
+
+// decodeJSONBody rejects bodies larger than maxBytes, and fields dst does not declare.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) error {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
 	defer r.Body.Close()
 	if err != nil {
-		return &malformedRequest{status: http.StatusBadRequest, message: "Unable to read request body"}
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			msg := fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesError.Limit)
+			return &malformedRequest{status: http.StatusRequestEntityTooLarge, code: codeInvalidRequest, message: msg}
+		}
+		return &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: "Unable to read request body"}
 	}
 
 	dec := json.NewDecoder(bytes.NewReader(body))
@@ -55,23 +232,19 @@ func decodeJSONBody(r *http.Request, dst interface{}) error {
 		switch {
 		case errors.As(err, &syntaxError):
 			msg := fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: msg}
 		case errors.Is(err, io.ErrUnexpectedEOF):
 			msg := "Request body contains badly-formed JSON"
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: msg}
 		case errors.As(err, &unmarshalTypeError):
 			msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: msg}
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
+			return &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: msg}
 		case errors.Is(err, io.EOF):
-			msg := "Request body must not be empty"
-			return &malformedRequest{status: http.StatusBadRequest, message: msg}
-		case err.Error() == "http: request body too large":
-			msg := "Request body must not be larger than 1MB"
-			return &malformedRequest{status: http.StatusRequestEntityTooLarge, message: msg}
+			return errEmptyBody
 		default:
 			return err
 		}
@@ -81,16 +254,336 @@ func decodeJSONBody(r *http.Request, dst interface{}) error {
 	return nil
 }
 
-func readAddress(r *http.Request) (string, error) {
+// readClaim takes the address from the first of the configured fields present in the JSON body,
+// falling back to a query parameter of the same names, in which case the body may be empty.
+func (c *ClaimReader) readClaim(w http.ResponseWriter, r *http.Request) (*claimRequest, error) {
+	var fields map[string]json.RawMessage
+	if err := decodeJSONBody(w, r, &fields, c.maxBodySize); err != nil && (err != errEmptyBody || c.queryAddress(r) == "") {
+		return nil, err
+	}
+
+	for key := range fields {
+		if key != "amount" && key != "nonce" && key != "signature" && key != "tag" && !c.isAddressField(key) {
+			msg := fmt.Sprintf("Request body contains unknown field %q", key)
+			return nil, &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: msg}
+		}
+	}
+
 	var claimReq claimRequest
-	if err := decodeJSONBody(r, &claimReq); err != nil {
-		return "", err
+	if value, ok := fields["amount"]; ok {
+		if err := json.Unmarshal(value, &claimReq.Amount); err != nil {
+			return nil, &malformedRequest{status: http.StatusBadRequest, code: codeInvalidAmount, message: `Request body contains an invalid value for the "amount" field`}
+		}
+	}
+	for field, dst := range map[string]*string{"nonce": &claimReq.Nonce, "signature": &claimReq.Signature, "tag": &claimReq.Tag} {
+		if value, ok := fields[field]; ok {
+			if err := json.Unmarshal(value, dst); err != nil {
+				msg := fmt.Sprintf("Request body contains an invalid value for the %q field", field)
+				return nil, &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: msg}
+			}
+		}
+	}
+	for _, field := range c.addressFields {
+		if value, ok := fields[field]; ok {
+			if err := json.Unmarshal(value, &claimReq.Address); err != nil {
+				msg := fmt.Sprintf("Request body contains an invalid value for the %q field", field)
+				return nil, &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: msg}
+			}
+			break
+		}
+	}
+	if claimReq.Address == "" {
+		claimReq.Address = c.queryAddress(r)
+	}
+
+	address, err := c.readAddress(r.Context(), claimReq.Address)
+	if err != nil {
+		return nil, err
+	}
+	claimReq.Address = address
+
+	tag, err := readTag(claimReq.Tag)
+	if err != nil {
+		return nil, err
+	}
+	claimReq.Tag = tag
+
+	if amount := claimReq.Amount; amount != nil && (*amount <= 0 || *amount < c.minAmount || *amount > c.maxAmount) {
+		msg := fmt.Sprintf("amount must be between %s and %s", formatAmount(c.minAmount), formatAmount(c.maxAmount))
+		return nil, &malformedRequest{status: http.StatusBadRequest, code: codeInvalidAmount, message: msg}
+	}
+
+	return &claimReq, nil
+}
+
+// readTag trims the tag and rejects tags too long or with characters that are not printable,
+// so they cannot forge log lines or break the output of the claims endpoint.
+func readTag(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if !utf8.ValidString(tag) || utf8.RuneCountInString(tag) > maxTagLength || strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		msg := fmt.Sprintf("tag must be at most %d printable characters", maxTagLength)
+		return "", &malformedRequest{status: http.StatusBadRequest, code: codeInvalidRequest, message: msg}
+	}
+	return tag, nil
+}
+
+func (c *ClaimReader) isAddressField(key string) bool {
+	for _, field := range c.addressFields {
+		if key == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ClaimReader) queryAddress(r *http.Request) string {
+	query := r.URL.Query()
+	for _, field := range c.addressFields {
+		if address := query.Get(field); address != "" {
+			return address
+		}
+	}
+	return ""
+}
+
+func (c *ClaimReader) readAddress(ctx context.Context, address string) (string, error) {
+	if chain.IsPaymentURI(address) {
+		recipient, chainID, err := chain.ParsePaymentURI(address)
+		if err != nil {
+			msg := fmt.Sprintf("Invalid payment request: %v", err)
+			return "", &malformedRequest{status: http.StatusBadRequest, code: codeInvalidAddress, message: msg}
+		}
+		if chainID != nil && c.chainID != nil && chainID.Cmp(c.chainID) != 0 {
+			msg := fmt.Sprintf("Payment request is for chain %s, this faucet pays on chain %s", chainID, c.chainID)
+			return "", &malformedRequest{status: http.StatusBadRequest, code: codeInvalidAddress, message: msg}
+		}
+		address = recipient
+	} else if shortName, hexAddress := chain.SplitChainPrefix(address); shortName != "" {
+		if c.shortName == "" || !strings.EqualFold(shortName, c.shortName) {
+			msg := fmt.Sprintf("Address is for chain %s, this faucet does not pay on it", shortName)
+			return "", &malformedRequest{status: http.StatusBadRequest, code: codeInvalidAddress, message: msg}
+		}
+		address = hexAddress
+	}
+	if c.resolve != nil && chain.IsENSName(address) {
+		resolved, err := c.resolve(ctx, address)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).WithField("name", address).Warn("Failed to resolve ENS name")
+			msg := fmt.Sprintf("Unable to resolve ENS name %s", address)
+			return "", &malformedRequest{status: http.StatusBadRequest, code: codeInvalidAddress, message: msg}
+		}
+		address = resolved.Hex()
+	}
+	account, err := c.format.ParseAddress(address)
+	if err != nil {
+		return "", &malformedRequest{status: http.StatusBadRequest, code: codeInvalidAddress, message: "invalid address"}
+	}
+
+	// Rate limit keys are the checksummed form, however the address was written
+	address = account.Hex()
+	if c.blocked.ContainsAddress(address) {
+		return "", &malformedRequest{status: http.StatusBadRequest, code: codeRecipientRejected, message: "Funds sent to this address would be lost, please use your own address"}
+	}
+	return address, nil
+}
+
+func withClaim(r *http.Request, claim *claimRequest) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimContextKey, claim))
+}
+
+// claimFromRequest returns the claim stored by the ClaimReader middleware.
+func claimFromRequest(r *http.Request) *claimRequest {
+	if claim, ok := r.Context().Value(claimContextKey).(*claimRequest); ok {
+		return claim
+	}
+	return &claimRequest{}
+}
+
+func addressFromRequest(r *http.Request) string {
+	return claimFromRequest(r).Address
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+// limitReason tells which of the limiter keys blocked a claim, so users on shared
+// networks can tell an address cooldown from the limit of their IP.
+type limitReason int
+
+const (
+	limitedAddress limitReason = iota
+	limitedNetwork
+	limitedUser
+)
+
+func rateLimitMessage(reason limitReason, wait time.Duration) string {
+	var cause string
+	switch reason {
+	case limitedNetwork:
+		cause = "Too many claims from your network"
+	case limitedUser:
+		cause = "You have already claimed recently"
+	default:
+		cause = "This address has already claimed recently"
+	}
+	return fmt.Sprintf("%s. Please wait %s before you try again", cause, formatDuration(wait))
+}
+
+// coolingDownMessage lists the tokens left out of a claim with their waits, as in
+// "Not sent, still cooling down: 0x... for 5 hours".
+func coolingDownMessage(cooling []tokenCooldown) string {
+	if len(cooling) == 0 {
+		return ""
+	}
+	tokens := make([]string, len(cooling))
+	for i, token := range cooling {
+		tokens[i] = fmt.Sprintf("%s for %s", token.Address, formatDuration(token.wait))
 	}
-	if !chain.IsValidAddress(claimReq.Address, true) {
-		return "", &malformedRequest{status: http.StatusBadRequest, message: "invalid address"}
+	return "Not sent, still cooling down: " + strings.Join(tokens, ", ")
+}
+
+// errRateLimited shows the wait rounded up to granularity, a cooldown of a day does not need to
+// be shown to the second.
+func errRateLimited(reason limitReason, wait, granularity time.Duration) *malformedRequest {
+	if granularity > 0 {
+		wait = (wait + granularity - 1) / granularity * granularity
+	}
+	id := msgRateLimitedAddress
+	switch reason {
+	case limitedNetwork:
+		id = msgRateLimitedNetwork
+	case limitedUser:
+		id = msgRateLimitedUser
 	}
+	return &malformedRequest{
+		status:  http.StatusTooManyRequests,
+		code:    codeRateLimited,
+		message: rateLimitMessage(reason, wait),
+		id:      id,
+		args:    map[string]string{"wait": formatDuration(wait)},
+	}
+}
+
+// renderRateLimited answers 429 with the wait in the message and, for clients and CDNs, as Retry-After.
+func renderRateLimited(w http.ResponseWriter, r *http.Request, reason limitReason, wait, granularity time.Duration) {
+	w.Header().Set("Retry-After", strconv.FormatInt(retrySeconds(wait), 10))
+	renderError(w, r, errRateLimited(reason, wait, granularity))
+}
+
+// retrySeconds rounds wait up to whole seconds, as formatDuration does.
+func retrySeconds(wait time.Duration) int64 {
+	return max(int64((wait+time.Second-1)/time.Second), 1)
+}
 
-	return claimReq.Address, nil
+// formatDuration renders the two largest units of d, rounded up to the smaller one so the wait
+// shown is never shorter than d, e.g. "2 hours 15 minutes".
+func formatDuration(d time.Duration) string {
+	seconds := retrySeconds(d)
+
+	units := []struct {
+		name    string
+		seconds int64
+	}{
+		{"day", 86400},
+		{"hour", 3600},
+		{"minute", 60},
+		{"second", 1},
+	}
+	for i, unit := range units {
+		if seconds >= unit.seconds {
+			if i+1 < len(units) {
+				step := units[i+1].seconds
+				seconds = (seconds + step - 1) / step * step
+			}
+			break
+		}
+	}
+	var parts []string
+	for _, unit := range units {
+		if len(parts) == 2 {
+			break
+		}
+		n := seconds / unit.seconds
+		seconds %= unit.seconds
+		if n == 0 {
+			// Skip leading zeros, and stop at an inner one so "1 day 0 hours" reads "1 day"
+			if len(parts) > 0 {
+				break
+			}
+			continue
+		}
+		part := fmt.Sprintf("%d %s", n, unit.name)
+		if n > 1 {
+			part += "s"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+var errNodeTimeout = &malformedRequest{status: http.StatusGatewayTimeout, code: codeNodeTimeout, message: "Blockchain node timed out, please try again later"}
+
+var errNodeUnavailable = &malformedRequest{status: http.StatusServiceUnavailable, code: codeNodeUnavailable, message: "Blockchain node unavailable, please try again later"}
+
+// renderError answers with the message of a malformedRequest, 504 for chain calls that timed out
+// and 503 for an unreachable node, and hides any other error behind a 500.
+func renderError(w http.ResponseWriter, r *http.Request, err error) {
+	var mr *malformedRequest
+	switch {
+	case errors.As(err, &mr):
+	case errors.Is(err, context.DeadlineExceeded):
+		log.WithContext(r.Context()).WithError(err).Warn("Chain call timed out")
+		mr = errNodeTimeout
+	case errors.Is(err, chain.ErrNodeUnavailable):
+		log.WithContext(r.Context()).WithError(err).Warn("Blockchain node unavailable")
+		mr = errNodeUnavailable
+	default:
+		log.WithContext(r.Context()).WithError(err).Error("Failed to process claim")
+		renderFailure(w, r, codeInternal, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	renderJSON(w, claimResponse{Message: localize(r, mr.message, mr.args, mr.id, mr.code), Code: mr.code}, mr.status)
+}
+
+// errorCode returns the code of a failed job, transactions that failed to send are TX_FAILED.
+func errorCode(err error) string {
+	var mr *malformedRequest
+	switch {
+	case errors.As(err, &mr):
+		return mr.code
+	case errors.Is(err, context.DeadlineExceeded):
+		return codeNodeTimeout
+	case errors.Is(err, chain.ErrNodeUnavailable):
+		return codeNodeUnavailable
+	default:
+		return codeTxFailed
+	}
+}
+
+// errorMessage returns the message of a failed job in the client's language.
+func errorMessage(r *http.Request, err error) string {
+	var mr *malformedRequest
+	if errors.As(err, &mr) {
+		return localize(r, mr.message, mr.args, mr.id, mr.code)
+	}
+	return localize(r, err.Error(), nil, errorCode(err))
+}
+
+// botErrorMessage is the chat bot counterpart of renderError.
+func botErrorMessage(err error) string {
+	var mr *malformedRequest
+	if errors.As(err, &mr) {
+		return mr.message
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errNodeTimeout.message
+	}
+	if errors.Is(err, chain.ErrNodeUnavailable) {
+		return errNodeUnavailable.message
+	}
+	log.WithError(err).Error("Failed to process bot claim")
+	return "Failed to send funds, please try again later"
 }
 
 func renderJSON(w http.ResponseWriter, v interface{}, code int) error {
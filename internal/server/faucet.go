@@ -0,0 +1,861 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// Faucet serves claims for a single chain, with its own wallet, queue and rate limits.
+type Faucet struct {
+	chain.TxBuilder
+	chainCfg ChainConfig
+	cfg      *Config
+	queue    *TxQueue
+	limiter  *Limiter
+	// keyLimiter replaces limiter for claims authenticated with an API key
+	keyLimiter *Limiter
+	// readLimiter bounds the read-only endpoints, nil leaves them unlimited
+	readLimiter *ReadLimiter
+	// proof is nil unless claims must be signed by the claimed address
+	proof    *OwnershipProof
+	handler  http.Handler
+	reader   *ClaimReader
+	balance  cachedValue
+	gasPrice cachedValue
+	budget   *Budget
+	notifier *Notifier
+	// batcher is nil unless the chain has a batch contract
+	batcher *Batcher
+	// history is nil unless the claims endpoint is enabled
+	history *ClaimHistory
+	// privacy masks the addresses and client IPs of logged claims when set
+	privacy *LogPrivacy
+	// geo is nil unless claims are filtered by country
+	geo *GeoFilter
+	// totals counts the funds sent over the lifetime of the counter store
+	totals *Totals
+	// claim is the claim route, also served at Config.ClaimPath for the primary faucet
+	claim http.Handler
+	// lowBalance is set once a low balance was notified, until the wallet is topped up again
+	lowBalance atomic.Bool
+	// ctx is the server context async jobs run under
+	ctx context.Context
+}
+
+func newFaucet(ctx context.Context, builder chain.TxBuilder, chainCfg ChainConfig, cfg *Config) *Faucet {
+	f := &Faucet{
+		TxBuilder: builder,
+		chainCfg:  chainCfg,
+		cfg:       cfg,
+		budget:    NewBudget(chain.EtherToWei(cfg.DailyBudget)),
+		history:   NewClaimHistory(cfg.HistorySize, cfg.HistoryPrivacy),
+		ctx:       ctx,
+	}
+	workers := cfg.QueueWorkers
+	if chainCfg.BatchContract != "" {
+		f.batcher = NewBatcher(f.sendBatch, cfg.BatchWindow, cfg.BatchSize, f.rpcTimeout())
+		// Claims share a batch only while they wait on a worker, so run enough workers to fill one
+		if workers < f.batcher.size {
+			workers = f.batcher.size
+		}
+	}
+	f.queue = NewTxQueue(workers, cfg.QueueSize)
+	return f
+}
+
+// routes returns the faucet API relative to its mount point, e.g. /claim and /info.
+func (f *Faucet) routes(captcha *Captcha, auth *APIKeyAuth, blocked *AccessList) http.Handler {
+	f.reader = NewClaimReader(f.nameResolver(), f.cfg.MinPayout, f.maxPayout(), f.cfg.StrictChecksum, blocked, WithAddressFields(f.cfg.AddressFields...), WithMaxBodySize(f.cfg.MaxBodySize),
+		WithChainShortName(f.chainCfg.ShortName), WithAddressFormat(f.chainCfg.AddressFormat), WithChainID(f.ChainID()))
+	router := http.NewServeMux()
+	claim := negroni.New(f.reader, auth)
+	if f.geo != nil {
+		claim.Use(byAPIKey(f.geo, nil))
+	}
+	if f.proof != nil {
+		claim.Use(byAPIKey(f.proof, nil))
+		router.Handle("/nonce", allowMethods(f.proof.handleNonce(), http.MethodGet))
+	}
+	claim.Use(byAPIKey(f.limiter, f.keyLimiter))
+	claim.Use(byAPIKey(captcha, nil))
+	if f.cfg.NewAddressInterval > 0 || f.cfg.NewAddressPayout > 0 {
+		claim.Use(byAPIKey(negroni.HandlerFunc(f.checkNewAddress), nil))
+	}
+	claim.Use(negroni.HandlerFunc(f.checkFunds))
+	claim.UseHandler(f.handleClaim())
+	f.claim = allowMethods(claim, http.MethodPost)
+	router.Handle("/claim", f.claim)
+	info := allowMethods(f.readLimiter.limit(f.handleInfo()), http.MethodGet)
+	router.Handle("/info", info)
+	if f.cfg.JSONRPC {
+		router.Handle("/rpc", allowMethods(newRPCHandler(f.claim, info, f.reader.addressFields[0], f.reader.maxBodySize), http.MethodPost))
+	}
+	router.Handle("/job", allowMethods(f.readLimiter.limit(f.handleJob()), http.MethodGet))
+	router.Handle("/status", allowMethods(f.readLimiter.limit(f.handleStatus()), http.MethodGet))
+	if f.history != nil {
+		router.Handle("/claims", allowMethods(f.readLimiter.limit(f.history.handleClaims()), http.MethodGet))
+	}
+	router.HandleFunc("/", notFound)
+	return router
+}
+
+func (f *Faucet) handleClaim() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claim := claimFromRequest(r)
+		clientIP := f.limiter.ClientIP(r)
+		// The job may outlive the request, so it must not inherit its cancellation
+		ctx := withRequestID(f.ctx, requestIDFrom(r.Context()))
+		j, err := f.submitClaim(ctx, claim, clientIP)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+
+		args := map[string]string{"amount": formatAmount(f.payoutFor(claim)), "symbol": f.chainCfg.Symbol, "jobId": j.id}
+		if f.cfg.AsyncClaims {
+			resp := claimResponse{Message: localize(r, fmt.Sprintf("Claim queued, job ID: %s", j.id), args, msgClaimQueued), Amount: args["amount"], JobID: j.id}
+			renderJSON(w, resp, http.StatusAccepted)
+			return
+		}
+
+		// Wait for the job even if the client gives up, its outcome decides whether the limit is recorded
+		result := <-j.done
+		claim.outcome = outcomeNotSent
+		if result.broadcast() {
+			claim.outcome = outcomeSent
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+		var mr *malformedRequest
+		if errors.As(result.err, &mr) || errors.Is(result.err, context.DeadlineExceeded) {
+			renderError(w, r, result.err)
+			return
+		}
+		if result.err != nil {
+			renderFailure(w, r, codeTxFailed, result.err.Error(), http.StatusInternalServerError)
+			return
+		}
+		txHashes := strings.Join(result.txHashes, ", ")
+		args["txHash"] = txHashes
+		args["confirmations"] = strconv.FormatUint(result.confirmations, 10)
+		args["coolingDown"] = coolingDownMessage(result.coolingDown)
+		message := fmt.Sprintf("Txhash: %s", txHashes)
+		if len(result.coolingDown) > 0 {
+			message += ". " + args["coolingDown"]
+		}
+		resp := claimResponse{
+			Message:       localize(r, message, args, msgClaimSent),
+			Amount:        args["amount"],
+			Confirmations: result.confirmations,
+			Tokens:        result.tokens,
+			CoolingDown:   result.coolingDown,
+		}
+		if len(result.txHashes) > 0 {
+			resp.TxHash = result.txHashes[0]
+		}
+		if result.status == jobPending {
+			resp.Message = localize(r, fmt.Sprintf("Transaction is still pending, txhash: %s", txHashes), args, msgClaimPending)
+			renderJSON(w, resp, http.StatusAccepted)
+			return
+		}
+		renderJSON(w, resp, http.StatusOK)
+	}
+}
+
+// checkFunds runs after the limiter and captcha, so only claims that passed them cost RPC calls. The
+// claims it rejects answer 503, which the limiter does not record, so a drained wallet burns no cooldowns.
+// It draws the payout first, after checkNewAddress resolved the tier, so the amount checked is the one sent.
+func (f *Faucet) checkFunds(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	claim := claimFromRequest(r)
+	f.drawPayout(r.Context(), claim)
+	if err := f.hasFunds(r.Context(), claim.Address, f.payoutFor(claim)); err != nil {
+		renderError(w, r, err)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// hasFunds reports a 503 malformedRequest when the gas price is above the configured maximum,
+// or the wallet cannot cover payout and the transfer fee.
+func (f *Faucet) hasFunds(ctx context.Context, address string, payout float64) error {
+	ctx, cancel := f.rpcContext(ctx)
+	defer cancel()
+
+	if maxGasPrice := f.maxGasPrice(); maxGasPrice != nil {
+		gasPrice, err := f.GasPrice(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read gas price: %w", err)
+		}
+		if gasPrice.Cmp(maxGasPrice) > 0 {
+			log.WithContext(ctx).WithFields(log.Fields{
+				"gasPrice":    gasPrice.String(),
+				"maxGasPrice": maxGasPrice.String(),
+			}).Warn("Gas price above the configured maximum")
+			return &malformedRequest{status: http.StatusServiceUnavailable, code: codeGasPriceTooHigh, message: "Network fees too high, try again later"}
+		}
+	}
+
+	balance, err := f.Balance(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read faucet balance: %w", err)
+	}
+	amount := chain.EtherToWei(payout)
+	fee, err := f.TransferFee(ctx, common.HexToAddress(address), amount)
+	if err != nil {
+		return fmt.Errorf("failed to estimate transfer fee: %w", err)
+	}
+
+	required := fee.Add(fee, amount)
+	outOfFunds := balance.Cmp(required) < 0
+	f.checkLowBalance(balance, outOfFunds)
+	if outOfFunds {
+		log.WithContext(ctx).WithFields(log.Fields{
+			"balance":  balance.String(),
+			"required": required.String(),
+		}).Warn("Faucet balance too low to fund claim")
+		if f.cfg.DryRun {
+			return nil
+		}
+		return errOutOfFunds
+	}
+	return nil
+}
+
+// checkLowBalance notifies once when the balance drops below the configured threshold, or the faucet runs dry.
+func (f *Faucet) checkLowBalance(balance *big.Int, outOfFunds bool) {
+	low := outOfFunds || (f.cfg.LowBalance > 0 && balance.Cmp(chain.EtherToWei(f.cfg.LowBalance)) < 0)
+	if !low {
+		f.lowBalance.Store(false)
+		return
+	}
+	if f.lowBalance.Swap(true) {
+		return
+	}
+	formatted := chain.FromBaseUnits(balance, 18)
+	f.notifier.Notify(EventLowBalance, fmt.Sprintf("Faucet %s is running low: %s %s left in %s", f.network(), formatted, f.chainCfg.Symbol, f.Sender().Hex()), map[string]string{
+		"network": f.network(),
+		"account": f.Sender().Hex(),
+		"balance": formatted,
+	})
+}
+
+// checkNewAddress marks claims to addresses that never sent a transaction and hold no balance,
+// which get Config.NewAddressInterval and Config.NewAddressPayout. It runs after the limiter and
+// captcha, which apply the tier when the claim settles and record it with the funded claim, so an
+// address drained after its claim is not new again. Lookups that fail treat the address as established.
+func (f *Faucet) checkNewAddress(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	claim := claimFromRequest(r)
+	newAddress, err := f.isNewAddress(r.Context(), claim.Address)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).WithField("address", f.privacy.mask(claim.Address)).Warn("Failed to check whether the address is new")
+	}
+	claim.newAddress = newAddress
+	next.ServeHTTP(w, r)
+}
+
+func (f *Faucet) isNewAddress(ctx context.Context, address string) (bool, error) {
+	if granted, err := f.limiter.newAddressGranted(address); err != nil || granted {
+		return false, err
+	}
+	ctx, cancel := f.rpcContext(ctx)
+	defer cancel()
+	account := common.HexToAddress(address)
+	nonce, err := f.NonceAt(ctx, account)
+	if err != nil || nonce > 0 {
+		return false, err
+	}
+	balance, err := f.BalanceAt(ctx, account)
+	if err != nil {
+		return false, err
+	}
+	return balance.Sign() == 0, nil
+}
+
+// submitClaim checks the recipient and queues the payout. It is the send path shared by
+// the web handler, which validated and rate limited the claim in its middlewares, and claimFor.
+// Both drew the payout before checking the funds for it.
+func (f *Faucet) submitClaim(ctx context.Context, claim *claimRequest, source string) (*job, error) {
+	tokens, cooling, err := f.dueTokens(claim.Address)
+	if err != nil {
+		return nil, err
+	}
+	if f.payoutFor(claim) <= 0 && len(tokens) == 0 && len(cooling) > 0 {
+		// A claim with nothing due is rate limited until the first token is
+		wait := cooling[0].wait
+		for _, token := range cooling[1:] {
+			wait = min(wait, token.wait)
+		}
+		rateLimitedTotal.Inc()
+		return nil, errRateLimited(limitedAddress, wait, f.limiter.waitRounding)
+	}
+	checkCtx, cancel := f.rpcContext(ctx)
+	err = f.checkRecipient(checkCtx, claim.Address)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	amount := chain.EtherToWei(f.payoutFor(claim))
+	if !f.budget.reserve(amount) {
+		log.WithContext(ctx).WithField("network", f.network()).Warn("Daily budget exhausted")
+		return nil, &malformedRequest{status: http.StatusServiceUnavailable, code: codeBudgetExhausted, message: "Daily faucet budget exhausted, try tomorrow"}
+	}
+	j, err := f.queue.Submit(ctx, func(ctx context.Context) jobResult {
+		result := f.dispense(ctx, claim, source, tokens)
+		result.coolingDown = cooling
+		if !result.broadcast() {
+			f.budget.refund(amount)
+		}
+		return result
+	})
+	if err != nil {
+		f.budget.refund(amount)
+		log.WithContext(ctx).WithError(err).Warn("Rejected claim")
+		return nil, errBusy
+	}
+	return j, nil
+}
+
+// dueTokens splits the bundle tokens into those due for address and those still cooling down.
+// Concurrent claims of an address are serialized by the limiter holding its key, so the
+// cooldowns read here cannot change until the claim settles.
+func (f *Faucet) dueTokens(address string) ([]TokenPayout, []tokenCooldown, error) {
+	var due []TokenPayout
+	var cooling []tokenCooldown
+	for _, token := range f.chainCfg.Tokens {
+		if token.Cooldown > 0 {
+			wait, err := f.limiter.tokenWait(address, token.Address)
+			if err != nil {
+				return nil, nil, err
+			}
+			if wait > 0 {
+				cooling = append(cooling, tokenCooldown{Address: token.Address, WaitSeconds: math.Ceil(wait.Seconds()), wait: wait})
+				continue
+			}
+		}
+		due = append(due, token)
+	}
+	return due, cooling, nil
+}
+
+// claimFor funds address on behalf of a chat bot user. It applies the address rules of the web
+// endpoint, limits both userKey and the address for the faucet interval, and waits for the payout.
+// Errors carrying a message for the user are malformedRequests.
+func (f *Faucet) claimFor(ctx context.Context, userKey, address string) (jobResult, error) {
+	// Bot claims have no HTTP request, but their logs are correlated all the same
+	ctx = withRequestID(ctx, newRequestID())
+	address, err := f.reader.readAddress(ctx, address)
+	if err != nil {
+		return jobResult{}, err
+	}
+	if _, denylist := f.limiter.accessLists(); denylist.ContainsAddress(address) {
+		return jobResult{}, &malformedRequest{status: http.StatusForbidden, code: codeDenied, message: "This address or network is not allowed to claim from the faucet"}
+	}
+	keys := []string{userKey, address}
+	key, wait, hold, err := f.limiter.reserve(ctx, keys...)
+	if err != nil {
+		return jobResult{}, err
+	}
+	if wait > 0 {
+		reason := limitedUser
+		if key == address {
+			reason = limitedAddress
+		}
+		rateLimitedTotal.Inc()
+		return jobResult{}, errRateLimited(reason, wait, f.limiter.waitRounding)
+	}
+	// Funds are checked once the limits passed, as on the web route, so limited users cost no RPC calls
+	claim := &claimRequest{Address: address}
+	f.drawPayout(ctx, claim)
+	if err := f.hasFunds(ctx, address, f.payoutFor(claim)); err != nil {
+		f.limiter.settle(hold, false)
+		return jobResult{}, err
+	}
+
+	j, err := f.submitClaim(withRequestID(f.ctx, requestIDFrom(ctx)), claim, userKey)
+	if err != nil {
+		f.limiter.settle(hold, false)
+		return jobResult{}, err
+	}
+	// Wait for the job even if the caller gives up, its outcome decides whether the limit is recorded
+	result := <-j.done
+	f.limiter.settle(hold, result.broadcast())
+	return result, result.err
+}
+
+// botCoolingDown is appended to the replies of chat bots, naming the tokens a claim left out.
+func botCoolingDown(result jobResult) string {
+	if len(result.coolingDown) == 0 {
+		return ""
+	}
+	return ". " + coolingDownMessage(result.coolingDown)
+}
+
+// checkRecipient rejects recipients that do not need funds, or look freshly generated, before anything is sent.
+func (f *Faucet) checkRecipient(ctx context.Context, address string) error {
+	account := common.HexToAddress(address)
+	if f.cfg.ContractRecipients == ContractsWarn || f.cfg.ContractRecipients == ContractsReject {
+		isContract, err := f.IsContract(ctx, account)
+		if err != nil {
+			return err
+		}
+		if isContract && f.cfg.ContractRecipients == ContractsReject {
+			return &malformedRequest{status: http.StatusBadRequest, code: codeRecipientRejected, message: "Recipient is a contract, please use an account address"}
+		}
+		if isContract {
+			log.WithContext(ctx).WithField("address", f.privacy.mask(address)).Warn("Funding a contract recipient")
+		}
+	}
+
+	if f.cfg.MaxRecipientBalance <= 0 && f.cfg.MinRecipientNonce == 0 {
+		return nil
+	}
+
+	balance, err := f.BalanceAt(ctx, account)
+	if err != nil {
+		return err
+	}
+	if f.cfg.MaxRecipientBalance > 0 && balance.Cmp(chain.EtherToWei(f.cfg.MaxRecipientBalance)) > 0 {
+		msg := fmt.Sprintf("Address already holds more than %s %s, claims are reserved for addresses that need funds", formatAmount(f.cfg.MaxRecipientBalance), f.chainCfg.Symbol)
+		return &malformedRequest{status: http.StatusForbidden, code: codeRecipientRejected, message: msg}
+	}
+
+	if f.cfg.MinRecipientNonce > 0 && balance.Sign() == 0 {
+		nonce, err := f.NonceAt(ctx, account)
+		if err != nil {
+			return err
+		}
+		if nonce < f.cfg.MinRecipientNonce {
+			msg := fmt.Sprintf("Address must have sent at least %d transactions or hold a balance to claim", f.cfg.MinRecipientNonce)
+			return &malformedRequest{status: http.StatusForbidden, code: codeRecipientRejected, message: msg}
+		}
+	}
+	return nil
+}
+
+// dispense sends the native payout and the due tokens of a claim, it runs on a queue worker.
+// Every transaction of a bundle gets its own RPC timeout.
+func (f *Faucet) dispense(parent context.Context, claim *claimRequest, clientIP string, tokens []TokenPayout) jobResult {
+	address := claim.Address
+	payout := f.payoutFor(claim)
+	amount := chain.EtherToWei(payout)
+	var txHashes []string
+	if payout > 0 {
+		sent, err := f.transfer(parent, address, amount)
+		for _, txHash := range sent {
+			txHashes = append(txHashes, txHash.String())
+		}
+		if err != nil {
+			log.WithContext(parent).WithError(err).Error("Failed to send transaction")
+			return jobResult{status: jobFailed, txHashes: txHashes, err: f.sendFailed(parent, err)}
+		}
+	}
+	tokenAmounts := make([]string, len(tokens))
+	sentTokens := make([]string, len(tokens))
+	for i, token := range tokens {
+		tokenAmount := chain.ToBaseUnits(token.Amount, token.Decimals)
+		ctx, cancel := f.rpcContext(parent)
+		txHash, err := f.TransferERC20(ctx, common.HexToAddress(token.Address), common.HexToAddress(address), tokenAmount)
+		cancel()
+		if err != nil {
+			log.WithContext(parent).WithField("token", token.Address).WithError(err).Error("Failed to send token transaction")
+			return jobResult{status: jobFailed, txHashes: txHashes, err: f.sendFailed(parent, err)}
+		}
+		txHashes = append(txHashes, txHash.String())
+		tokenAmounts[i] = tokenAmount.String()
+		sentTokens[i] = token.Address
+	}
+
+	// Dry run transactions are never mined
+	var confirmations uint64
+	if (f.cfg.WaitReceipt || f.cfg.Confirmations > 0) && !f.cfg.DryRun {
+		if result, ok := f.waitForReceipts(parent, txHashes); !ok {
+			// Pending claims keep their cooldowns like funded ones
+			if result.status == jobPending {
+				f.recordTokens(address, tokens)
+			}
+			result.tokens = sentTokens
+			return result
+		}
+		confirmations = f.cfg.Confirmations
+	}
+	f.recordTokens(address, tokens)
+
+	claimsTotal.Inc()
+	if !f.cfg.DryRun {
+		f.totals.record(amount, tokens)
+	}
+	fields := log.Fields{
+		"address":  f.privacy.mask(address),
+		"clientIP": f.privacy.mask(clientIP),
+		"amount":   amount.String(),
+		"txHash":   strings.Join(txHashes, ","),
+		"chainID":  f.ChainID().String(),
+	}
+	if f.cfg.DryRun {
+		fields["dryRun"] = true
+	}
+	if claim.Tag != "" {
+		fields["tag"] = claim.Tag
+	}
+	if len(tokens) > 0 {
+		fields["token"] = strings.Join(sentTokens, ",")
+		fields["tokenAmount"] = strings.Join(tokenAmounts, ",")
+	}
+	log.WithContext(parent).WithFields(fields).Info("Claim funded")
+	f.history.add(address, formatAmount(payout), claim.Tag, txHashes)
+	f.notifier.Notify(EventClaim, fmt.Sprintf("Sent %s %s to %s on %s", formatAmount(payout), f.chainCfg.Symbol, address, f.network()), map[string]string{
+		"network": f.network(),
+		"address": address,
+		"amount":  amount.String(),
+		"txHash":  strings.Join(txHashes, ","),
+	})
+	return jobResult{status: jobDone, txHashes: txHashes, confirmations: confirmations, tokens: sentTokens}
+}
+
+// recordTokens starts the cooldowns of the sent tokens that have one.
+func (f *Faucet) recordTokens(address string, tokens []TokenPayout) {
+	for _, token := range tokens {
+		if token.Cooldown > 0 {
+			f.limiter.recordToken(address, token.Address, token.Cooldown)
+		}
+	}
+}
+
+// sendFailed counts a failed send and returns the error to answer the claim with. When the
+// wallet cannot cover the transaction the operator is alerted, and the claim is answered
+// as out of funds, so its rate limit is rolled back like that of any rejected claim.
+func (f *Faucet) sendFailed(parent context.Context, err error) error {
+	txErrorsTotal.WithLabelValues(txErrorClass(err)).Inc()
+	switch {
+	case errors.Is(err, chain.ErrGasLimitExceeded) || errors.Is(err, chain.ErrGasTooHigh):
+		return errGasLimitExceeded
+	// The nonce is read again after a rejection, so a retry has a fair chance
+	case errors.Is(err, chain.ErrSendThrottled) || errors.Is(err, chain.ErrNonceTooLow) || errors.Is(err, chain.ErrNonceTooHigh):
+		return errBusy
+	case errors.Is(err, chain.ErrNodeUnavailable):
+		return errNodeUnavailable
+	case !errors.Is(err, chain.ErrInsufficientFunds):
+		return err
+	}
+
+	ctx, cancel := f.rpcContext(parent)
+	defer cancel()
+	entry := log.WithContext(parent).WithFields(log.Fields{
+		"network": f.network(),
+		"account": f.Sender().Hex(),
+	}).WithError(err)
+	balance, balanceErr := f.Balance(ctx)
+	if balanceErr == nil {
+		entry = entry.WithField("balance", balance.String())
+	}
+	entry.Error("Faucet wallet cannot cover transactions, top it up")
+	if balanceErr == nil {
+		f.checkLowBalance(balance, true)
+	}
+	return errOutOfFunds
+}
+
+// transfer sends the native payout, wrapped when the chain pays wrapped native, through the
+// batcher when there is one, or else as a plain transfer. Batched payouts wait for the batch
+// window, which the RPC timeout does not cover.
+func (f *Faucet) transfer(parent context.Context, address string, amount *big.Int) ([]common.Hash, error) {
+	if f.batcher != nil {
+		txHash, err := f.batcher.Add(parent, common.HexToAddress(address), amount)
+		return []common.Hash{txHash}, err
+	}
+	ctx, cancel := f.rpcContext(parent)
+	defer cancel()
+	if f.chainCfg.WrappedNative != "" {
+		return f.WrapAndTransfer(ctx, common.HexToAddress(f.chainCfg.WrappedNative), common.HexToAddress(address), amount)
+	}
+	txHash, err := f.Transfer(ctx, address, amount)
+	if err != nil {
+		return nil, err
+	}
+	return []common.Hash{txHash}, nil
+}
+
+// sendBatch pays a batch through the batch contract, a batch of one is sent as a plain transfer.
+func (f *Faucet) sendBatch(ctx context.Context, recipients []common.Address, values []*big.Int) (common.Hash, error) {
+	if len(recipients) == 1 {
+		return f.Transfer(ctx, recipients[0].Hex(), values[0])
+	}
+	txHash, err := f.DisperseEther(ctx, common.HexToAddress(f.chainCfg.BatchContract), recipients, values)
+	if err == nil {
+		log.WithFields(log.Fields{
+			"txHash":     txHash.String(),
+			"recipients": len(recipients),
+		}).Info("Sent batched payouts")
+	}
+	return txHash, err
+}
+
+// waitForReceipts reports false with the result to return when a transaction reverted
+// or was not mined and confirmed within the receipt timeout.
+func (f *Faucet) waitForReceipts(parent context.Context, txHashes []string) (jobResult, bool) {
+	ctx, cancel := context.WithTimeout(parent, f.cfg.ReceiptTimeout)
+	defer cancel()
+
+	for _, txHash := range txHashes {
+		_, err := f.WaitForConfirmations(ctx, common.HexToHash(txHash), f.cfg.Confirmations)
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, context.DeadlineExceeded):
+			log.WithContext(ctx).WithField("txHash", txHash).Warn("Timed out waiting for transaction receipt")
+			return jobResult{status: jobPending, txHashes: txHashes}, false
+		default:
+			log.WithContext(ctx).WithField("txHash", txHash).WithError(err).Error("Transaction failed")
+			return jobResult{status: jobFailed, txHashes: txHashes, err: err}, false
+		}
+	}
+	return jobResult{}, true
+}
+
+func (f *Faucet) handleJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		result, ok := f.queue.Result(id)
+		if !ok {
+			renderFailure(w, r, codeNotFound, "job not found", http.StatusNotFound)
+			return
+		}
+
+		resp := jobResponse{
+			ID:            id,
+			Status:        string(result.status),
+			TxHashes:      result.txHashes,
+			Confirmations: result.confirmations,
+			Tokens:        result.tokens,
+			CoolingDown:   result.coolingDown,
+		}
+		if result.err != nil {
+			resp.Message = errorMessage(r, result.err)
+			resp.Code = errorCode(result.err)
+		}
+		renderJSON(w, resp, http.StatusOK)
+	}
+}
+
+func (f *Faucet) handleInfo() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := infoResponse{
+			Account:           f.Sender().String(),
+			Network:           f.chainCfg.Network,
+			ChainID:           f.ChainID().String(),
+			Symbol:            f.chainCfg.Symbol,
+			Payout:            strconv.FormatFloat(f.chainCfg.Payout, 'f', -1, 64),
+			PayoutWei:         chain.EtherToWei(f.chainCfg.Payout).String(),
+			Interval:          f.cfg.Interval,
+			Tokens:            f.tokenInfos(),
+			CaptchaProvider:   f.captchaProvider(),
+			CaptchaSiteKey:    f.cfg.CaptchaSiteKey,
+			CaptchaAction:     f.cfg.CaptchaAction,
+			SignatureRequired: f.proof != nil,
+			DryRun:            f.cfg.DryRun,
+			Confirmations:     f.cfg.Confirmations,
+		}
+		if balance, err := f.balance.get(r.Context(), f.rpcTimeout(), f.Balance); err != nil {
+			log.WithContext(r.Context()).WithError(err).Warn("Failed to read faucet balance")
+		} else {
+			resp.Balance = chain.FromBaseUnits(balance, 18)
+			resp.BalanceWei = balance.String()
+		}
+		if gasPrice, err := f.gasPrice.get(r.Context(), f.rpcTimeout(), f.GasPrice); err != nil {
+			log.WithContext(r.Context()).WithError(err).Warn("Failed to read gas price")
+		} else {
+			resp.GasPrice = chain.FromBaseUnits(gasPrice, 9)
+		}
+		if f.cfg.MaxGasPrice > 0 {
+			resp.MaxGasPrice = formatAmount(f.cfg.MaxGasPrice)
+		}
+		if len(resp.Tokens) > 0 {
+			// The first token keeps the fields of single token faucets
+			resp.Token, resp.TokenPayout = resp.Tokens[0].Address, resp.Tokens[0].Payout
+		}
+		if f.budget != nil {
+			resp.BudgetRemaining = chain.FromBaseUnits(f.budget.remaining(), 18)
+		}
+		if f.totals != nil {
+			if totals, err := f.totals.read(f.chainCfg.Tokens); err != nil {
+				log.WithContext(r.Context()).WithError(err).Warn("Failed to read lifetime totals")
+			} else {
+				resp.Totals = totals.info()
+			}
+		}
+		renderJSON(w, resp, http.StatusOK)
+	}
+}
+
+const infoCacheTTL = 5 * time.Second
+
+// cachedValue keeps page loads of the info endpoint from querying the node every time.
+type cachedValue struct {
+	mu      sync.Mutex
+	value   *big.Int
+	updated time.Time
+}
+
+func (c *cachedValue) get(ctx context.Context, timeout time.Duration, fetch func(context.Context) (*big.Int, error)) (*big.Int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.value != nil && time.Since(c.updated) < infoCacheTTL {
+		return c.value, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	value, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.value, c.updated = value, time.Now()
+	return value, nil
+}
+
+func (f *Faucet) handleStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address := r.URL.Query().Get("address")
+		format := f.chainCfg.AddressFormat
+		if format == nil {
+			format = chain.EVMAddressFormat(false)
+		}
+		account, err := format.ParseAddress(address)
+		if err != nil {
+			renderFailure(w, r, codeInvalidAddress, "invalid address", http.StatusBadRequest)
+			return
+		}
+
+		// Cache keys are the checksummed addresses accepted by the claim endpoint
+		address = account.Hex()
+		wait, err := f.limiter.Remaining(address, f.limiter.ClientIP(r))
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		renderJSON(w, statusResponse{
+			Eligible:    wait <= 0,
+			WaitSeconds: math.Ceil(wait.Seconds()),
+		}, http.StatusOK)
+	}
+}
+
+// rpcContext bounds chain calls, so a hung node fails the claim instead of blocking it.
+func (f *Faucet) rpcContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, f.rpcTimeout())
+}
+
+func (f *Faucet) rpcTimeout() time.Duration {
+	if f.cfg.RPCTimeout > 0 {
+		return f.cfg.RPCTimeout
+	}
+	return DefaultRPCTimeout
+}
+
+// network names the faucet in logs and metrics.
+func (f *Faucet) network() string {
+	if f.chainCfg.Network != "" {
+		return f.chainCfg.Network
+	}
+	return f.chainCfg.Name
+}
+
+// payoutFor returns the requested amount of a claim, or the default payout.
+func (f *Faucet) payoutFor(claim *claimRequest) float64 {
+	if claim.Amount != nil {
+		return *claim.Amount
+	}
+	return f.chainCfg.Payout
+}
+
+// payoutSteps is the resolution of randomized payouts, a millionth of a coin.
+const payoutSteps = 1e6
+
+// drawPayout picks the amount of a claim that did not request one uniformly between Payout and
+// PayoutMax of the chain. It reads crypto/rand, so bots cannot predict the amounts to farm the
+// largest ones, and falls back to Payout when that fails. New addresses are paid
+// Config.NewAddressPayout instead when it is set.
+func (f *Faucet) drawPayout(ctx context.Context, claim *claimRequest) {
+	if claim.Amount != nil {
+		return
+	}
+	if claim.newAddress && f.cfg.NewAddressPayout > 0 {
+		amount := f.cfg.NewAddressPayout
+		claim.Amount = &amount
+		return
+	}
+	if f.chainCfg.PayoutMax <= f.chainCfg.Payout {
+		return
+	}
+	steps := int64(math.Round((f.chainCfg.PayoutMax - f.chainCfg.Payout) * payoutSteps))
+	n, err := rand.Int(rand.Reader, big.NewInt(steps+1))
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Warn("Failed to randomize payout, sending the minimum")
+		return
+	}
+	amount := (math.Round(f.chainCfg.Payout*payoutSteps) + float64(n.Int64())) / payoutSteps
+	claim.Amount = &amount
+}
+
+// maxGasPrice returns the configured cap in wei, or nil when fees are not capped.
+func (f *Faucet) maxGasPrice() *big.Int {
+	if f.cfg.MaxGasPrice <= 0 {
+		return nil
+	}
+	return chain.ToBaseUnits(f.cfg.MaxGasPrice, 9)
+}
+
+// maxPayout caps requested amounts at the default payout unless configured otherwise.
+func (f *Faucet) maxPayout() float64 {
+	if f.cfg.MaxPayout > 0 {
+		return f.cfg.MaxPayout
+	}
+	return f.chainCfg.Payout
+}
+
+func (f *Faucet) captchaProvider() string {
+	if f.cfg.CaptchaSecret == "" {
+		return ""
+	}
+	if f.cfg.CaptchaProvider == "" {
+		return HCaptchaProvider
+	}
+	return strings.ToLower(f.cfg.CaptchaProvider)
+}
+
+func (f *Faucet) tokenInfos() []tokenInfo {
+	var tokens []tokenInfo
+	for _, token := range f.chainCfg.Tokens {
+		tokens = append(tokens, tokenInfo{Address: token.Address, Payout: formatAmount(token.Amount), Cooldown: int(token.Cooldown / time.Minute)})
+	}
+	return tokens
+}
+
+func (f *Faucet) nameResolver() NameResolver {
+	if f.cfg.ENSRegistry == "" {
+		return nil
+	}
+	registry := common.HexToAddress(f.cfg.ENSRegistry)
+	return func(ctx context.Context, name string) (common.Address, error) {
+		ctx, cancel := f.rpcContext(ctx)
+		defer cancel()
+		return f.ResolveENSName(ctx, registry, name)
+	}
+}
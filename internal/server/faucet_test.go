@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestDrawPayout(t *testing.T) {
+	f := &Faucet{chainCfg: ChainConfig{Payout: 0.1, PayoutMax: 0.15}}
+	seen := make(map[float64]bool)
+	for i := 0; i < 100; i++ {
+		claim := &claimRequest{}
+		f.drawPayout(context.Background(), claim)
+		if claim.Amount == nil || *claim.Amount < 0.1 || *claim.Amount > 0.15 {
+			t.Fatalf("drawPayout() = %v, want an amount between 0.1 and 0.15", claim.Amount)
+		}
+		seen[*claim.Amount] = true
+	}
+	if len(seen) < 2 {
+		t.Error("drawPayout() drew the same amount every time")
+	}
+
+	requested := 0.12
+	claim := &claimRequest{Amount: &requested}
+	f.drawPayout(context.Background(), claim)
+	if *claim.Amount != requested {
+		t.Errorf("drawPayout() replaced the requested amount by %v", *claim.Amount)
+	}
+	claim = &claimRequest{}
+	(&Faucet{chainCfg: ChainConfig{Payout: 0.1}}).drawPayout(context.Background(), claim)
+	if claim.Amount != nil {
+		t.Errorf("drawPayout() without a maximum = %v, want the fixed payout", *claim.Amount)
+	}
+}
+
+// revertingBuilder sends every transfer, and reports each mined with a failed status.
+type revertingBuilder struct {
+	chain.TxBuilder
+}
+
+func (b revertingBuilder) ChainID() *big.Int { return big.NewInt(1) }
+
+func (b revertingBuilder) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	return common.HexToHash("0x01"), nil
+}
+
+func (b revertingBuilder) WaitForConfirmations(ctx context.Context, txHash common.Hash, confirmations uint64) (*types.Receipt, error) {
+	return &types.Receipt{Status: types.ReceiptStatusFailed}, chain.ErrTxReverted
+}
+
+func TestClaimReverted(t *testing.T) {
+	cfg := &Config{WaitReceipt: true, ReceiptTimeout: time.Second, DailyBudget: 10, QueueWorkers: 1, QueueSize: 1}
+	f := newFaucet(context.Background(), revertingBuilder{}, ChainConfig{Payout: 1}, cfg)
+	f.limiter = NewLimiter(NewMemoryStore(), nil, time.Hour, time.Hour, 1, nil, nil)
+	handler := negroni.New(f.limiter)
+	handler.UseHandler(f.handleClaim())
+	claim := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+		req.RemoteAddr = "1.2.3.4:5678"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}))
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		// A reverted claim paid nothing, so it limits no one either
+		if code := claim(); code != http.StatusInternalServerError {
+			t.Fatalf("reverted claim %d status = %d, want 500", i+1, code)
+		}
+	}
+	if remaining := f.budget.remaining(); remaining.Cmp(chain.EtherToWei(10)) != 0 {
+		t.Errorf("budget remaining = %v, want the reverted claims refunded", remaining)
+	}
+}
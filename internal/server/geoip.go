@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+	log "github.com/sirupsen/logrus"
+)
+
+// Modes of a GeoFilter: GeoAllow only funds clients in the listed countries, GeoBlock funds
+// everyone else.
+const (
+	GeoAllow = "allow"
+	GeoBlock = "block"
+)
+
+// CountryLookup returns the ISO 3166-1 alpha-2 code of the country of ip, empty when unknown.
+type CountryLookup func(ip net.IP) (string, error)
+
+// GeoFilter rejects claims by the country of the client IP. In allow mode clients whose country
+// is unknown, such as private addresses, are rejected too. Lookups that fail let the claim pass.
+type GeoFilter struct {
+	lookup    CountryLookup
+	countries map[string]bool
+	allow     bool
+	clientIP  *ClientIPResolver
+	privacy   *LogPrivacy
+	db        *maxminddb.Reader
+}
+
+// NewGeoFilter filters with lookup, resolving the client IP with clientIP, see ClientIPResolver.
+func NewGeoFilter(lookup CountryLookup, mode string, countries []string, clientIP *ClientIPResolver, privacy *LogPrivacy) *GeoFilter {
+	listed := make(map[string]bool, len(countries))
+	for _, country := range countries {
+		listed[strings.ToUpper(strings.TrimSpace(country))] = true
+	}
+	return &GeoFilter{lookup: lookup, countries: listed, allow: mode == GeoAllow, clientIP: clientIP, privacy: privacy}
+}
+
+// OpenGeoFilter filters with the MaxMind database at path, such as GeoLite2-Country.mmdb.
+// A database that cannot be read disables the filter with a warning, returning nil.
+func OpenGeoFilter(path, mode string, countries []string, clientIP *ClientIPResolver, privacy *LogPrivacy) *GeoFilter {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Warn("Failed to open GeoIP database, claims are not filtered by country")
+		return nil
+	}
+	g := NewGeoFilter(countryLookup(db), mode, countries, clientIP, privacy)
+	g.db = db
+	return g
+}
+
+func countryLookup(db *maxminddb.Reader) CountryLookup {
+	return func(ip net.IP) (string, error) {
+		var record struct {
+			Country struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+		}
+		if err := db.Lookup(ip, &record); err != nil {
+			return "", err
+		}
+		return record.Country.ISOCode, nil
+	}
+}
+
+// Close releases the database of a filter opened with OpenGeoFilter.
+func (g *GeoFilter) Close() error {
+	if g == nil || g.db == nil {
+		return nil
+	}
+	return g.db.Close()
+}
+
+func (g *GeoFilter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	clientIP := g.clientIP.ClientIP(r)
+	country, err := g.country(clientIP)
+	if err != nil {
+		log.WithContext(r.Context()).WithError(err).WithField("clientIP", g.privacy.mask(clientIP)).Warn("Failed to look up client country")
+		next.ServeHTTP(w, r)
+		return
+	}
+	if g.allowed(country) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	log.WithContext(r.Context()).WithFields(log.Fields{
+		"clientIP": g.privacy.mask(clientIP),
+		"country":  country,
+	}).Info("Rejected claim from a blocked country")
+	renderError(w, r, &malformedRequest{
+		status:  http.StatusForbidden,
+		code:    codeCountryBlocked,
+		message: "The faucet is not available in your country",
+	})
+}
+
+func (g *GeoFilter) country(clientIP string) (string, error) {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return "", fmt.Errorf("invalid client IP %q", clientIP)
+	}
+	return g.lookup(ip)
+}
+
+func (g *GeoFilter) allowed(country string) bool {
+	if country == "" {
+		return !g.allow
+	}
+	return g.countries[strings.ToUpper(country)] == g.allow
+}
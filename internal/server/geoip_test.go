@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeoFilter(t *testing.T) {
+	countries := map[string]string{"1.1.1.1": "DE", "2.2.2.2": "KP", "3.3.3.3": ""}
+	lookup := func(ip net.IP) (string, error) {
+		if ip.String() == "4.4.4.4" {
+			return "", errors.New("corrupt record")
+		}
+		return countries[ip.String()], nil
+	}
+	claim := func(g *GeoFilter, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/claim", nil)
+		r.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		return w
+	}
+
+	tests := []struct {
+		mode string
+		ip   string
+		want int
+	}{
+		{GeoBlock, "1.1.1.1", http.StatusOK},
+		{GeoBlock, "2.2.2.2", http.StatusForbidden},
+		{GeoBlock, "3.3.3.3", http.StatusOK},
+		{GeoBlock, "4.4.4.4", http.StatusOK},
+		{GeoAllow, "1.1.1.1", http.StatusForbidden},
+		{GeoAllow, "2.2.2.2", http.StatusOK},
+		{GeoAllow, "3.3.3.3", http.StatusForbidden},
+		{GeoAllow, "4.4.4.4", http.StatusOK},
+	}
+	for _, tt := range tests {
+		g := NewGeoFilter(lookup, tt.mode, []string{"kp"}, nil, nil)
+		w := claim(g, tt.ip)
+		if w.Code != tt.want {
+			t.Errorf("%s %s status = %d, want %d", tt.mode, tt.ip, w.Code, tt.want)
+			continue
+		}
+		if w.Code == http.StatusForbidden {
+			var resp claimResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codeCountryBlocked {
+				t.Errorf("%s %s response = %+v, want code %s", tt.mode, tt.ip, resp, codeCountryBlocked)
+			}
+		}
+	}
+
+	if g := OpenGeoFilter(filepath.Join(t.TempDir(), "missing.mmdb"), GeoBlock, []string{"KP"}, nil, nil); g != nil {
+		t.Error("OpenGeoFilter() with a missing database, want nil to disable the filter")
+	}
+}
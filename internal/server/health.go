@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// handleHealthz reports that the process is serving requests, without touching the chain.
+func (s *Server) handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderJSON(w, healthResponse{Status: "ok"}, http.StatusOK)
+	}
+}
+
+// handleReadyz answers 200 only while every faucet can reach its node and fund a claim.
+// The chain values are the cached ones of the info endpoint, so frequent probes cost no extra calls.
+func (s *Server) handleReadyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, faucet := range s.order {
+			if err := faucet.ready(r.Context()); err != nil {
+				reason := err.Error()
+				if len(s.order) > 1 {
+					reason = faucet.network() + ": " + reason
+				}
+				log.WithField("reason", reason).Warn("Faucet not ready")
+				renderJSON(w, healthResponse{Status: "unavailable", Reason: reason}, http.StatusServiceUnavailable)
+				return
+			}
+		}
+		renderJSON(w, healthResponse{Status: "ok"}, http.StatusOK)
+	}
+}
+
+// ready reports why the faucet cannot serve a default claim, or nil when it can.
+func (f *Faucet) ready(ctx context.Context) error {
+	balance, err := f.balance.get(ctx, f.rpcTimeout(), f.Balance)
+	if err != nil {
+		return f.unreachable(err)
+	}
+	gasPrice, err := f.gasPrice.get(ctx, f.rpcTimeout(), f.GasPrice)
+	if err != nil {
+		return f.unreachable(err)
+	}
+	if f.cfg.DryRun {
+		return nil
+	}
+
+	required := new(big.Int).Mul(gasPrice, big.NewInt(21000))
+	required.Add(required, chain.EtherToWei(f.chainCfg.Payout))
+	if balance.Cmp(required) < 0 {
+		return fmt.Errorf("wallet balance %s below the %s needed for a claim", chain.FromBaseUnits(balance, 18), chain.FromBaseUnits(required, 18))
+	}
+	return nil
+}
+
+// unreachable logs the node error and returns the short reason probes are answered with.
+func (f *Faucet) unreachable(err error) error {
+	log.WithError(err).WithField("network", f.network()).Warn("Readiness check failed to reach the node")
+	return errors.New("node unreachable")
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Bounds of the limit query parameter of the claims endpoint.
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// ClaimHistory keeps the latest funded claims in a ring buffer for the public claims endpoint.
+// Addresses are stored shortened, or hashed when hashAddresses is set.
+type ClaimHistory struct {
+	mu            sync.Mutex
+	records       []claimRecord
+	next          int
+	full          bool
+	hashAddresses bool
+	// salt keeps hashed addresses from being matched against a list of known ones
+	salt []byte
+}
+
+// NewClaimHistory returns a history of the last size claims, or nil when size is not positive.
+func NewClaimHistory(size int, hashAddresses bool) *ClaimHistory {
+	if size <= 0 {
+		return nil
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	return &ClaimHistory{
+		records:       make([]claimRecord, size),
+		hashAddresses: hashAddresses,
+		salt:          salt,
+	}
+}
+
+// add records a funded claim, overwriting the oldest one once the buffer is full.
+func (h *ClaimHistory) add(address, amount, tag string, txHashes []string) {
+	if h == nil {
+		return
+	}
+	record := claimRecord{
+		Address:   h.mask(address),
+		Amount:    amount,
+		Tag:       tag,
+		Timestamp: time.Now().UTC(),
+		TxHashes:  txHashes,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// recent returns up to limit claims, newest first.
+func (h *ClaimHistory) recent(limit int) []claimRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.records)
+	}
+	if limit > count {
+		limit = count
+	}
+	records := make([]claimRecord, 0, limit)
+	for i := 1; i <= limit; i++ {
+		records = append(records, h.records[(h.next-i+len(h.records))%len(h.records)])
+	}
+	return records
+}
+
+func (h *ClaimHistory) mask(address string) string {
+	if h.hashAddresses {
+		sum := sha256.Sum256(append(h.salt, address...))
+		return hex.EncodeToString(sum[:8])
+	}
+	if len(address) < 10 {
+		return address
+	}
+	return address[:6] + "…" + address[len(address)-4:]
+}
+
+func (h *ClaimHistory) handleClaims() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultHistoryLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				renderFailure(w, r, codeInvalidRequest, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			limit = min(parsed, maxHistoryLimit)
+		}
+		renderJSON(w, claimsResponse{Claims: h.recent(limit)}, http.StatusOK)
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClaimHistory(t *testing.T) {
+	history := NewClaimHistory(3, false)
+	for _, address := range []string{
+		"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+		"0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984",
+		"0x6B175474E89094C44Da98b954EedeAC495271d0F",
+		"0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+	} {
+		history.add(address, "1", "", []string{"0x01"})
+	}
+
+	records := history.recent(maxHistoryLimit)
+	want := []string{"0xA0b8…eB48", "0x6B17…1d0F", "0x1f98…F984"}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i, record := range records {
+		if record.Address != want[i] {
+			t.Errorf("record %d address = %q, want %q", i, record.Address, want[i])
+		}
+	}
+	if records := history.recent(1); len(records) != 1 || records[0].Address != want[0] {
+		t.Errorf("recent(1) = %v, want the newest claim only", records)
+	}
+
+	history.add("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "1", "octocat", nil)
+	if tag := history.recent(1)[0].Tag; tag != "octocat" {
+		t.Errorf("tag = %q, want it recorded", tag)
+	}
+
+	hashed := NewClaimHistory(1, true)
+	hashed.add("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "1", "", nil)
+	if address := hashed.recent(1)[0].Address; strings.Contains(strings.ToLower(address), "ab5801") {
+		t.Errorf("hashed address %q reveals the address", address)
+	}
+}
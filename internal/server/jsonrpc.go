@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// JSON-RPC 2.0 error codes, the server defined ones follow EIP-1474.
+const (
+	rpcParseError          = -32700
+	rpcInvalidRequest      = -32600
+	rpcMethodNotFound      = -32601
+	rpcInvalidParams       = -32602
+	rpcInternalError       = -32603
+	rpcServerError         = -32000
+	rpcResourceUnavailable = -32002
+	rpcTransactionRejected = -32003
+	rpcLimitExceeded       = -32005
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Data    *rpcErrorData `json:"data,omitempty"`
+}
+
+// rpcErrorData carries the claim error code and HTTP status the REST endpoint would answer with.
+type rpcErrorData struct {
+	Code   string `json:"code,omitempty"`
+	Status int    `json:"status"`
+}
+
+// rpcHandler serves faucet_claim and faucet_info as JSON-RPC 2.0 methods. Calls run through the
+// claim and info handlers, so they pass the same validation, captcha and rate limits as REST
+// clients. faucet_claim takes ["0x..."], ["0x...", amount] or a claim object as params.
+type rpcHandler struct {
+	claim        http.Handler
+	info         http.Handler
+	addressField string
+	maxBodySize  int64
+}
+
+func newRPCHandler(claim, info http.Handler, addressField string, maxBodySize int64) http.Handler {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	return allowMethods(&rpcHandler{
+		claim:        claim,
+		info:         info,
+		addressField: addressField,
+		maxBodySize:  maxBodySize,
+	}, http.MethodPost)
+}
+
+func (h *rpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req rpcRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodySize)).Decode(&req); err != nil {
+		renderRPC(w, nil, nil, &rpcError{Code: rpcParseError, Message: "Parse error"})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		renderRPC(w, req.ID, nil, &rpcError{Code: rpcInvalidRequest, Message: "Invalid request"})
+		return
+	}
+
+	switch req.Method {
+	case "faucet_claim":
+		body, err := h.claimBody(req.Params)
+		if err != nil {
+			renderRPC(w, req.ID, nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()})
+			return
+		}
+		result, rpcErr := h.forward(w, h.claim, r, http.MethodPost, body)
+		renderRPC(w, req.ID, result, rpcErr)
+	case "faucet_info":
+		result, rpcErr := h.forward(w, h.info, r, http.MethodGet, nil)
+		renderRPC(w, req.ID, result, rpcErr)
+	default:
+		renderRPC(w, req.ID, nil, &rpcError{Code: rpcMethodNotFound, Message: "Method not found"})
+	}
+}
+
+// claimBody builds the REST claim body from positional or named params.
+func (h *rpcHandler) claimBody(params json.RawMessage) ([]byte, error) {
+	var positional []json.RawMessage
+	if err := json.Unmarshal(params, &positional); err != nil {
+		var named map[string]json.RawMessage
+		if err := json.Unmarshal(params, &named); err != nil || named == nil {
+			return nil, errors.New("params must be [address], [address, amount] or a claim object")
+		}
+		return params, nil
+	}
+	if len(positional) == 0 || len(positional) > 2 {
+		return nil, errors.New("params must be [address] or [address, amount]")
+	}
+	body := map[string]json.RawMessage{h.addressField: positional[0]}
+	if len(positional) == 2 {
+		body["amount"] = positional[1]
+	}
+	return json.Marshal(body)
+}
+
+// forward runs the call through the REST handler on a copy of the request, keeping its headers
+// and client address, and turns the answer into a result or error. Retry-After is passed on.
+func (h *rpcHandler) forward(w http.ResponseWriter, handler http.Handler, r *http.Request, method string, body []byte) (json.RawMessage, *rpcError) {
+	req := r.Clone(r.Context())
+	req.Method = method
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	rec := &bufferedResponse{header: make(http.Header), code: http.StatusOK}
+	handler.ServeHTTP(rec, req)
+	if retry := rec.header.Get("Retry-After"); retry != "" {
+		w.Header().Set("Retry-After", retry)
+	}
+
+	if rec.code == http.StatusOK || rec.code == http.StatusAccepted {
+		if rec.body.Len() == 0 {
+			return json.RawMessage("null"), nil
+		}
+		return rec.body.Bytes(), nil
+	}
+	var resp claimResponse
+	if err := json.Unmarshal(rec.body.Bytes(), &resp); err != nil {
+		return nil, &rpcError{Code: rpcInternalError, Message: http.StatusText(rec.code)}
+	}
+	return nil, &rpcError{
+		Code:    rpcErrorCode(resp.Code),
+		Message: resp.Message,
+		Data:    &rpcErrorData{Code: resp.Code, Status: rec.code},
+	}
+}
+
+// bufferedResponse keeps what a handler writes so it can be wrapped in the JSON-RPC envelope.
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	b.code = code
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// rpcErrorCode maps claim error codes to JSON-RPC ones.
+func rpcErrorCode(code string) int {
+	switch code {
+	case codeInvalidRequest, codeInvalidAddress, codeInvalidAmount:
+		return rpcInvalidParams
+	case codeRateLimited, codeBudgetExhausted:
+		return rpcLimitExceeded
+	case codeOutOfFunds, codeBusy, codeNodeTimeout, codeNodeUnavailable, codeGasPriceTooHigh, codeCaptchaUnavailable, codeLimitUnavailable:
+		return rpcResourceUnavailable
+	case codeTxFailed, codeRecipientRejected:
+		return rpcTransactionRejected
+	case codeInternal, "":
+		return rpcInternalError
+	default:
+		return rpcServerError
+	}
+}
+
+// renderRPC answers 200 as JSON-RPC over HTTP does, with the outcome in the envelope.
+func renderRPC(w http.ResponseWriter, id json.RawMessage, result json.RawMessage, rpcErr *rpcError) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	resp := rpcResponse{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		resp.Result = result
+	}
+	renderJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRPCHandler(t *testing.T) {
+	claim := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("claim body: %v", err)
+		}
+		switch body["wallet"] {
+		case "0x1":
+			renderJSON(w, claimResponse{Message: "Txhash: 0xabc", TxHash: "0xabc"}, http.StatusOK)
+		case "0x2":
+			w.Header().Set("Retry-After", "60")
+			renderJSON(w, claimResponse{Message: "Wait", Code: codeRateLimited}, http.StatusTooManyRequests)
+		default:
+			renderJSON(w, claimResponse{Message: "Invalid address", Code: codeInvalidAddress}, http.StatusBadRequest)
+		}
+	})
+	info := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("info method = %s, want GET", r.Method)
+		}
+		io.WriteString(w, `{"symbol":"ETH"}`)
+	})
+	handler := newRPCHandler(claim, info, "wallet", 0)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantResult string
+		wantCode   int
+		wantRetry  string
+	}{
+		{name: "claim", body: `{"jsonrpc":"2.0","id":1,"method":"faucet_claim","params":["0x1"]}`, wantResult: `{"msg":"Txhash: 0xabc","tx_hash":"0xabc"}`},
+		{name: "named params", body: `{"jsonrpc":"2.0","id":1,"method":"faucet_claim","params":{"wallet":"0x1"}}`, wantResult: `{"msg":"Txhash: 0xabc","tx_hash":"0xabc"}`},
+		{name: "rate limited", body: `{"jsonrpc":"2.0","id":1,"method":"faucet_claim","params":["0x2"]}`, wantCode: rpcLimitExceeded, wantRetry: "60"},
+		{name: "invalid address", body: `{"jsonrpc":"2.0","id":1,"method":"faucet_claim","params":["0x3"]}`, wantCode: rpcInvalidParams},
+		{name: "no params", body: `{"jsonrpc":"2.0","id":1,"method":"faucet_claim","params":[]}`, wantCode: rpcInvalidParams},
+		{name: "info", body: `{"jsonrpc":"2.0","id":"a","method":"faucet_info"}`, wantResult: `{"symbol":"ETH"}`},
+		{name: "unknown method", body: `{"jsonrpc":"2.0","id":1,"method":"eth_call"}`, wantCode: rpcMethodNotFound},
+		{name: "wrong version", body: `{"jsonrpc":"1.0","id":1,"method":"faucet_info"}`, wantCode: rpcInvalidRequest},
+		{name: "parse error", body: `{`, wantCode: rpcParseError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(tt.body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			var resp struct {
+				Result json.RawMessage `json:"result"`
+				Error  *rpcError       `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode != 0 {
+				if resp.Error == nil || resp.Error.Code != tt.wantCode {
+					t.Errorf("error = %+v, want code %d", resp.Error, tt.wantCode)
+				}
+			} else if resp.Error != nil || strings.TrimSpace(string(resp.Result)) != tt.wantResult {
+				t.Errorf("result = %s, error = %+v, want %s", resp.Result, resp.Error, tt.wantResult)
+			}
+			if retry := w.Header().Get("Retry-After"); retry != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want %q", retry, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Messages holds response templates per language and response ID, e.g. Messages["de"]["RATE_LIMITED"].
+// Failed claims are looked up by their error code, rate limits first by RATE_LIMITED_ADDRESS,
+// RATE_LIMITED_NETWORK or RATE_LIMITED_USER, and successful claims by CLAIM_SENT, CLAIM_PENDING
+// and CLAIM_QUEUED. Their templates may use the placeholders {amount}, {symbol}, {txHash} and
+// {jobId}, rate limit ones {wait}. Responses without a template keep their English text.
+type Messages map[string]map[string]string
+
+// Response IDs of successful claims and of the rate limit reasons.
+const (
+	msgClaimSent          = "CLAIM_SENT"
+	msgClaimPending       = "CLAIM_PENDING"
+	msgClaimQueued        = "CLAIM_QUEUED"
+	msgRateLimitedAddress = "RATE_LIMITED_ADDRESS"
+	msgRateLimitedNetwork = "RATE_LIMITED_NETWORK"
+	msgRateLimitedUser    = "RATE_LIMITED_USER"
+)
+
+// defaultLanguage is used when none of the client's languages has templates.
+const defaultLanguage = "en"
+
+// LoadMessages reads the templates from a JSON file of the form {"de": {"CLAIM_SENT": "..."}}.
+func LoadMessages(path string) (Messages, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw Messages
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	messages := make(Messages, len(raw))
+	for lang, templates := range raw {
+		messages[strings.ToLower(lang)] = templates
+	}
+	return messages, nil
+}
+
+// ServeHTTP selects the templates of the language asked for by the lang query parameter or
+// the Accept-Language header for the handlers rendering the response.
+func (m Messages) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if templates := m.lookup(r); templates != nil {
+		r = r.WithContext(context.WithValue(r.Context(), messagesContextKey, templates))
+	}
+	next(w, r)
+}
+
+// lookup returns the templates of the client's most preferred language, matching "pt-BR" to
+// "pt" when only the base language is configured.
+func (m Messages) lookup(r *http.Request) map[string]string {
+	for _, lang := range requestLanguages(r) {
+		if templates, ok := m[lang]; ok {
+			return templates
+		}
+		if base, _, found := strings.Cut(lang, "-"); found {
+			if templates, ok := m[base]; ok {
+				return templates
+			}
+		}
+	}
+	return m[defaultLanguage]
+}
+
+// requestLanguages lists the lang parameter followed by the Accept-Language tags by preference.
+func requestLanguages(r *http.Request) []string {
+	type tag struct {
+		lang    string
+		quality float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if lang != "" && lang != "*" && quality > 0 {
+			tags = append(tags, tag{strings.ToLower(lang), quality})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+
+	var langs []string
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		langs = append(langs, strings.ToLower(lang))
+	}
+	for _, t := range tags {
+		langs = append(langs, t.lang)
+	}
+	return langs
+}
+
+// localize returns the template of the first of ids the request's language has with args
+// filled in, or the English fallback.
+func localize(r *http.Request, fallback string, args map[string]string, ids ...string) string {
+	templates, _ := r.Context().Value(messagesContextKey).(map[string]string)
+	for _, id := range ids {
+		template, ok := templates[id]
+		if id == "" || !ok {
+			continue
+		}
+		pairs := make([]string, 0, 2*len(args))
+		for name, value := range args {
+			pairs = append(pairs, "{"+name+"}", value)
+		}
+		return strings.NewReplacer(pairs...).Replace(template)
+	}
+	return fallback
+}
+
+// renderFailure answers a failed request with its code and English message, or the template
+// configured for the code in the client's language.
+func renderFailure(w http.ResponseWriter, r *http.Request, code, message string, status int) {
+	renderJSON(w, claimResponse{Message: localize(r, message, nil, code), Code: code}, status)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+func TestMessages(t *testing.T) {
+	messages := Messages{
+		"de": {
+			codeRateLimited: "Bitte warte {wait}",
+			codeDenied:      "Nicht erlaubt",
+		},
+		"pt": {codeDenied: "Não permitido"},
+		"en": {codeDenied: "Go away"},
+	}
+	tests := []struct {
+		name     string
+		target   string
+		language string
+		render   func(w http.ResponseWriter, r *http.Request)
+		want     string
+	}{
+		{
+			name:     "placeholder",
+			target:   "/claim",
+			language: "de-DE,de;q=0.9",
+			render: func(w http.ResponseWriter, r *http.Request) {
+				renderRateLimited(w, r, limitedAddress, 90*time.Second, 0)
+			},
+			want: "Bitte warte 1 minute 30 seconds",
+		},
+		{
+			name:     "lang parameter wins",
+			target:   "/claim?lang=pt",
+			language: "de",
+			render: func(w http.ResponseWriter, r *http.Request) {
+				renderFailure(w, r, codeDenied, "Denied", http.StatusForbidden)
+			},
+			want: "Não permitido",
+		},
+		{
+			name:     "quality order",
+			target:   "/claim",
+			language: "fr;q=0.8, pt-BR;q=0.9, de;q=0.1",
+			render: func(w http.ResponseWriter, r *http.Request) {
+				renderFailure(w, r, codeDenied, "Denied", http.StatusForbidden)
+			},
+			want: "Não permitido",
+		},
+		{
+			name:     "english templates",
+			target:   "/claim",
+			language: "fr",
+			render: func(w http.ResponseWriter, r *http.Request) {
+				renderFailure(w, r, codeDenied, "Denied", http.StatusForbidden)
+			},
+			want: "Go away",
+		},
+		{
+			name:     "no template",
+			target:   "/claim",
+			language: "pt",
+			render: func(w http.ResponseWriter, r *http.Request) {
+				renderRateLimited(w, r, limitedAddress, time.Minute, 0)
+			},
+			want: "This address has already claimed recently. Please wait 1 minute before you try again",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := negroni.New(messages)
+			n.UseHandlerFunc(tt.render)
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			r.Header.Set("Accept-Language", tt.language)
+			w := httptest.NewRecorder()
+			n.ServeHTTP(w, r)
+
+			var resp claimResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Message != tt.want {
+				t.Errorf("msg = %q, want %q", resp.Message, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+var (
+	claimsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "faucet_claims_total",
+		Help: "Number of claims that were successfully funded.",
+	})
+	rateLimitedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "faucet_rate_limited_total",
+		Help: "Number of claims rejected by the rate limiter.",
+	})
+	storeErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "faucet_store_errors_total",
+		Help: "Number of rate limit store reads and writes that failed.",
+	})
+	captchaFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "faucet_captcha_failures_total",
+		Help: "Number of claims rejected by captcha verification.",
+	})
+	captchaOverloadsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "faucet_captcha_overloads_total",
+		Help: "Number of claims rejected because the maximum of concurrent captcha verifications was reached.",
+	})
+	txErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "faucet_tx_errors_total",
+		Help: "Number of transactions that failed to send, by error class.",
+	}, []string{"class"})
+)
+
+// txErrorClass buckets send errors into a small set of labels so they can be alerted on.
+func txErrorClass(err error) string {
+	switch {
+	case errors.Is(err, chain.ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.Is(err, chain.ErrGasLimitExceeded) || errors.Is(err, chain.ErrGasTooHigh):
+		return "gas_limit"
+	case chain.IsReplacementUnderpriced(err):
+		return "replacement"
+	case errors.Is(err, chain.ErrSendThrottled):
+		return "throttled"
+	case errors.Is(err, chain.ErrNonceTooLow) || errors.Is(err, chain.ErrNonceTooHigh):
+		return "nonce"
+	case errors.Is(err, chain.ErrTxReverted):
+		return "reverted"
+	case errors.Is(err, chain.ErrNodeUnavailable):
+		return "unavailable"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "other"
+	}
+}
+
+// balanceCollector reports the faucet wallet balance cached for the info endpoint, so scrapes
+// query the node at most once per infoCacheTTL. Senders of several wallets, such as
+// chain.SignerPool, also report the balance of each wallet.
+type balanceCollector struct {
+	faucet     *Faucet
+	desc       *prometheus.Desc
+	walletDesc *prometheus.Desc
+}
+
+type walletLister interface {
+	Wallets(ctx context.Context) ([]chain.Wallet, error)
+}
+
+func newBalanceCollector(faucet *Faucet, network string) *balanceCollector {
+	return &balanceCollector{
+		faucet: faucet,
+		desc: prometheus.NewDesc(
+			"faucet_wallet_balance_wei",
+			"Balance of the faucet wallet in wei, summed over the wallets of a pool.",
+			nil,
+			prometheus.Labels{"network": network},
+		),
+		walletDesc: prometheus.NewDesc(
+			"faucet_pool_wallet_balance_wei",
+			"Balance of each wallet of the faucet's wallet pool in wei.",
+			[]string{"account"},
+			prometheus.Labels{"network": network},
+		),
+	}
+}
+
+func (c *balanceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+	ch <- c.walletDesc
+}
+
+func (c *balanceCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	balance, err := c.faucet.balance.get(ctx, c.faucet.rpcTimeout(), c.faucet.Balance)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read faucet balance")
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	value, _ := new(big.Float).SetInt(balance).Float64()
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, value)
+
+	pool, ok := c.faucet.TxBuilder.(walletLister)
+	if !ok {
+		return
+	}
+	wallets, err := pool.Wallets(ctx)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read pool wallet balances")
+		return
+	}
+	for _, wallet := range wallets {
+		value, _ := new(big.Float).SetInt(wallet.Balance).Float64()
+		ch <- prometheus.MustNewConstMetric(c.walletDesc, prometheus.GaugeValue, value, wallet.Address.Hex())
+	}
+}
+
+// totalsCollector reads the lifetime totals of a faucet from its counters on every scrape.
+type totalsCollector struct {
+	totals        *Totals
+	tokens        []TokenPayout
+	claimsDesc    *prometheus.Desc
+	dispensedDesc *prometheus.Desc
+}
+
+func newTotalsCollector(totals *Totals, tokens []TokenPayout, network string) *totalsCollector {
+	return &totalsCollector{
+		totals: totals,
+		tokens: tokens,
+		claimsDesc: prometheus.NewDesc(
+			"faucet_lifetime_claims_total",
+			"Claims funded over the lifetime of the totals store, across restarts.",
+			nil,
+			prometheus.Labels{"network": network},
+		),
+		dispensedDesc: prometheus.NewDesc(
+			"faucet_lifetime_dispensed_total",
+			"Base units sent over the lifetime of the totals store, asset is native or the token address.",
+			[]string{"asset"},
+			prometheus.Labels{"network": network},
+		),
+	}
+}
+
+func (c *totalsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.claimsDesc
+	ch <- c.dispensedDesc
+}
+
+func (c *totalsCollector) Collect(ch chan<- prometheus.Metric) {
+	totals, err := c.totals.read(c.tokens)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read lifetime totals")
+		ch <- prometheus.NewInvalidMetric(c.claimsDesc, err)
+		return
+	}
+	counter := func(desc *prometheus.Desc, amount *big.Int, labels ...string) {
+		value, _ := new(big.Float).SetInt(amount).Float64()
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labels...)
+	}
+	counter(c.claimsDesc, totals.claims)
+	counter(c.dispensedDesc, totals.native, "native")
+	for token, amount := range totals.tokens {
+		counter(c.dispensedDesc, amount, token)
+	}
+}
+
+func registerCollector(collector prometheus.Collector) {
+	if err := prometheus.Register(collector); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			log.WithError(err).Warn("Failed to register metric collector")
+		}
+	}
+}
@@ -1,169 +1,998 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math"
-	"net"
+	"hash/fnv"
+	"math/big"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/jellydator/ttlcache/v2"
-	"github.com/kataras/hcaptcha"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
 )
 
-type Limiter struct {
-	mutex      sync.Mutex
-	cache      *ttlcache.Cache
-	proxyCount int
-	ttl        time.Duration
+// ClaimReader decodes and validates the claim request once, so later
+// middlewares and the claim handler can read it from the request context.
+type ClaimReader struct {
+	resolve        NameResolver
+	minAmount      float64
+	maxAmount      float64
+	strictChecksum bool
+	blocked        *AccessList
+	addressFields  []string
+	maxBodySize    int64
+	// shortName is the EIP-3770 prefix addresses may carry, prefixed addresses are rejected when empty
+	shortName string
+	// format parses recipient addresses, hex ones as strictChecksum says unless set
+	format chain.AddressFormat
+	// chainID is the chain EIP-681 payment requests must name, if they name one
+	chainID *big.Int
 }
 
-func NewLimiter(proxyCount int, ttl time.Duration) *Limiter {
-	cache := ttlcache.NewCache()
-	cache.SkipTTLExtensionOnHit(true)
-	return &Limiter{
-		cache:      cache,
-		proxyCount: proxyCount,
-		ttl:        ttl,
+// DefaultMaxBodySize bounds claim request bodies, which only carry an address and an amount.
+const DefaultMaxBodySize = 4 << 10
+
+type ClaimReaderOption func(*ClaimReader)
+
+// WithMaxBodySize answers claims with bodies larger than the given number of bytes with 413.
+func WithMaxBodySize(bytes int64) ClaimReaderOption {
+	return func(c *ClaimReader) {
+		if bytes > 0 {
+			c.maxBodySize = bytes
+		}
 	}
 }
 
-func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	address, err := readAddress(r)
+// WithAddressFields reads the address from the first of the given JSON fields or query parameters
+// present in the claim, instead of "address".
+func WithAddressFields(fields ...string) ClaimReaderOption {
+	return func(c *ClaimReader) {
+		if len(fields) > 0 {
+			c.addressFields = fields
+		}
+	}
+}
+
+// WithChainShortName accepts EIP-3770 addresses such as "gno:0x..." whose prefix is the given
+// short name, addresses prefixed with another chain are rejected.
+func WithChainShortName(name string) ClaimReaderOption {
+	return func(c *ClaimReader) {
+		c.shortName = name
+	}
+}
+
+// WithChainID rejects EIP-681 payment requests such as "ethereum:0x...@1" naming another chain
+// than chainID. Requests naming no chain are accepted either way.
+func WithChainID(chainID *big.Int) ClaimReaderOption {
+	return func(c *ClaimReader) {
+		c.chainID = chainID
+	}
+}
+
+// WithAddressFormat accepts the recipient addresses of format, such as bech32 ones, instead of
+// only hex addresses. A nil format keeps the hex addresses of EVM chains.
+func WithAddressFormat(format chain.AddressFormat) ClaimReaderOption {
+	return func(c *ClaimReader) {
+		c.format = format
+	}
+}
+
+// NewClaimReader creates the claim reader, a nil resolver disables ENS name resolution.
+// Claims may request any amount within [minAmount, maxAmount] instead of the default payout.
+// With strictChecksum only EIP-55 checksummed addresses are accepted, otherwise any valid
+// hex address is normalized to its checksummed form. Claims to blocked addresses are rejected.
+func NewClaimReader(resolve NameResolver, minAmount, maxAmount float64, strictChecksum bool, blocked *AccessList, opts ...ClaimReaderOption) *ClaimReader {
+	reader := &ClaimReader{
+		resolve:        resolve,
+		minAmount:      minAmount,
+		maxAmount:      maxAmount,
+		strictChecksum: strictChecksum,
+		blocked:        blocked,
+		addressFields:  []string{"address"},
+		maxBodySize:    DefaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(reader)
+	}
+	if reader.format == nil {
+		reader.format = chain.EVMAddressFormat(strictChecksum)
+	}
+	return reader
+}
+
+func (c *ClaimReader) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	claim, err := c.readClaim(w, r)
 	if err != nil {
-		var mr *malformedRequest
-		if errors.As(err, &mr) {
-			renderJSON(w, claimResponse{Message: mr.message}, mr.status)
-		} else {
-			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+		renderError(w, r, err)
+		return
+	}
+
+	next.ServeHTTP(w, withClaim(r, claim))
+}
+
+// allowMethods answers requests with other methods than the given ones with 405 and the Allow
+// header, before any claim middleware or handler reads them.
+func allowMethods(h http.Handler, methods ...string) http.Handler {
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if r.Method == method {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		renderFailure(w, r, codeMethodNotAllowed, fmt.Sprintf("Method %s not allowed, use %s", r.Method, allow), http.StatusMethodNotAllowed)
+	})
+}
+
+// notFound answers requests for unknown API routes, the JSON counterpart of http.NotFound.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	renderFailure(w, r, codeNotFound, "Not found", http.StatusNotFound)
+}
+
+type Limiter struct {
+	// shards serialize the check and record of a claim per key, so unrelated clients do not contend
+	shards     [limiterShards]sync.Mutex
+	store      Store
+	resolver   *ClientIPResolver
+	ipv6Prefix int
+	addressTTL time.Duration
+	ipTTL      time.Duration
+	ipBuckets  int
+	// sliding restarts the window of a limited key on every rejected claim
+	sliding bool
+	keys    KeyStrategy
+	privacy *LogPrivacy
+	// waitRounding is the granularity waits are shown to users in
+	waitRounding time.Duration
+	// failClosed rejects claims while the store cannot be read, instead of letting them through
+	failClosed bool
+	// bucket limits by token buckets of addressBurst and ipBurst claims instead of fixed windows
+	bucket       bool
+	addressBurst int
+	ipBurst      int
+	// newAddressTTL replaces addressTTL for claims of new addresses when positive
+	newAddressTTL time.Duration
+
+	// inflight holds the keys of claims being sent, which are only recorded once they succeed.
+	// Entries are added and removed under the shard lock of their key, or IP key for buckets.
+	inflightMu sync.Mutex
+	inflight   map[string]chan struct{}
+
+	// listMu guards swapping the lists, the lists themselves are never mutated
+	listMu    sync.RWMutex
+	allowlist *AccessList
+	denylist  *AccessList
+}
+
+const (
+	DefaultIPBuckets  = 4
+	DefaultIPv6Prefix = 64
+
+	limiterShards = 64
+)
+
+type LimiterOption func(*Limiter)
+
+// KeyStrategy maps the address and IP key of a claim to the keys its address cooldown and
+// IP buckets are recorded under, an empty network key leaves the IP buckets out.
+type KeyStrategy func(address, ipKey string) (addressKey, networkKey string)
+
+// KeyAddressOrIP limits the address and the IP separately, a claim is rejected once either
+// of them has claimed. This is the default.
+func KeyAddressOrIP(address, ipKey string) (string, string) {
+	return address, ipKey
+}
+
+// KeyAddressAndIP gives every address its own cooldown per IP, so clients sharing an IP,
+// such as a classroom behind one NAT, do not use up each other's claims. The IP buckets
+// do not apply, an address may claim again from another network.
+func KeyAddressAndIP(address, ipKey string) (string, string) {
+	return address + "@" + ipKey, ""
+}
+
+// limitKeys maps the Config.LimitKey settings to their strategy.
+var limitKeys = map[string]KeyStrategy{
+	LimitKeyEither: KeyAddressOrIP,
+	LimitKeyPair:   KeyAddressAndIP,
+}
+
+// WithKeyStrategy sets how claims are keyed, KeyAddressOrIP when nil.
+func WithKeyStrategy(keys KeyStrategy) LimiterOption {
+	return func(l *Limiter) {
+		if keys != nil {
+			l.keys = keys
+		}
+	}
+}
+
+// WithSlidingWindow restarts the cooldown whenever a limited client claims again, instead of
+// letting it expire a fixed window after the funded claim. Clients hammering the faucet stay
+// locked out until they pause for a full window, at the cost of also punishing impatient users.
+func WithSlidingWindow(enabled bool) LimiterOption {
+	return func(l *Limiter) {
+		l.sliding = enabled
+	}
+}
+
+// WithTokenBucket limits claims by token buckets instead of fixed windows. An address may claim
+// addressBurst times at once and gains another claim every addressTTL, an IP may claim ipBurst
+// times at once and gains another claim every ipTTL/ipBuckets, so clients get a burst and then a
+// steady drip at the average rate of the windows. An addressBurst below 1 allows a single claim
+// at once, an ipBurst below 1 allows ipBuckets. The bucket of a key is its theoretical arrival
+// time, kept as the key's TTL as in ReadLimiter.
+func WithTokenBucket(addressBurst, ipBurst int) LimiterOption {
+	return func(l *Limiter) {
+		l.bucket = true
+		l.addressBurst = max(addressBurst, 1)
+		l.ipBurst = ipBurst
+		if ipBurst < 1 {
+			l.ipBurst = l.ipBuckets
+		}
+	}
+}
+
+// WithNewAddressInterval sets the address cooldown of claims to new addresses, see
+// Faucet.checkNewAddress, 0 gives them the normal one.
+func WithNewAddressInterval(ttl time.Duration) LimiterOption {
+	return func(l *Limiter) {
+		l.newAddressTTL = ttl
+	}
+}
+
+// WithWaitRounding rounds the wait shown in rate limit messages up to a multiple of granularity,
+// e.g. a minute or an hour. Cooldowns and Retry-After stay precise.
+func WithWaitRounding(granularity time.Duration) LimiterOption {
+	return func(l *Limiter) {
+		l.waitRounding = granularity
+	}
+}
+
+// WithStoreFailure sets how claims are handled while the store fails to read or write, StoreFailOpen
+// lets them through unlimited and StoreFailClosed rejects them with 503. Failures are logged either way.
+func WithStoreFailure(policy string) LimiterOption {
+	return func(l *Limiter) {
+		l.failClosed = policy == StoreFailClosed
+	}
+}
+
+// WithKeyPrefix namespaces the address, IP and bucket keys of the limiter, so limiters sharing
+// a store with different prefixes keep separate cooldowns and those with the same prefix share them.
+func WithKeyPrefix(prefix string) LimiterOption {
+	return func(l *Limiter) {
+		if prefix != "" {
+			l.store = newPrefixedStore(l.store, prefix)
 		}
+	}
+}
+
+// WithLogPrivacy masks the addresses and client IPs the limiter logs.
+func WithLogPrivacy(privacy *LogPrivacy) LimiterOption {
+	return func(l *Limiter) {
+		l.privacy = privacy
+	}
+}
+
+// WithIPv6Prefix limits IPv6 clients per network of the given prefix length rather than per address.
+func WithIPv6Prefix(bits int) LimiterOption {
+	return func(l *Limiter) {
+		if bits > 0 && bits <= 128 {
+			l.ipv6Prefix = bits
+		}
+	}
+}
+
+// NewLimiter creates a limiter allowing ipBuckets claims per IP within ipTTL,
+// and one claim per address within addressTTL. Addresses and IPs on the allowlist are never limited,
+// those on the denylist are always rejected. Clients are identified by resolver.
+func NewLimiter(store Store, resolver *ClientIPResolver, addressTTL, ipTTL time.Duration, ipBuckets int, allowlist, denylist *AccessList, opts ...LimiterOption) *Limiter {
+	if ipBuckets < 1 {
+		ipBuckets = 1
+	}
+	limiter := &Limiter{
+		store:      store,
+		resolver:   resolver,
+		addressTTL: addressTTL,
+		ipTTL:      ipTTL,
+		ipBuckets:  ipBuckets,
+		ipv6Prefix: DefaultIPv6Prefix,
+		keys:       KeyAddressOrIP,
+		allowlist:  allowlist,
+		denylist:   denylist,
+		inflight:   make(map[string]chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(limiter)
+	}
+	return limiter
+}
+
+// NewLimiterWithTTL creates a limiter that applies the same window to addresses and IPs.
+func NewLimiterWithTTL(store Store, resolver *ClientIPResolver, ttl time.Duration) *Limiter {
+	return NewLimiter(store, resolver, ttl, ttl, DefaultIPBuckets, nil, nil)
+}
+
+func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	claim := claimFromRequest(r)
+	address := claim.Address
+	clintIP := l.ClientIP(r)
+	allowlist, denylist := l.accessLists()
+	if denylist.ContainsAddress(address) || denylist.ContainsIP(clintIP) {
+		log.WithContext(r.Context()).WithFields(log.Fields{
+			"address":  l.privacy.mask(address),
+			"clientIP": l.privacy.mask(clintIP),
+		}).Warn("Rejected denylisted claim")
+		renderFailure(w, r, codeDenied, "This address or network is not allowed to claim from the faucet", http.StatusForbidden)
 		return
 	}
 
-	if l.ttl <= 0 {
+	if l.addressTTL <= 0 && l.ipTTL <= 0 {
 		next.ServeHTTP(w, r)
 		return
 	}
 
-	clintIP := getClientIPFromRequest(l.proxyCount, r)
-	l.mutex.Lock()
+	if allowlist.ContainsAddress(address) || allowlist.ContainsIP(clintIP) {
+		next.ServeHTTP(w, r)
+		return
+	}
 
-	if l.limitByKey(w, address) {
-		l.mutex.Unlock()
+	addressKey, ipKey := l.keys(address, l.ipKey(clintIP))
+	var hold *claimHold
+	for hold == nil {
+		unlock := l.lock(addressKey, ipKey)
+		ipTTL, buckets, err := l.ipState(ipKey)
+		var reason limitReason
+		var wait time.Duration
+		if err == nil {
+			reason, wait, err = l.blocked(addressKey, ipTTL, buckets)
+		}
+		if err != nil {
+			unlock()
+			renderError(w, r, err)
+			return
+		}
+		if wait > 0 {
+			if l.sliding && !l.bucket {
+				if wait, err = l.restart(reason, addressKey, ipKey); err != nil {
+					unlock()
+					renderError(w, r, err)
+					return
+				}
+			}
+			unlock()
+			rateLimitedTotal.Inc()
+			renderRateLimited(w, r, reason, wait, l.waitRounding)
+			return
+		}
+
+		var busy <-chan struct{}
+		hold, busy, err = l.holdClaim(addressKey, ipKey, buckets)
+		if err == nil && hold != nil {
+			var ok bool
+			if ok, err = l.verify(hold, addressKey, ipKey); !ok {
+				// The next round rejects the claim, or picks another free bucket
+				l.release(hold, false)
+				hold = nil
+			}
+		}
+		unlock()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		if hold != nil {
+			break
+		}
+		if busy == nil {
+			continue
+		}
+		// Another claim for the address or the last free IP buckets is being sent, its outcome
+		// decides whether this one is limited
+		select {
+		case <-busy:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	next.ServeHTTP(w, r)
+	if claim.newAddress {
+		l.newAddressTier(hold, addressKey, address)
+	}
+	// Queued claims answer 202 and are recorded like funded ones
+	status := w.(negroni.ResponseWriter).Status()
+	granted := status == http.StatusOK || status == http.StatusAccepted
+	if claim.outcome != outcomeUnknown {
+		granted = claim.outcome == outcomeSent
+	}
+	l.settle(hold, granted)
+	if !granted {
 		return
 	}
+	log.WithContext(r.Context()).WithFields(log.Fields{
+		"address":  l.privacy.mask(address),
+		"clientIP": l.privacy.mask(clintIP),
+	}).Debug("Claim granted, rate limit recorded")
+}
 
-	if l.checklimitByKey(w, clintIP).Seconds() > 0 {
-		ttl := min(
-			l.checklimitByKey(w, clintIP+"-0").Seconds(),
-			l.checklimitByKey(w, clintIP+"-1").Seconds(),
-			l.checklimitByKey(w, clintIP+"-2").Seconds(),
-			l.checklimitByKey(w, clintIP+"-3").Seconds(),
-		)
+// claimHold is a claim in flight. Its keys are recorded once it succeeds, until then concurrent
+// claims for them wait for its outcome, so a claim that fails never limits anyone. Claims of
+// other instances sharing the store are kept out by a pending entry of every held key.
+type claimHold struct {
+	locks   []string
+	held    []string
+	records map[string]time.Duration
+	// tokens are the spacings the buckets of token bucket keys advance by once granted
+	tokens map[string]time.Duration
+	// pending are the held keys reserved in the store
+	pending []string
+	done    chan struct{}
+}
 
-		if ttl > 0 {
-			errMsg := fmt.Sprintf("You have exceeded the rate limit. Please wait %s before you try again", math.Round(ttl))
-			renderJSON(w, claimResponse{Message: errMsg}, http.StatusTooManyRequests)
+// pendingTTL bounds how long a claim in flight reserves its keys in the store, so the keys of an
+// instance that died mid-claim are released in the end. It outlasts the send and receipt wait of a claim.
+const pendingTTL = 10 * time.Minute
 
-			l.mutex.Unlock()
-			return
+// pendingPollInterval is how often a claim waiting for a claim in flight on another instance
+// checks whether it settled.
+var pendingPollInterval = 100 * time.Millisecond
+
+func pendingKey(key string) string {
+	return "pending:" + key
+}
+
+// pendingElsewhere returns a channel closed once a claim should check again whether the claim
+// of another instance holding its key settled.
+func pendingElsewhere() <-chan struct{} {
+	c := make(chan struct{})
+	time.AfterFunc(pendingPollInterval, func() { close(c) })
+	return c
+}
+
+// reservePending reserves key in the store for h, it reports false when a claim of another
+// instance holds it. Store failures follow the fail policy, failing open holds the key in this
+// process only.
+func (l *Limiter) reservePending(h *claimHold, key string) (bool, error) {
+	ok, err := l.store.SetIfAbsent(pendingKey(key), pendingTTL)
+	if err != nil {
+		storeErrorsTotal.Inc()
+		log.WithError(err).WithField("failClosed", l.failClosed).Error("Failed to reserve rate limit key")
+		if l.failClosed {
+			return false, errLimitUnavailable
+		}
+		return true, nil
+	}
+	if ok {
+		h.pending = append(h.pending, key)
+	}
+	return ok, nil
+}
+
+func (l *Limiter) releasePending(h *claimHold) {
+	for _, key := range h.pending {
+		if err := l.store.Remove(pendingKey(key)); err != nil {
+			log.WithError(err).Warn("Failed to release rate limit key, it expires with its reservation")
+		}
+	}
+	h.pending = nil
+}
+
+// verify checks the limits of a claim again once its keys are reserved in the store, since
+// another instance may have recorded a claim for them after they were first checked.
+// The caller must hold their lock.
+func (l *Limiter) verify(h *claimHold, addressKey, ipKey string) (bool, error) {
+	ipTTL, buckets, err := l.ipState(ipKey)
+	if err != nil {
+		return false, err
+	}
+	if _, wait, err := l.blocked(addressKey, ipTTL, buckets); err != nil || wait > 0 {
+		return false, err
+	}
+	if !l.bucket {
+		// The IP bucket held must still be free, others may have been taken meanwhile
+		for _, key := range h.held {
+			if ttl, err := l.checklimitByKey(key); err != nil || ttl > 0 {
+				return false, err
+			}
 		}
 	}
+	return true, nil
+}
 
-	l.cache.SetWithTTL(address, true, l.ttl)
-	l.cache.SetWithTTL(clintIP, true, l.ttl)
+// holdClaim holds the address key and a free IP bucket for a claim, the caller must hold their
+// lock and have checked the recorded limits. When a claim in flight holds the address or all
+// free buckets, nothing is held and the channel closed when it settles is returned instead.
+func (l *Limiter) holdClaim(addressKey, ipKey string, buckets []time.Duration) (*claimHold, <-chan struct{}, error) {
+	if l.bucket {
+		return l.holdTokens(addressKey, ipKey)
+	}
+	h := &claimHold{locks: []string{addressKey, ipKey}, records: make(map[string]time.Duration), done: make(chan struct{})}
+	// A zero TTL would make ttlcache keep the entry forever, so only record enabled windows
+	if l.addressTTL > 0 {
+		if busy := l.busy(addressKey); busy != nil {
+			return nil, busy, nil
+		}
+		ok, err := l.reservePending(h, addressKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			return nil, pendingElsewhere(), nil
+		}
+		h.held = append(h.held, addressKey)
+		h.records[addressKey] = l.addressTTL
+	}
+	if l.ipTTL > 0 && ipKey != "" {
+		var busy <-chan struct{}
+		for i := 0; i < l.ipBuckets; i++ {
+			if len(buckets) > 0 && buckets[i] > 0 {
+				continue
+			}
+			key := bucketKey(ipKey, i)
+			if busy = l.busy(key); busy != nil {
+				continue
+			}
+			ok, err := l.reservePending(h, key)
+			if err != nil {
+				l.releasePending(h)
+				return nil, nil, err
+			}
+			if ok {
+				h.held = append(h.held, key)
+				h.records[key] = l.ipTTL
+				break
+			}
+			busy = pendingElsewhere()
+		}
+		if busy != nil {
+			l.releasePending(h)
+			return nil, busy, nil
+		}
+		h.records[ipKey] = l.ipTTL
+	}
+	l.hold(h)
+	return h, nil, nil
+}
 
-	if l.checklimitByKey(w, clintIP+"-0").Seconds() <= 0 {
-		l.cache.SetWithTTL(clintIP+"-0", true, l.ttl)
-	} else if l.checklimitByKey(w, clintIP+"-1").Seconds() <= 0 {
-		l.cache.SetWithTTL(clintIP+"-1", true, l.ttl)
-	} else if l.checklimitByKey(w, clintIP+"-2").Seconds() <= 0 {
-		l.cache.SetWithTTL(clintIP+"-2", true, l.ttl)
-	} else if l.checklimitByKey(w, clintIP+"-3").Seconds() <= 0 {
-		l.cache.SetWithTTL(clintIP+"-3", true, l.ttl)
+// newAddressTier gives a claim that Faucet.checkNewAddress found to be of a new address its
+// cooldown, and records the address with it so it is never treated as new again.
+func (l *Limiter) newAddressTier(h *claimHold, addressKey, address string) {
+	if l.newAddressTTL > 0 {
+		if _, ok := h.records[addressKey]; ok {
+			h.records[addressKey] = l.newAddressTTL
+		}
+		if _, ok := h.tokens[addressKey]; ok {
+			h.tokens[addressKey] = l.newAddressTTL
+		}
 	}
+	h.records[newAddressKey(address)] = newAddressMemory
+}
 
-	l.mutex.Unlock()
+// holdTokens holds the address and IP keys of a claim in token bucket mode. Its buckets are only
+// advanced when it settles, so unlike IP buckets the IP key is held for the whole claim.
+func (l *Limiter) holdTokens(addressKey, ipKey string) (*claimHold, <-chan struct{}, error) {
+	h := &claimHold{locks: []string{addressKey, ipKey}, records: make(map[string]time.Duration), tokens: make(map[string]time.Duration), done: make(chan struct{})}
+	if l.addressTTL > 0 {
+		h.held = append(h.held, addressKey)
+		h.tokens[addressKey] = l.addressTTL
+	}
+	if l.ipTTL > 0 && ipKey != "" {
+		h.held = append(h.held, ipKey)
+		h.tokens[ipKey] = l.ipSpacing()
+	}
+	for _, key := range h.held {
+		if busy := l.busy(key); busy != nil {
+			return nil, busy, nil
+		}
+	}
+	for _, key := range h.held {
+		ok, err := l.reservePending(h, key)
+		if err != nil || !ok {
+			l.releasePending(h)
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, pendingElsewhere(), nil
+		}
+	}
+	l.hold(h)
+	return h, nil, nil
+}
 
-	next.ServeHTTP(w, r)
-	if w.(negroni.ResponseWriter).Status() != http.StatusOK {
-		l.cache.Remove(address)
-		l.cache.Remove(clintIP)
+// reserve holds a claim for every key with the address window, unless one of them is still limited,
+// in which case nothing is held and the limited key is returned with its remaining wait. The claim
+// must be settled with its outcome, and is only recorded if it succeeded.
+func (l *Limiter) reserve(ctx context.Context, keys ...string) (string, time.Duration, *claimHold, error) {
+	for {
+		unlock := l.lock(keys...)
+		key, ttl, err := l.limitedKey(keys)
+		if err != nil || ttl > 0 {
+			unlock()
+			return key, ttl, nil, err
+		}
+		h := &claimHold{locks: keys, records: make(map[string]time.Duration), done: make(chan struct{})}
+		var busy <-chan struct{}
+		for _, key := range keys {
+			if busy = l.busy(key); busy != nil {
+				break
+			}
+		}
+		// A zero TTL would make ttlcache keep the entry forever
+		if busy == nil && l.addressTTL > 0 {
+			for _, key := range keys {
+				ok, err := l.reservePending(h, key)
+				if err != nil {
+					l.releasePending(h)
+					unlock()
+					return "", 0, nil, err
+				}
+				if !ok {
+					l.releasePending(h)
+					busy = pendingElsewhere()
+					break
+				}
+			}
+		}
+		if busy == nil && len(h.pending) > 0 {
+			// Another instance may have recorded a claim for the keys since they were checked
+			if key, ttl, err := l.limitedKey(keys); err != nil || ttl > 0 {
+				l.releasePending(h)
+				unlock()
+				return key, ttl, nil, err
+			}
+		}
+		if busy == nil && l.addressTTL > 0 {
+			h.held = keys
+			if l.bucket {
+				h.tokens = make(map[string]time.Duration)
+			}
+			for _, key := range keys {
+				if l.bucket {
+					h.tokens[key] = l.addressTTL
+				} else {
+					h.records[key] = l.addressTTL
+				}
+			}
+			l.hold(h)
+		}
+		unlock()
+		if busy == nil {
+			return "", 0, h, nil
+		}
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			return "", 0, nil, ctx.Err()
+		}
+	}
+}
+
+// limitedKey returns the first of keys still limited and its wait, the caller must hold their lock.
+func (l *Limiter) limitedKey(keys []string) (string, time.Duration, error) {
+	for _, key := range keys {
+		ttl, err := l.checklimitByKey(key)
+		if err != nil {
+			return "", 0, err
+		}
+		if ttl = l.addressWait(ttl); ttl > 0 {
+			if l.sliding && !l.bucket {
+				if err := l.setlimitByKey(key, l.addressTTL); err != nil {
+					return "", 0, err
+				}
+				ttl = l.addressTTL
+			}
+			return key, ttl, nil
+		}
+	}
+	return "", 0, nil
+}
+
+// busy returns the channel of the claim in flight for key, nil when there is none.
+func (l *Limiter) busy(key string) <-chan struct{} {
+	l.inflightMu.Lock()
+	defer l.inflightMu.Unlock()
+	return l.inflight[key]
+}
+
+func (l *Limiter) hold(h *claimHold) {
+	l.inflightMu.Lock()
+	defer l.inflightMu.Unlock()
+	for _, key := range h.held {
+		l.inflight[key] = h.done
+	}
+}
+
+// settle records the keys of a held claim if it was granted and releases them to waiting claims.
+// The record is written before the release, so waiters see it when they check again.
+func (l *Limiter) settle(h *claimHold, granted bool) {
+	if h == nil {
 		return
 	}
-	log.WithFields(log.Fields{
-		"address":  address,
-		"clientIP": clintIP,
-	}).Info("Maximum request limit has been reached")
+	defer l.lock(h.locks...)()
+	l.release(h, granted)
 }
 
-func (l *Limiter) checklimitByKey(w http.ResponseWriter, key string) time.Duration {
-	if _, ttl, err := l.cache.GetWithTTL(key); err == nil {
-		return ttl
+// release is settle for callers holding the locks of h. The records are written before the
+// keys are released in the store too, so claims of other instances reserving them next see them.
+// A granted claim was sent already, so records that fail to write are only logged.
+func (l *Limiter) release(h *claimHold, granted bool) {
+	if granted {
+		for key, ttl := range h.records {
+			l.setlimitByKey(key, ttl)
+		}
+		for key, spacing := range h.tokens {
+			// Held keys are not written meanwhile, so the bucket is advanced from its current state
+			ttl, _ := l.checklimitByKey(key)
+			l.setlimitByKey(key, ttl+spacing)
+		}
 	}
-	return 0
+	l.releasePending(h)
+	l.inflightMu.Lock()
+	for _, key := range h.held {
+		delete(l.inflight, key)
+	}
+	l.inflightMu.Unlock()
+	close(h.done)
+}
+
+// SetAccessLists atomically replaces the allowlist and denylist, it is safe to call while serving.
+func (l *Limiter) SetAccessLists(allowlist, denylist *AccessList) {
+	l.listMu.Lock()
+	defer l.listMu.Unlock()
+	l.allowlist = allowlist
+	l.denylist = denylist
+}
+
+func (l *Limiter) accessLists() (*AccessList, *AccessList) {
+	l.listMu.RLock()
+	defer l.listMu.RUnlock()
+	return l.allowlist, l.denylist
+}
+
+// ClientIP returns the client IP the limiter keys the request by.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	return l.resolver.ClientIP(r)
+}
+
+// networkKey returns the key the network of the request's client is limited by.
+func (l *Limiter) networkKey(r *http.Request) string {
+	return l.ipKey(l.ClientIP(r))
 }
 
-func (l *Limiter) limitByKey(w http.ResponseWriter, key string) bool {
-	if _, ttl, err := l.cache.GetWithTTL(key); err == nil {
-		errMsg := fmt.Sprintf("You have exceeded the rate limit. Please wait %s before you try again", ttl.Round(time.Second))
-		renderJSON(w, claimResponse{Message: errMsg}, http.StatusTooManyRequests)
-		return true
+// Remaining reports how long the address and client IP have to wait before their
+// next claim is accepted. It only reads the cache and never records a claim.
+func (l *Limiter) Remaining(address, clientIP string) (time.Duration, error) {
+	addressKey, ipKey := l.keys(address, l.ipKey(clientIP))
+	defer l.lock(addressKey, ipKey)()
+
+	ttl, err := l.checklimitByKey(addressKey)
+	if err != nil {
+		return 0, err
+	}
+	ipTTL, buckets, err := l.ipState(ipKey)
+	if err != nil {
+		return 0, err
 	}
-	return false
+	return max(l.addressWait(ttl), l.networkWait(ipTTL, buckets)), nil
 }
 
-func getClientIPFromRequest(proxyCount int, r *http.Request) string {
-	if proxyCount > 0 {
-		xForwardedFor := r.Header.Get("X-Forwarded-For")
-		if xForwardedFor != "" {
-			xForwardedForParts := strings.Split(xForwardedFor, ",")
-			// Avoid reading the user's forged request header by configuring the count of reverse proxies
-			partIndex := len(xForwardedForParts) - proxyCount
-			if partIndex < 0 {
-				partIndex = 0
+// lock acquires the shards of the given keys in index order, so concurrent callers
+// locking overlapping shards cannot deadlock. IP bucket keys share the shard of their IP key.
+func (l *Limiter) lock(keys ...string) (unlock func()) {
+	var held [limiterShards]bool
+	for _, key := range keys {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		held[h.Sum32()%limiterShards] = true
+	}
+	for i := range held {
+		if held[i] {
+			l.shards[i].Lock()
+		}
+	}
+	return func() {
+		for i := range held {
+			if held[i] {
+				l.shards[i].Unlock()
 			}
-			return strings.TrimSpace(xForwardedForParts[partIndex])
 		}
 	}
+}
 
-	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+// ipKey masks IPv6 addresses to the configured prefix, so rotating addresses within
+// one network shares a single limit. IPv4 addresses are used as they are.
+func (l *Limiter) ipKey(clientIP string) string {
+	addr, err := netip.ParseAddr(clientIP)
 	if err != nil {
-		remoteIP = r.RemoteAddr
+		return clientIP
 	}
-	return remoteIP
+	if addr.Is4In6() {
+		return addr.Unmap().String()
+	}
+	if !addr.Is6() {
+		return clientIP
+	}
+
+	prefix, err := addr.WithZone("").Prefix(l.ipv6Prefix)
+	if err != nil {
+		return clientIP
+	}
+	return prefix.String()
 }
 
-type Captcha struct {
-	client *hcaptcha.Client
-	secret string
+// ipState reads the TTLs of the IP key and its buckets, each once. The IP key is renewed with
+// every claim and outlives all buckets, so they are only read while it is set.
+func (l *Limiter) ipState(ipKey string) (time.Duration, []time.Duration, error) {
+	if ipKey == "" {
+		return 0, nil, nil
+	}
+	ipTTL, err := l.checklimitByKey(ipKey)
+	if err != nil || ipTTL <= 0 || l.bucket {
+		return ipTTL, nil, err
+	}
+	buckets := make([]time.Duration, l.ipBuckets)
+	for i := range buckets {
+		if buckets[i], err = l.checklimitByKey(bucketKey(ipKey, i)); err != nil {
+			return 0, nil, err
+		}
+	}
+	return ipTTL, buckets, nil
 }
 
-func NewCaptcha(hcaptchaSiteKey, hcaptchaSecret string) *Captcha {
-	client := hcaptcha.New(hcaptchaSecret)
-	client.SiteKey = hcaptchaSiteKey
-	return &Captcha{
-		client: client,
-		secret: hcaptchaSecret,
+// ipWait returns how long until one of the IP buckets frees up, or zero when one is available.
+func ipWait(ipTTL time.Duration, buckets []time.Duration) time.Duration {
+	if ipTTL <= 0 || freeBucket(buckets) >= 0 {
+		return 0
+	}
+	wait := buckets[0]
+	for _, ttl := range buckets[1:] {
+		wait = min(wait, ttl)
 	}
+	return wait
 }
 
-func (c *Captcha) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	if c.secret == "" {
-		next.ServeHTTP(w, r)
-		return
+// bucketWait returns how long until a token bucket of burst tokens, one every spacing, holds a token
+// again, given the TTL of its theoretical arrival time. Zero means a claim may be taken now.
+func bucketWait(ttl, spacing time.Duration, burst int) time.Duration {
+	return max(ttl+spacing-time.Duration(burst)*spacing, 0)
+}
+
+// ipSpacing is how often an IP gains a token in token bucket mode, the average rate of its buckets.
+func (l *Limiter) ipSpacing() time.Duration {
+	return l.ipTTL / time.Duration(l.ipBuckets)
+}
+
+// addressWait returns how long an address whose key has ttl left waits for its next claim.
+func (l *Limiter) addressWait(ttl time.Duration) time.Duration {
+	if l.bucket && ttl > 0 {
+		return bucketWait(ttl, l.addressTTL, l.addressBurst)
 	}
+	return ttl
+}
 
-	response := c.client.VerifyToken(r.Header.Get("h-captcha-response"))
-	if !response.Success {
-		renderJSON(w, claimResponse{Message: "Captcha verification failed, please try again"}, http.StatusTooManyRequests)
-		return
+// networkWait returns how long an IP whose key and buckets have the given TTLs waits for its next claim.
+func (l *Limiter) networkWait(ipTTL time.Duration, buckets []time.Duration) time.Duration {
+	if l.bucket && ipTTL > 0 {
+		return bucketWait(ipTTL, l.ipSpacing(), l.ipBurst)
 	}
+	return ipWait(ipTTL, buckets)
+}
 
-	next.ServeHTTP(w, r)
+// freeBucket returns the first bucket without a claim, or -1 when all are taken.
+// Without bucket TTLs every bucket is free.
+func freeBucket(buckets []time.Duration) int {
+	if len(buckets) == 0 {
+		return 0
+	}
+	for i, ttl := range buckets {
+		if ttl <= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func bucketKey(clientIP string, i int) string {
+	return clientIP + "-" + strconv.Itoa(i)
+}
+
+// tokenKey is the key the cooldown of a bundle token is recorded under for address.
+func tokenKey(address, token string) string {
+	return address + "/" + strings.ToLower(token)
+}
+
+// newAddressMemory is how long an address that was funded as new is remembered as such.
+const newAddressMemory = 10 * 365 * 24 * time.Hour
+
+func newAddressKey(address string) string {
+	return "newaddress:" + address
+}
+
+// newAddressGranted reports whether address was already funded as a new address.
+func (l *Limiter) newAddressGranted(address string) (bool, error) {
+	ttl, err := l.checklimitByKey(newAddressKey(address))
+	return ttl > 0, err
+}
+
+// tokenWait returns how long address has to wait for its next payout of token, zero when it is due.
+func (l *Limiter) tokenWait(address, token string) (time.Duration, error) {
+	return l.checklimitByKey(tokenKey(address, token))
+}
+
+// recordToken starts the cooldown of token for address once it was sent.
+func (l *Limiter) recordToken(address, token string, cooldown time.Duration) {
+	// The token was sent already, a failed write is only logged
+	l.setlimitByKey(tokenKey(address, token), cooldown)
+}
+
+// checklimitByKey returns the remaining window of key, zero when it is not set. A store that
+// fails to read is logged, and limits nothing unless the limiter fails closed.
+func (l *Limiter) checklimitByKey(key string) (time.Duration, error) {
+	ttl, err := l.store.Get(key)
+	if err == nil {
+		return ttl, nil
+	}
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	storeErrorsTotal.Inc()
+	log.WithError(err).WithField("failClosed", l.failClosed).Error("Failed to read rate limit state")
+	if l.failClosed {
+		return 0, errLimitUnavailable
+	}
+	return 0, nil
+}
+
+// setlimitByKey records key for ttl. A store that fails to write is logged, and rejects the
+// claim being checked when the limiter fails closed.
+func (l *Limiter) setlimitByKey(key string, ttl time.Duration) error {
+	err := l.store.SetWithTTL(key, ttl)
+	if err == nil {
+		return nil
+	}
+	storeErrorsTotal.Inc()
+	log.WithError(err).WithField("failClosed", l.failClosed).Error("Failed to write rate limit state")
+	if l.failClosed {
+		return errLimitUnavailable
+	}
+	return nil
+}
+
+// restart extends the window of the keys that limited a claim to its full length and returns
+// the new wait, the caller must hold their lock.
+func (l *Limiter) restart(reason limitReason, addressKey, ipKey string) (time.Duration, error) {
+	if reason == limitedAddress {
+		return l.addressTTL, l.setlimitByKey(addressKey, l.addressTTL)
+	}
+	keys := []string{ipKey}
+	for i := 0; i < l.ipBuckets; i++ {
+		keys = append(keys, bucketKey(ipKey, i))
+	}
+	for _, key := range keys {
+		if err := l.setlimitByKey(key, l.ipTTL); err != nil {
+			return 0, err
+		}
+	}
+	return l.ipTTL, nil
+}
+
+// blocked returns the wait of the key that blocks a claim and which one it is,
+// the address cooldown taking precedence over the IP buckets.
+func (l *Limiter) blocked(addressKey string, ipTTL time.Duration, buckets []time.Duration) (limitReason, time.Duration, error) {
+	ttl, err := l.checklimitByKey(addressKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	if wait := l.addressWait(ttl); wait > 0 {
+		return limitedAddress, wait, nil
+	}
+	return limitedNetwork, l.networkWait(ipTTL, buckets), nil
 }
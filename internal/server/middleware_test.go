@@ -0,0 +1,805 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/negroni"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestLimiterRateLimitMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		addressTTL  time.Duration
+		ipTTL       time.Duration
+		nextAddress string
+		want        string
+		wantRetry   string
+	}{
+		{name: "address limited", addressTTL: 2 * time.Hour, ipTTL: time.Minute, nextAddress: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: "This address has already claimed recently. Please wait 2 hours before you try again", wantRetry: "7200"},
+		{name: "ip limited", addressTTL: time.Minute, ipTTL: 10 * time.Minute, nextAddress: "0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984", want: "Too many claims from your network. Please wait 10 minutes before you try again", wantRetry: "600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLimiter(NewMemoryStore(), nil, tt.addressTTL, tt.ipTTL, 1, nil, nil)
+			handler := negroni.New(limiter)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			claim := func(address string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+				req.RemoteAddr = "1.2.3.4:5678"
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: address}))
+				return w
+			}
+			if w := claim("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"); w.Code != http.StatusOK {
+				t.Fatalf("first claim status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			w := claim(tt.nextAddress)
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("second claim status = %d, want %d", w.Code, http.StatusTooManyRequests)
+			}
+			if retry := w.Header().Get("Retry-After"); retry != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want %q", retry, tt.wantRetry)
+			}
+			var resp claimResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(resp.Message, tt.want) || strings.Contains(resp.Message, "%!") {
+				t.Errorf("message = %q, want it to contain %q", resp.Message, tt.want)
+			}
+			if resp.Code != codeRateLimited {
+				t.Errorf("code = %q, want %q", resp.Code, codeRateLimited)
+			}
+		})
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	tests := []struct {
+		wait        time.Duration
+		granularity time.Duration
+		want        string
+	}{
+		{wait: 90 * time.Second, want: "1 minute 30 seconds"},
+		{wait: time.Hour + 30*time.Minute + 20*time.Second, want: "1 hour 31 minutes"},
+		{wait: 23*time.Hour + 59*time.Minute + 58*time.Second, want: "1 day"},
+		{wait: 23*time.Hour + 10*time.Minute, granularity: time.Hour, want: "1 day"},
+		{wait: 5*time.Hour + time.Second, granularity: time.Hour, want: "6 hours"},
+		{wait: 40 * time.Second, granularity: time.Minute, want: "1 minute"},
+	}
+	for _, tt := range tests {
+		mr := errRateLimited(limitedAddress, tt.wait, tt.granularity)
+		if got := mr.args["wait"]; got != tt.want {
+			t.Errorf("wait %v rounded to %v = %q, want %q", tt.wait, tt.granularity, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterIPBuckets(t *testing.T) {
+	addresses := []string{
+		"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+		"0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984",
+		"0x6B175474E89094C44Da98b954EedeAC495271d0F",
+		"0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+	}
+	tests := []struct {
+		name      string
+		ipTTL     time.Duration
+		ipBuckets int
+		allowlist []string
+		statuses  []int // handler answers, one per claim
+		want      []int
+	}{
+		{name: "single bucket", ipTTL: time.Hour, ipBuckets: 1, statuses: []int{200, 200}, want: []int{200, 429}},
+		{name: "three buckets", ipTTL: time.Hour, ipBuckets: 3, statuses: []int{200, 200, 200, 200}, want: []int{200, 200, 200, 429}},
+		{name: "queued claims count", ipTTL: time.Hour, ipBuckets: 2, statuses: []int{202, 200, 200}, want: []int{202, 200, 429}},
+		{name: "failed claim frees ip", ipTTL: time.Hour, ipBuckets: 1, statuses: []int{500, 200, 200}, want: []int{500, 200, 429}},
+		{name: "ip window disabled", ipTTL: 0, ipBuckets: 1, statuses: []int{200, 200, 200}, want: []int{200, 200, 200}},
+		{name: "allowlisted ip", ipTTL: time.Hour, ipBuckets: 1, allowlist: []string{"1.2.3.0/24"}, statuses: []int{200, 200}, want: []int{200, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowlist, err := NewAccessList(tt.allowlist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			limiter := NewLimiter(NewMemoryStore(), nil, time.Hour, tt.ipTTL, tt.ipBuckets, allowlist, nil)
+
+			for i, status := range tt.statuses {
+				handler := negroni.New(limiter)
+				handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(status)
+				})
+				req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+				req.RemoteAddr = "1.2.3.4:5678"
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: addresses[i]}))
+				if w.Code != tt.want[i] {
+					t.Errorf("claim %d status = %d, want %d", i, w.Code, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterConcurrentFailure(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), nil, time.Hour, time.Hour, 1, nil, nil)
+	sending := make(chan struct{})
+	failed := make(chan struct{})
+	var calls atomic.Int32
+	handler := negroni.New(limiter)
+	handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(sending)
+			<-failed
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	claim := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+		req.RemoteAddr = "1.2.3.4:5678"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}))
+		return w.Code
+	}
+
+	first := make(chan int)
+	go func() { first <- claim() }()
+	<-sending
+	second := make(chan int)
+	go func() { second <- claim() }()
+	select {
+	case code := <-second:
+		t.Fatalf("concurrent claim answered %d while the first was being sent, want it to wait", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(failed)
+	if code := <-first; code != http.StatusInternalServerError {
+		t.Fatalf("first claim status = %d, want 500", code)
+	}
+	if code := <-second; code != http.StatusOK {
+		t.Errorf("concurrent claim status = %d, want 200 after the first failed", code)
+	}
+	if code := claim(); code != http.StatusTooManyRequests {
+		t.Errorf("third claim status = %d, want 429 after the second succeeded", code)
+	}
+
+	user, _, hold, err := limiter.reserve(context.Background(), "user")
+	if err != nil || user != "" {
+		t.Fatalf("reserve() = %q, %v, want the claim held", user, err)
+	}
+	limiter.settle(hold, false)
+	if key, wait, hold, _ := limiter.reserve(context.Background(), "user"); key != "" || wait > 0 {
+		t.Errorf("reserve() after a failed claim = %q, %v, want it granted", key, wait)
+	} else {
+		limiter.settle(hold, true)
+	}
+	if key, wait, _, _ := limiter.reserve(context.Background(), "user"); key != "user" || wait <= 0 {
+		t.Errorf("reserve() after a funded claim = %q, %v, want the user limited", key, wait)
+	}
+}
+
+func TestLimiterSharedStore(t *testing.T) {
+	store := NewMemoryStore()
+	// Two instances of the faucet sharing the store
+	replicas := []*Limiter{
+		NewLimiter(store, nil, time.Hour, time.Hour, 1, nil, nil),
+		NewLimiter(store, nil, time.Hour, time.Hour, 1, nil, nil),
+	}
+	sending := make(chan struct{})
+	outcome := make(chan int)
+	var calls atomic.Int32
+	handlers := make([]http.Handler, len(replicas))
+	for i, limiter := range replicas {
+		handler := negroni.New(limiter)
+		handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				close(sending)
+				w.WriteHeader(<-outcome)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+		handlers[i] = handler
+	}
+	claim := func(replica int, address, ip string) int {
+		req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+		req.RemoteAddr = ip + ":5678"
+		w := httptest.NewRecorder()
+		handlers[replica].ServeHTTP(w, withClaim(req, &claimRequest{Address: address}))
+		return w.Code
+	}
+
+	for _, tt := range []struct {
+		address string
+		ips     [2]string
+		first   int
+		want    int
+	}{
+		{address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", ips: [2]string{"1.2.3.4", "5.6.7.8"}, first: http.StatusInternalServerError, want: http.StatusOK},
+		{address: "0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984", ips: [2]string{"1.2.3.5", "5.6.7.9"}, first: http.StatusOK, want: http.StatusTooManyRequests},
+	} {
+		calls.Store(0)
+		sending = make(chan struct{})
+		first := make(chan int)
+		go func() { first <- claim(0, tt.address, tt.ips[0]) }()
+		<-sending
+		// The same address from another IP on the other instance
+		second := make(chan int)
+		go func() { second <- claim(1, tt.address, tt.ips[1]) }()
+		select {
+		case code := <-second:
+			t.Fatalf("claim on the other instance answered %d while the first was being sent, want it to wait", code)
+		case <-time.After(50 * time.Millisecond):
+		}
+		outcome <- tt.first
+		if code := <-first; code != tt.first {
+			t.Fatalf("first claim status = %d, want %d", code, tt.first)
+		}
+		if code := <-second; code != tt.want {
+			t.Errorf("claim on the other instance after a first claim answered %d = %d, want %d", tt.first, code, tt.want)
+		}
+	}
+}
+
+func TestLimiterClaimOutcome(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), nil, time.Hour, 0, 1, nil, nil)
+	handler := negroni.New(limiter)
+	handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The claim sent its transaction but failed afterwards, or its client went away
+		claimFromRequest(r).outcome = outcomeSent
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	claim := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}))
+		return w.Code
+	}
+	claim()
+	if code := claim(); code != http.StatusTooManyRequests {
+		t.Errorf("claim after one that sent funds status = %d, want 429", code)
+	}
+}
+
+func TestLimiterTokenCooldown(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), nil, time.Hour, time.Hour, 1, nil, nil, WithKeyPrefix("sepolia"))
+	address := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	token := "0x6B175474E89094C44Da98b954EedeAC495271d0F"
+	if wait, err := limiter.tokenWait(address, token); err != nil || wait != 0 {
+		t.Fatalf("tokenWait() = %v, %v, want the token due", wait, err)
+	}
+	limiter.recordToken(address, strings.ToLower(token), 24*time.Hour)
+	if wait, _ := limiter.tokenWait(address, token); wait <= time.Hour {
+		t.Errorf("tokenWait() = %v, want the token cooldown regardless of case", wait)
+	}
+	if wait, _ := limiter.tokenWait(address, "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"); wait != 0 {
+		t.Errorf("other token wait = %v, want it due", wait)
+	}
+	if wait, _ := limiter.Remaining(address, "1.2.3.4"); wait != 0 {
+		t.Errorf("Remaining() = %v, want token cooldowns to leave the claim cooldown alone", wait)
+	}
+
+	msg := coolingDownMessage([]tokenCooldown{{Address: token, wait: 5 * time.Hour}})
+	if want := "Not sent, still cooling down: " + token + " for 5 hours"; msg != want {
+		t.Errorf("coolingDownMessage() = %q, want %q", msg, want)
+	}
+}
+
+func BenchmarkLimiterParallel(b *testing.B) {
+	limiter := NewLimiter(NewMemoryStore(), nil, time.Hour, time.Hour, DefaultIPBuckets, nil, nil)
+	handler := negroni.New(limiter)
+	handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var counter atomic.Uint64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			// A fixed pool of clients keeps the cache size stable, most claims hit the limit check
+			n := counter.Add(1) % 4096
+			req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+			req.RemoteAddr = fmt.Sprintf("10.%d.%d.%d:5678", byte(n>>16), byte(n>>8), byte(n))
+			address := common.BigToAddress(new(big.Int).SetUint64(n)).Hex()
+			handler.ServeHTTP(httptest.NewRecorder(), withClaim(req, &claimRequest{Address: address}))
+		}
+	})
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), nil, time.Hour, time.Hour, 4, nil, nil, WithTokenBucket(2, 3))
+	handler := negroni.New(limiter)
+	handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	claim := func(address string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+		req.RemoteAddr = "1.2.3.4:5678"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: address}))
+		return w
+	}
+
+	steps := []struct {
+		address   string
+		want      int
+		wantRetry string
+	}{
+		{address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusOK},
+		{address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusOK},
+		// The address burst is used up, it gains a claim every hour
+		{address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusTooManyRequests, wantRetry: "3600"},
+		{address: "0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984", want: http.StatusOK},
+		// The IP burst is used up, it gains one of its 4 claims per hour every 15 minutes
+		{address: "0x6B175474E89094C44Da98b954EedeAC495271d0F", want: http.StatusTooManyRequests, wantRetry: "900"},
+	}
+	for i, step := range steps {
+		w := claim(step.address)
+		if w.Code != step.want {
+			t.Fatalf("claim %d status = %d, want %d", i, w.Code, step.want)
+		}
+		if retry := w.Header().Get("Retry-After"); retry != step.wantRetry {
+			t.Errorf("claim %d Retry-After = %q, want %q", i, retry, step.wantRetry)
+		}
+	}
+	wait, err := limiter.Remaining("0x6B175474E89094C44Da98b954EedeAC495271d0F", "1.2.3.4")
+	if err != nil || wait <= 14*time.Minute || wait > 15*time.Minute {
+		t.Errorf("Remaining() = %v, %v, want the 15 minutes until the next IP token", wait, err)
+	}
+}
+
+func TestLimiterNewAddress(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), nil, 24*time.Hour, 0, 1, nil, nil, WithNewAddressInterval(time.Hour))
+	var newAddress bool
+	handler := negroni.New(limiter)
+	handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Addresses are checked behind the limiter, as Faucet.checkNewAddress does
+		claimFromRequest(r).newAddress = newAddress
+		w.WriteHeader(http.StatusOK)
+	})
+	claim := func(address string, isNew bool) *httptest.ResponseRecorder {
+		newAddress = isNew
+		req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: address}))
+		return w
+	}
+
+	fresh, established := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984"
+	if w := claim(fresh, true); w.Code != http.StatusOK {
+		t.Fatalf("claim of a new address status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := claim(established, false); w.Code != http.StatusOK {
+		t.Fatalf("claim of an established address status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := claim(fresh, true); w.Header().Get("Retry-After") != "3600" {
+		t.Errorf("new address Retry-After = %q, want the 3600 seconds of the new address cooldown", w.Header().Get("Retry-After"))
+	}
+	if w := claim(established, false); w.Header().Get("Retry-After") != "86400" {
+		t.Errorf("established address Retry-After = %q, want 86400", w.Header().Get("Retry-After"))
+	}
+
+	if granted, err := limiter.newAddressGranted(fresh); err != nil || !granted {
+		t.Errorf("newAddressGranted() of the funded new address = %v, %v, want true", granted, err)
+	}
+	if granted, err := limiter.newAddressGranted(established); err != nil || granted {
+		t.Errorf("newAddressGranted() of an established address = %v, %v, want false", granted, err)
+	}
+}
+
+func TestLimiterSlidingWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		sliding bool
+		want    string
+	}{
+		{name: "fixed window", sliding: false, want: "Please wait 1 minute before"},
+		{name: "sliding window", sliding: true, want: "Please wait 1 hour before"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			limiter := NewLimiter(store, nil, time.Hour, 0, 1, nil, nil, WithSlidingWindow(tt.sliding))
+			handler := negroni.New(limiter)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			// The address claimed 59 minutes ago
+			address := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+			store.SetWithTTL(address, time.Minute)
+
+			req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: address}))
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("message = %s, want it to contain %q", w.Body.String(), tt.want)
+			}
+			if ttl, _ := store.Get(address); tt.sliding != (ttl > time.Minute) {
+				t.Errorf("address window = %v after a rejected claim", ttl)
+			}
+		})
+	}
+}
+
+func TestLimiterKeyStrategy(t *testing.T) {
+	students := []string{
+		"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+		"0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984",
+		"0x6B175474E89094C44Da98b954EedeAC495271d0F",
+	}
+	tests := []struct {
+		name string
+		keys KeyStrategy
+		want []int // the three students, then the first one again
+	}{
+		{name: "address or ip", keys: KeyAddressOrIP, want: []int{200, 429, 429, 429}},
+		{name: "address and ip", keys: KeyAddressAndIP, want: []int{200, 200, 200, 429}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLimiter(NewMemoryStore(), nil, time.Hour, time.Hour, 1, nil, nil, WithKeyStrategy(tt.keys))
+			handler := negroni.New(limiter)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			for i, address := range append(students, students[0]) {
+				req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+				req.RemoteAddr = "1.2.3.4:5678"
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: address}))
+				if w.Code != tt.want[i] {
+					t.Errorf("claim %d status = %d, want %d", i, w.Code, tt.want[i])
+				}
+			}
+			if wait, _ := limiter.Remaining(students[0], "1.2.3.4"); wait <= 0 {
+				t.Errorf("Remaining = %v, want the address cooldown", wait)
+			}
+		})
+	}
+}
+
+func TestAllowMethods(t *testing.T) {
+	tests := []struct {
+		method    string
+		want      int
+		wantAllow string
+	}{
+		{method: http.MethodPost, want: http.StatusOK},
+		{method: http.MethodGet, want: http.StatusMethodNotAllowed, wantAllow: "POST"},
+		{method: http.MethodPut, want: http.StatusMethodNotAllowed, wantAllow: "POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			var reached bool
+			handler := allowMethods(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				w.WriteHeader(http.StatusOK)
+			}), http.MethodPost)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, "/v2/faucet/request", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if allow := w.Header().Get("Allow"); allow != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", allow, tt.wantAllow)
+			}
+			if reached != (tt.want == http.StatusOK) {
+				t.Errorf("handler reached = %v", reached)
+			}
+		})
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	s := NewServer(&Config{})
+	w := httptest.NewRecorder()
+	s.dispatch(w, httptest.NewRequest(http.MethodGet, "/api/unknown/info", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	var resp claimResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codeNotFound {
+		t.Errorf("response = %q, want JSON with code %s", w.Body.String(), codeNotFound)
+	}
+}
+
+func TestLimiterKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes [2]string
+		want     int // status of the claim on the second chain
+	}{
+		{name: "isolated", prefixes: [2]string{"rollup-a:", "rollup-b:"}, want: http.StatusOK},
+		{name: "shared", prefixes: [2]string{"", ""}, want: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			var w *httptest.ResponseRecorder
+			for _, prefix := range tt.prefixes {
+				limiter := NewLimiter(store, nil, time.Hour, time.Hour, 1, nil, nil, WithKeyPrefix(prefix))
+				handler := negroni.New(limiter)
+				handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				})
+				req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+				req.RemoteAddr = "1.2.3.4:5678"
+				w = httptest.NewRecorder()
+				handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}))
+			}
+			if w.Code != tt.want {
+				t.Errorf("second chain status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// failingStore fails every read, as Redis does while it is unreachable.
+type failingStore struct {
+	*MemoryStore
+}
+
+func (s failingStore) Get(key string) (time.Duration, error) {
+	return 0, errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+}
+
+func TestLimiterStoreFailure(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   int
+		code   string
+	}{
+		{policy: StoreFailOpen, want: http.StatusOK},
+		{policy: StoreFailClosed, want: http.StatusServiceUnavailable, code: codeLimitUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			store := failingStore{NewMemoryStore()}
+			limiter := NewLimiter(store, nil, time.Hour, time.Hour, 1, nil, nil, WithStoreFailure(tt.policy))
+			handler := negroni.New(limiter)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+			req.RemoteAddr = "1.2.3.4:5678"
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"}))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.code != "" {
+				var resp claimResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != tt.code {
+					t.Errorf("response = %+v, want code %s", resp, tt.code)
+				}
+			}
+
+			_, err := limiter.Remaining("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "1.2.3.4")
+			if (err != nil) != (tt.policy == StoreFailClosed) {
+				t.Errorf("Remaining() error = %v, want an error only when failing closed", err)
+			}
+			if _, _, _, err := limiter.reserve(context.Background(), "user"); (err != nil) != (tt.policy == StoreFailClosed) {
+				t.Errorf("reserve() error = %v, want an error only when failing closed", err)
+			}
+		})
+	}
+}
+
+// readOnlyStore fails every write, as a Redis replica or a full disk does.
+type readOnlyStore struct {
+	*MemoryStore
+}
+
+func (s readOnlyStore) SetWithTTL(key string, ttl time.Duration) error {
+	return errors.New("READONLY You can't write against a read only replica.")
+}
+
+func TestLimiterStoreWriteFailure(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   int
+	}{
+		{policy: StoreFailOpen, want: http.StatusTooManyRequests},
+		{policy: StoreFailClosed, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			memory := NewMemoryStore()
+			limiter := NewLimiter(readOnlyStore{memory}, nil, time.Hour, 0, 1, nil, nil, WithSlidingWindow(true), WithStoreFailure(tt.policy))
+			handler := negroni.New(limiter)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			claim := func(address string) int {
+				req := httptest.NewRequest(http.MethodPost, "/claim", nil)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, withClaim(req, &claimRequest{Address: address}))
+				return w.Code
+			}
+
+			// Restarting the window of a limited address fails to write
+			limited := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+			memory.SetWithTTL(limited, time.Minute)
+			if code := claim(limited); code != tt.want {
+				t.Errorf("limited claim status = %d, want %d", code, tt.want)
+			}
+			// A claim that was sent is answered whatever its record
+			if code := claim("0x1f9840a85d5aF5bf1D1762F925BDADdC4201F984"); code != http.StatusOK {
+				t.Errorf("claim status = %d, want 200 with its record failing to write", code)
+			}
+		})
+	}
+}
+
+func TestClaimReaderChainPrefix(t *testing.T) {
+	tests := []struct {
+		name      string
+		shortName string
+		address   string
+		want      int
+	}{
+		{name: "plain address", shortName: "gno", address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusOK},
+		{name: "matching prefix", shortName: "gno", address: "gno:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusOK},
+		{name: "other chain", shortName: "gno", address: "eth:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusBadRequest},
+		{name: "unknown short name", address: "gno:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusBadRequest},
+		{name: "invalid address", shortName: "gno", address: "gno:0xinvalid", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewClaimReader(nil, 0, 1, false, nil, WithChainShortName(tt.shortName))
+			var got string
+			handler := negroni.New(reader)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = addressFromRequest(r)
+				w.WriteHeader(http.StatusOK)
+			})
+
+			body := fmt.Sprintf(`{"address": %q}`, tt.address)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/claim", strings.NewReader(body)))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want == http.StatusOK && got != "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B" {
+				t.Errorf("address = %q, want it without prefix", got)
+			}
+		})
+	}
+}
+
+func TestClaimReaderPaymentURI(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    int
+	}{
+		{name: "plain address", address: "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", want: http.StatusOK},
+		{name: "matching chain", address: "ethereum:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B@11155111", want: http.StatusOK},
+		{name: "no chain", address: "ethereum:0xab5801a7d398351b8be11c439e05c5b3259aec9b", want: http.StatusOK},
+		{name: "other chain", address: "ethereum:0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B@1", want: http.StatusBadRequest},
+		{name: "invalid address", address: "ethereum:0xinvalid@11155111", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewClaimReader(nil, 0, 1, false, nil, WithChainID(big.NewInt(11155111)))
+			var got string
+			handler := negroni.New(reader)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = addressFromRequest(r)
+				w.WriteHeader(http.StatusOK)
+			})
+
+			body := fmt.Sprintf(`{"address": %q}`, tt.address)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/claim", strings.NewReader(body)))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want == http.StatusOK && got != "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B" {
+				t.Errorf("address = %q, want the address of the request", got)
+			}
+		})
+	}
+}
+
+func TestClaimReaderAddressFormat(t *testing.T) {
+	bech32, err := chain.NewAddressFormat("bech32:evmos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		format  chain.AddressFormat
+		address string
+		want    int
+	}{
+		{name: "hex", address: "0xab5801a7d398351b8be11c439e05c5b3259aec9b", want: http.StatusOK},
+		{name: "bech32 without format", address: "evmos14dvqrf7nnq63hzlpr3peupw9kvje4myms5wfhd", want: http.StatusBadRequest},
+		{name: "bech32", format: bech32, address: "evmos14dvqrf7nnq63hzlpr3peupw9kvje4myms5wfhd", want: http.StatusOK},
+		{name: "hex with format", format: bech32, address: "0xab5801a7d398351b8be11c439e05c5b3259aec9b", want: http.StatusOK},
+		{name: "other prefix", format: bech32, address: "cosmos14dvqrf7nnq63hzlpr3peupw9kvje4myms5wfhd", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewClaimReader(nil, 0, 1, false, nil, WithAddressFormat(tt.format))
+			var got string
+			handler := negroni.New(reader)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = addressFromRequest(r)
+				w.WriteHeader(http.StatusOK)
+			})
+
+			body := fmt.Sprintf(`{"address": %q}`, tt.address)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/claim", strings.NewReader(body)))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want == http.StatusOK && got != "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B" {
+				t.Errorf("address = %q, want the checksummed hex account", got)
+			}
+		})
+	}
+}
+
+func TestClaimReaderTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+		code int
+	}{
+		{name: "trimmed", tag: "  octocat ", want: "octocat", code: http.StatusOK},
+		{name: "unicode", tag: "Projekt Ü", want: "Projekt Ü", code: http.StatusOK},
+		{name: "empty", tag: "", want: "", code: http.StatusOK},
+		{name: "too long", tag: strings.Repeat("a", maxTagLength+1), code: http.StatusBadRequest},
+		{name: "newline", tag: "octocat\nlevel=error", code: http.StatusBadRequest},
+		{name: "control character", tag: "octo\x1b[31mcat", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewClaimReader(nil, 0, 1, false, nil)
+			var got string
+			handler := negroni.New(reader)
+			handler.UseHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = claimFromRequest(r).Tag
+				w.WriteHeader(http.StatusOK)
+			})
+
+			body := fmt.Sprintf(`{"address": "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", "tag": %q}`, tt.tag)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/claim", strings.NewReader(body)))
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if got != tt.want {
+				t.Errorf("tag = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
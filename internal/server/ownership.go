@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DefaultNonceTTL is how long an issued nonce may be signed and submitted.
+const DefaultNonceTTL = 5 * time.Minute
+
+// OwnershipProof requires claims to carry a personal_sign signature of a nonce issued to
+// the client's IP, made by the claimed address. Each nonce is accepted once.
+type OwnershipProof struct {
+	mutex    sync.Mutex
+	store    Store
+	ttl      time.Duration
+	clientIP func(*http.Request) string
+}
+
+func NewOwnershipProof(store Store, ttl time.Duration, clientIP func(*http.Request) string) *OwnershipProof {
+	if ttl <= 0 {
+		ttl = DefaultNonceTTL
+	}
+	return &OwnershipProof{
+		store:    store,
+		ttl:      ttl,
+		clientIP: clientIP,
+	}
+}
+
+// ownershipMessage is the text wallets are asked to sign for nonce.
+func ownershipMessage(nonce string) string {
+	return fmt.Sprintf("Sign this message to prove you own the address claiming from the faucet.\n\nNonce: %s", nonce)
+}
+
+func (p *OwnershipProof) handleNonce() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			renderError(w, r, err)
+			return
+		}
+		nonce := hex.EncodeToString(buf)
+		if err := p.store.SetWithTTL(p.nonceKey(nonce, r), p.ttl); err != nil {
+			renderError(w, r, err)
+			return
+		}
+		renderJSON(w, nonceResponse{
+			Nonce:     nonce,
+			Message:   ownershipMessage(nonce),
+			ExpiresIn: math.Ceil(p.ttl.Seconds()),
+		}, http.StatusOK)
+	}
+}
+
+func (p *OwnershipProof) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	claim := claimFromRequest(r)
+	if claim.Nonce == "" || claim.Signature == "" {
+		renderFailure(w, r, codeSignatureRequired, "Claims must be signed by the address, request a nonce first", http.StatusBadRequest)
+		return
+	}
+	if !p.consume(p.nonceKey(claim.Nonce, r)) {
+		renderFailure(w, r, codeInvalidSignature, "Nonce is invalid or expired, please request a new one", http.StatusBadRequest)
+		return
+	}
+
+	signer, err := recoverSigner(ownershipMessage(claim.Nonce), claim.Signature)
+	if err != nil || signer != common.HexToAddress(claim.Address) {
+		renderFailure(w, r, codeInvalidSignature, "Signature does not match the claimed address", http.StatusForbidden)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// consume reports whether the nonce was issued and removes it, so it cannot be replayed.
+func (p *OwnershipProof) consume(key string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, err := p.store.Get(key); err != nil {
+		return false
+	}
+	return p.store.Remove(key) == nil
+}
+
+func (p *OwnershipProof) nonceKey(nonce string, r *http.Request) string {
+	return "nonce:" + nonce + ":" + p.clientIP(r)
+}
+
+// recoverSigner returns the address that produced an EIP-191 personal_sign signature of message.
+func recoverSigner(message, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("invalid signature length %d", len(sig))
+	}
+	// Wallets return V as 27 or 28, SigToPub expects the recovery ID
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(message)), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
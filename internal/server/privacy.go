@@ -0,0 +1,41 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// LogPrivacy replaces addresses and client IPs in logs by their HMAC, so the claims of one
+// user can still be told apart without logging who they are. Rate limiting keeps using the
+// raw values. A nil LogPrivacy logs values as they are.
+type LogPrivacy struct {
+	key []byte
+}
+
+// NewLogPrivacy returns nil unless enabled. Without a key a random one is drawn, so hashes
+// only match within one run of the process.
+func NewLogPrivacy(enabled bool, key string) *LogPrivacy {
+	if !enabled {
+		return nil
+	}
+	if key != "" {
+		return &LogPrivacy{key: []byte(key)}
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	return &LogPrivacy{key: random}
+}
+
+// mask returns the first 8 bytes of the value's HMAC in hex.
+func (p *LogPrivacy) mask(value string) string {
+	if p == nil || value == "" {
+		return value
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
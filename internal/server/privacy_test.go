@@ -0,0 +1,25 @@
+package server
+
+import "testing"
+
+func TestLogPrivacy(t *testing.T) {
+	const address = "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+	if got := NewLogPrivacy(false, "key").mask(address); got != address {
+		t.Errorf("disabled mask = %q, want the raw address", got)
+	}
+
+	keyed := NewLogPrivacy(true, "key")
+	masked := keyed.mask(address)
+	if masked == address || len(masked) != 16 {
+		t.Errorf("mask = %q, want 16 hex digits", masked)
+	}
+	if again := NewLogPrivacy(true, "key").mask(address); again != masked {
+		t.Errorf("mask with the same key = %q, want %q", again, masked)
+	}
+	if other := NewLogPrivacy(true, "other").mask(address); other == masked {
+		t.Error("masks with different keys match")
+	}
+	if random := NewLogPrivacy(true, "").mask(address); random == masked {
+		t.Error("mask with a random key matches the configured one")
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+const jobResultTTL = 10 * time.Minute
+
+var (
+	ErrQueueFull   = errors.New("transaction queue is full")
+	ErrQueueClosed = errors.New("transaction queue is closed")
+)
+
+type jobStatus string
+
+const (
+	jobPending jobStatus = "pending"
+	jobDone    jobStatus = "done"
+	jobFailed  jobStatus = "failed"
+)
+
+type jobResult struct {
+	status   jobStatus
+	txHashes []string
+	err      error
+	// confirmations is the number of blocks the transactions were confirmed by
+	confirmations uint64
+	// tokens sent with the claim, and those left out while their cooldown lasts
+	tokens      []string
+	coolingDown []tokenCooldown
+}
+
+// broadcast reports whether the job sent anything. A failed job may have sent some of its
+// transactions with their outcome unknown, but a reverted one paid nothing and is rolled back.
+func (r jobResult) broadcast() bool {
+	if errors.Is(r.err, chain.ErrTxReverted) {
+		return false
+	}
+	return r.status != jobFailed || len(r.txHashes) > 0
+}
+
+type job struct {
+	id   string
+	ctx  context.Context
+	run  func(ctx context.Context) jobResult
+	done chan jobResult
+}
+
+// TxQueue decouples claim handlers from the chain sender, so a fixed number of
+// workers bound the load on the node no matter how many claims arrive at once.
+type TxQueue struct {
+	mu      sync.RWMutex
+	closed  bool
+	jobs    chan *job
+	results *ttlcache.Cache
+	workers sync.WaitGroup
+}
+
+func NewTxQueue(workers, size int) *TxQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	results := ttlcache.NewCache()
+	results.SkipTTLExtensionOnHit(true)
+	q := &TxQueue{
+		jobs:    make(chan *job, size),
+		results: results,
+	}
+	q.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Submit enqueues run without blocking and returns ErrQueueFull when there is no capacity left.
+// The job is skipped if ctx is done by the time a worker picks it up.
+func (q *TxQueue) Submit(ctx context.Context, run func(ctx context.Context) jobResult) (*job, error) {
+	j := &job{
+		id:   newJobID(),
+		ctx:  ctx,
+		run:  run,
+		done: make(chan jobResult, 1),
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	select {
+	case q.jobs <- j:
+		q.results.SetWithTTL(j.id, jobResult{status: jobPending}, jobResultTTL)
+		return j, nil
+	default:
+		return nil, ErrQueueFull
+	}
+}
+
+// Result returns the outcome of a submitted job while it is retained.
+func (q *TxQueue) Result(id string) (jobResult, bool) {
+	value, err := q.results.Get(id)
+	if err != nil {
+		return jobResult{}, false
+	}
+	return value.(jobResult), true
+}
+
+// Close stops accepting jobs and waits until the workers finished the queued ones,
+// or returns ctx's error once it is done first.
+func (q *TxQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *TxQueue) work() {
+	defer q.workers.Done()
+	for j := range q.jobs {
+		var result jobResult
+		if err := j.ctx.Err(); err != nil {
+			result = jobResult{status: jobFailed, err: err}
+		} else {
+			result = j.run(j.ctx)
+		}
+		q.results.SetWithTTL(j.id, result, jobResultTTL)
+		j.done <- result
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
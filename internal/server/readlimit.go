@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReadLimiter bounds how often a client may call the read-only endpoints, which look up
+// balances and cooldowns, so scrapers cannot flood the node through them. A client may make
+// up to requests calls at once and one more every window/requests after that. The limit is a
+// GCRA whose theoretical arrival time is kept as the TTL of a single key per client, so each
+// request costs one read and one write of the store.
+type ReadLimiter struct {
+	mutex     sync.Mutex
+	store     Store
+	window    time.Duration
+	spacing   time.Duration
+	clientKey func(*http.Request) string
+}
+
+// NewReadLimiter returns nil, which limits nothing, unless requests and window are positive.
+// clientKey returns the client a request is counted against, such as its IP.
+func NewReadLimiter(store Store, requests int, window time.Duration, clientKey func(*http.Request) string) *ReadLimiter {
+	if requests <= 0 || window <= 0 {
+		return nil
+	}
+	return &ReadLimiter{
+		store:     store,
+		window:    window,
+		spacing:   window / time.Duration(requests),
+		clientKey: clientKey,
+	}
+}
+
+// limit answers requests over the limit with 429 before they reach h.
+func (l *ReadLimiter) limit(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := l.take("read:" + l.clientKey(r)); wait > 0 {
+			log.WithContext(r.Context()).WithField("path", r.URL.Path).Debug("Read request rate limited")
+			w.Header().Set("Retry-After", strconv.FormatInt(retrySeconds(wait), 10))
+			renderError(w, r, &malformedRequest{
+				status:  http.StatusTooManyRequests,
+				code:    codeRateLimited,
+				message: fmt.Sprintf("Too many requests. Please wait %s before you try again", formatDuration(wait)),
+				args:    map[string]string{"wait": formatDuration(wait)},
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// take records a request for key and returns zero, or how long until the next one is allowed.
+// Requests are let through when the store fails, the read endpoints should not break with it.
+func (l *ReadLimiter) take(key string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	ttl, err := l.store.Get(key)
+	if err != nil {
+		ttl = 0
+	}
+	next := ttl + l.spacing
+	if next > l.window {
+		return next - l.window
+	}
+	l.store.SetWithTTL(key, next)
+	return 0
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadLimiter(t *testing.T) {
+	clientIP := func(r *http.Request) string { return r.RemoteAddr }
+	limiter := NewReadLimiter(NewMemoryStore(), 3, time.Minute, clientIP)
+	handler := limiter.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	get := func(ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/info", nil)
+		r.RemoteAddr = ip
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := get("1.2.3.4"); w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want the burst allowed", i, w.Code)
+		}
+	}
+	w := get("1.2.3.4")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429 over the limit", w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "20" {
+		t.Errorf("Retry-After = %q, want one spacing of 20 seconds", retry)
+	}
+	var resp claimResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != codeRateLimited {
+		t.Errorf("response = %+v, want code %s", resp, codeRateLimited)
+	}
+	if w := get("5.6.7.8"); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", w.Code)
+	}
+
+	if NewReadLimiter(NewMemoryStore(), 0, time.Minute, clientIP) != nil {
+		t.Error("limiter with no requests allowed, want nil to disable it")
+	}
+	var disabled *ReadLimiter
+	ok := disabled.limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	rec := httptest.NewRecorder()
+	ok.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/info", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("disabled limiter status = %d, want the handler reached", rec.Code)
+	}
+}
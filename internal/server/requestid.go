@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the ID correlating the log entries of one request. Clients and proxies
+// may set it, requests without a usable one get a random UUID, and responses echo it.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// requestID assigns the request its ID, which entries logged with its context are tagged with.
+// The ID is also set on the request header so the access log can print it.
+func requestID(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	id := r.Header.Get(RequestIDHeader)
+	if !isValidRequestID(id) {
+		id = newRequestID()
+	}
+	r.Header.Set(RequestIDHeader, id)
+	w.Header().Set(RequestIDHeader, id)
+	next(w, r.WithContext(withRequestID(r.Context(), id)))
+}
+
+// isValidRequestID accepts IDs of printable ASCII without spaces, so they cannot break log lines.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random version 4 UUID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// RequestIDHook adds the request ID to entries logged with log.WithContext, including those of
+// the chain package, whose calls for a claim carry the request's context.
+type RequestIDHook struct{}
+
+func (RequestIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (RequestIDHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if id := requestIDFrom(entry.Context); id != "" {
+		entry.Data["requestID"] = id
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFrom(r.Context())
+	}
+	serve := func(header string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+		if header != "" {
+			r.Header.Set(RequestIDHeader, header)
+		}
+		w := httptest.NewRecorder()
+		requestID(w, r, handler)
+		return w
+	}
+
+	w := serve("abc-123")
+	if got := w.Header().Get(RequestIDHeader); got != "abc-123" || seen != "abc-123" {
+		t.Errorf("ID = %q in response, %q in context, want the client's abc-123", got, seen)
+	}
+	for _, header := range []string{"", "has space", "bad\nline"} {
+		w := serve(header)
+		got := w.Header().Get(RequestIDHeader)
+		if len(got) != 36 || got == header || seen != got {
+			t.Errorf("header %q: ID = %q in response, %q in context, want a generated UUID", header, got, seen)
+		}
+	}
+
+	logger, logged := logtest.NewNullLogger()
+	logger.AddHook(RequestIDHook{})
+	logger.WithContext(withRequestID(context.Background(), "abc-123")).Info("claim")
+	if got := logged.LastEntry().Data["requestID"]; got != "abc-123" {
+		t.Errorf("requestID field = %v, want abc-123", got)
+	}
+	logger.Info("startup")
+	if _, ok := logged.LastEntry().Data["requestID"]; ok {
+		t.Error("entry without a request context has a requestID field")
+	}
+}
@@ -2,11 +2,19 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
 
@@ -15,75 +23,343 @@ import (
 )
 
 type Server struct {
-	chain.TxBuilder
-	cfg *Config
+	cfg   *Config
+	store Store
+	cors  *CORS
+	geo   *GeoFilter
+
+	// faucets is the registry of served chains keyed by name, primary answers the unprefixed /api routes
+	faucets map[string]*Faucet
+	order   []*Faucet
+	primary *Faucet
+
+	// ctx is the parent of every request and job, it is cancelled once shutdown gives up waiting
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewServer(builder chain.TxBuilder, cfg *Config) *Server {
+func NewServer(cfg *Config) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
-		TxBuilder: builder,
-		cfg:       cfg,
+		cfg:     cfg,
+		faucets: make(map[string]*Faucet),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// AddFaucet registers a chain served under /api/{name}/. The first faucet added
+// is also served under /api/ and may have an empty name.
+func (s *Server) AddFaucet(builder chain.TxBuilder, chainCfg ChainConfig) error {
+	if chainCfg.Name == "" && s.primary != nil {
+		return errors.New("faucet name is required for additional chains")
+	}
+	if strings.Contains(chainCfg.Name, "/") {
+		return fmt.Errorf("invalid faucet name %q", chainCfg.Name)
+	}
+	if _, ok := s.faucets[chainCfg.Name]; ok && chainCfg.Name != "" {
+		return fmt.Errorf("duplicate faucet name %q", chainCfg.Name)
+	}
+
+	faucet := newFaucet(s.ctx, builder, chainCfg, s.cfg)
+	if s.primary == nil {
+		s.primary = faucet
+	}
+	if chainCfg.Name != "" {
+		s.faucets[chainCfg.Name] = faucet
 	}
+	s.order = append(s.order, faucet)
+	return nil
 }
 
 func (s *Server) setupRouter() *http.ServeMux {
+	if s.primary == nil {
+		log.Fatal("no faucet configured")
+	}
 	router := http.NewServeMux()
 	router.Handle("/", http.FileServer(web.Dist()))
-	limiter := NewLimiter(s.cfg.proxyCount, time.Duration(s.cfg.interval)*time.Minute)
-	hcaptcha := NewCaptcha(s.cfg.hcaptchaSiteKey, s.cfg.hcaptchaSecret)
-	router.Handle("/api/claim", negroni.New(limiter, hcaptcha, negroni.Wrap(s.handleClaim())))
-	router.Handle("/api/info", s.handleInfo())
+	store, err := s.newStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.store = store
+	counters, err := s.newCounters(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	allowlist, denylist, err := s.loadAccessLists()
+	if err != nil {
+		log.Fatal(err)
+	}
+	trusted, err := s.trustedProxies()
+	if err != nil {
+		log.Fatal(err)
+	}
+	blocked, err := NewAccessList(append(burnAddresses, s.cfg.BlockedAddresses...))
+	if err != nil {
+		log.Fatal(err)
+	}
+	provider, header, err := NewCaptchaProvider(s.cfg.CaptchaProvider, s.cfg.CaptchaSiteKey, s.cfg.CaptchaSecret, s.cfg.CaptchaAction, s.cfg.CaptchaTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if s.cfg.CaptchaHeader != "" {
+		header = s.cfg.CaptchaHeader
+	}
+	privacy := NewLogPrivacy(s.cfg.LogPrivacy, s.cfg.LogPrivacyKey)
+	clientIP := NewClientIPResolver(s.cfg.ProxyCount, s.cfg.RealIP, trusted)
+	captcha := NewCaptcha(provider, header, s.cfg.CaptchaMinScore, WithFailureStatus(s.cfg.CaptchaStatus), WithCaptchaClientIP(clientIP),
+		WithFailOpen(s.cfg.CaptchaFailOpen), WithBypassToken(s.cfg.CaptchaBypassToken),
+		WithMaxInFlight(s.cfg.CaptchaMaxInFlight))
+	if s.cfg.CaptchaBypassToken != "" {
+		log.Warn("Captcha bypass token is set, claims presenting it skip captcha verification. Never use it in production")
+	}
+	corsHeaders := s.cfg.CORSHeaders
+	if len(corsHeaders) == 0 {
+		corsHeaders = []string{"Content-Type", header}
+	}
+	s.cors = NewCORS(s.cfg.CORSOrigins, s.cfg.CORSMethods, corsHeaders)
+	auth := NewAPIKeyAuth(s.cfg.APIKeys)
+	if s.cfg.GeoIPDatabase != "" {
+		s.geo = OpenGeoFilter(s.cfg.GeoIPDatabase, s.cfg.GeoIPMode, s.cfg.GeoIPCountries, clientIP, privacy)
+	}
+	notifier, err := NewNotifier(s.cfg.WebhookURL, s.cfg.WebhookEvents)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, faucet := range s.order {
+		// Each chain keeps its own cooldowns and nonces, even when they share a Redis store
+		faucetStore := store
+		var prefix string
+		if faucet.chainCfg.Name != "" {
+			prefix = faucet.chainCfg.Name + ":"
+			faucetStore = newPrefixedStore(store, prefix)
+		}
+		limitPrefix := prefix
+		if s.cfg.SharedCooldowns {
+			limitPrefix = ""
+		}
+		limitOpts := []LimiterOption{WithIPv6Prefix(s.cfg.IPv6Prefix), WithSlidingWindow(s.cfg.SlidingWindow), WithKeyStrategy(limitKeys[s.cfg.LimitKey]), WithKeyPrefix(limitPrefix),
+			WithLogPrivacy(privacy), WithWaitRounding(s.cfg.WaitRounding), WithStoreFailure(s.cfg.StoreFailure)}
+		if s.cfg.TokenBucket {
+			limitOpts = append(limitOpts, WithTokenBucket(s.cfg.AddressBurst, s.cfg.IPBurst))
+		}
+		if s.cfg.NewAddressInterval > 0 {
+			limitOpts = append(limitOpts, WithNewAddressInterval(time.Duration(s.cfg.NewAddressInterval)*time.Minute))
+		}
+		faucet.limiter = NewLimiter(store, clientIP, time.Duration(s.cfg.Interval)*time.Minute, time.Duration(s.cfg.IPInterval)*time.Minute, s.cfg.IPBuckets, allowlist, denylist, limitOpts...)
+		// API key claims are only limited per address, and never share cooldowns with public ones
+		faucet.keyLimiter = NewLimiter(store, clientIP, time.Duration(s.cfg.APIKeyInterval)*time.Minute, 0, 1, allowlist, denylist,
+			WithKeyPrefix(limitPrefix+"apikey:"), WithLogPrivacy(privacy), WithWaitRounding(s.cfg.WaitRounding), WithStoreFailure(s.cfg.StoreFailure))
+		faucet.readLimiter = NewReadLimiter(newPrefixedStore(store, limitPrefix), s.cfg.ReadLimit, s.cfg.ReadWindow, faucet.limiter.networkKey)
+		if s.cfg.RequireSignature {
+			faucet.proof = NewOwnershipProof(faucetStore, s.cfg.NonceTTL, clientIP.ClientIP)
+		}
+		faucet.totals = NewTotals(&prefixedCounters{counters: counters, prefix: prefix})
+		registerCollector(newBalanceCollector(faucet, faucet.network()))
+		registerCollector(newTotalsCollector(faucet.totals, faucet.chainCfg.Tokens, faucet.network()))
+		faucet.notifier = notifier
+		faucet.privacy = privacy
+		faucet.geo = s.geo
+
+		faucet.handler = faucet.routes(captcha, auth, blocked)
+	}
+	primary := http.StripPrefix("/api", s.primary.handler)
+	router.Handle("/api/claim", primary)
+	if s.cfg.ClaimPath != "" && s.cfg.ClaimPath != "/api/claim" {
+		router.Handle(s.cfg.ClaimPath, s.primary.claim)
+	}
+	router.Handle("/api/claims", primary)
+	router.Handle("/api/info", primary)
+	router.Handle("/api/job", primary)
+	router.Handle("/api/nonce", primary)
+	router.Handle("/api/rpc", primary)
+	router.Handle("/api/status", primary)
+	router.HandleFunc("/api/", s.dispatch)
+	if s.cfg.AllowlistFile != "" || s.cfg.DenylistFile != "" {
+		go s.watchAccessLists()
+	}
+	router.Handle("/metrics", promhttp.Handler())
+	// Probes sit outside /api, so no claim middleware applies to them
+	router.Handle("/healthz", s.handleHealthz())
+	router.Handle("/readyz", s.handleReadyz())
 
 	return router
 }
 
-func (s *Server) Run() {
-	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
-	n.UseHandler(s.setupRouter())
-	log.Infof("Starting http server %d", s.cfg.httpPort)
-	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(s.cfg.httpPort), n))
+// dispatch routes /api/{name}/... to the faucet registered under name.
+func (s *Server) dispatch(w http.ResponseWriter, r *http.Request) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+	faucet, ok := s.faucets[name]
+	if !ok {
+		notFound(w, r)
+		return
+	}
+	http.StripPrefix("/api/"+name, faucet.handler).ServeHTTP(w, r)
+}
+
+func (s *Server) loadAccessLists() (*AccessList, *AccessList, error) {
+	allowlist, err := LoadAccessList(s.cfg.Allowlist, s.cfg.AllowlistFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load allowlist: %w", err)
+	}
+	denylist, err := LoadAccessList(s.cfg.Denylist, s.cfg.DenylistFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load denylist: %w", err)
+	}
+	return allowlist, denylist, nil
 }
 
-func (s *Server) handleClaim() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
-			http.NotFound(w, r)
+// watchAccessLists owns reloading the list files on SIGHUP or every AccessListInterval.
+// It is the only writer, and swaps in complete lists through SetAccessLists so that
+// concurrent ServeHTTP readers see either the old or the new lists, never a mix.
+// When a file fails to parse the previous lists stay in effect.
+func (s *Server) watchAccessLists() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if s.cfg.AccessListInterval > 0 {
+		ticker := time.NewTicker(s.cfg.AccessListInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+		case <-tick:
+		case <-s.ctx.Done():
+			signal.Stop(hup)
 			return
 		}
 
-		// The error always be nil since it has already been handled in limiter
-		address, _ := readAddress(r)
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-		defer cancel()
-		txHash, err := s.Transfer(ctx, address, chain.EtherToWei(s.cfg.payout))
+		allowlist, denylist, err := s.loadAccessLists()
 		if err != nil {
-			log.WithError(err).Error("Failed to send transaction")
-			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusInternalServerError)
-			return
+			log.WithError(err).Error("Failed to reload access lists, keeping the previous ones")
+			continue
 		}
-
-		log.WithFields(log.Fields{
-			"txHash":  txHash,
-			"address": address,
-		}).Info("Transaction sent successfully")
-		resp := claimResponse{Message: fmt.Sprintf("Txhash: %s", txHash)}
-		renderJSON(w, resp, http.StatusOK)
+		for _, faucet := range s.order {
+			faucet.limiter.SetAccessLists(allowlist, denylist)
+			faucet.keyLimiter.SetAccessLists(allowlist, denylist)
+		}
+		log.Debug("Access lists reloaded")
 	}
 }
 
-func (s *Server) handleInfo() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "GET" {
-			http.NotFound(w, r)
-			return
+// Run serves HTTP until ctx is done, then shuts down gracefully: it stops accepting
+// connections and waits up to ShutdownTimeout for in-flight claims and queued
+// transactions before cancelling them and closing the rate limit store.
+func (s *Server) Run(ctx context.Context) {
+	router := s.setupRouter()
+	if s.cfg.DryRun {
+		log.Warn("Dry run mode, claims are validated and signed but no transactions are broadcast")
+	}
+	// The request ID is assigned before anything logs, and Messages runs before CORS, so even
+	// CORS rejections are answered in the client's language
+	accessLog := negroni.NewLogger()
+	accessLog.SetFormat(negroni.LoggerDefaultFormat + ` | {{.Request.Header.Get "X-Request-ID"}}`)
+	n := negroni.New(negroni.HandlerFunc(requestID), negroni.NewRecovery(), accessLog, s.cfg.Messages, s.cors)
+	n.UseHandler(router)
+	if s.cfg.DiscordToken != "" {
+		bot, err := NewDiscordBot(s.cfg.DiscordToken, s.cfg.DiscordGuildID, s.primary)
+		if err == nil {
+			err = bot.Open()
+		}
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to start Discord bot: %w", err))
+		}
+		defer bot.Close()
+		log.Info("Discord bot started")
+	}
+	if s.cfg.TelegramToken != "" {
+		bot, err := NewTelegramBot(s.cfg.TelegramToken, s.primary)
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to start Telegram bot: %w", err))
+		}
+		go bot.Run()
+		defer bot.Stop()
+		log.Info("Telegram bot started")
+	}
+	srv := &http.Server{
+		Addr:    ":" + strconv.Itoa(s.cfg.HTTPPort),
+		Handler: n,
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		if s.cfg.tlsEnabled() {
+			log.Infof("Starting https server %d", s.cfg.HTTPPort)
+		} else {
+			log.Infof("Starting http server %d", s.cfg.HTTPPort)
+		}
+		errc <- s.listenAndServe(srv)
+	}()
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	log.Info("Shutting down, waiting for pending claims")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("Failed to finish in-flight requests")
+	}
+	for _, faucet := range s.order {
+		if err := faucet.queue.Close(shutdownCtx); err != nil {
+			log.WithError(err).WithField("network", faucet.network()).Warn("Failed to drain transaction queue")
 		}
-		renderJSON(w, infoResponse{
-			Account:         s.Sender().String(),
-			Network:         s.cfg.network,
-			Symbol:          s.cfg.symbol,
-			Payout:          strconv.FormatFloat(s.cfg.payout, 'f', -1, 64),
-			Interval:        s.cfg.interval,
-			HcaptchaSiteKey: s.cfg.hcaptchaSiteKey,
-		}, http.StatusOK)
+	}
+	s.cancel()
+
+	if closer, ok := s.store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.WithError(err).Warn("Failed to close rate limit store")
+		}
+	}
+	if err := s.geo.Close(); err != nil {
+		log.WithError(err).Warn("Failed to close GeoIP database")
+	}
+	log.Info("Server stopped")
+}
+
+// trustedProxies returns nil unless proxy ranges are configured, keeping the proxyCount behaviour.
+func (s *Server) trustedProxies() (*AccessList, error) {
+	if len(s.cfg.TrustedProxies) == 0 {
+		return nil, nil
+	}
+	trusted, err := NewAccessList(s.cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trusted proxies: %w", err)
+	}
+	return trusted, nil
+}
+
+// newCounters keeps the lifetime totals next to the rate limits in Redis, or else in
+// Config.TotalsFile. Without either they count since the process started.
+func (s *Server) newCounters(store Store) (Counters, error) {
+	if redisStore, ok := store.(*RedisStore); ok {
+		return NewRedisCounters(redisStore), nil
+	}
+	if s.cfg.TotalsFile != "" {
+		return NewFileCounters(s.cfg.TotalsFile)
+	}
+	return NewMemoryCounters(), nil
+}
+
+func (s *Server) newStore() (Store, error) {
+	switch {
+	case s.cfg.RedisURL != "":
+		return NewRedisStore(s.cfg.RedisURL)
+	case s.cfg.StateFile != "":
+		return NewFileStore(s.cfg.StateFile, s.cfg.StateInterval)
+	default:
+		return NewMemoryStore(), nil
 	}
 }
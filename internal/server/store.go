@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrNotFound = errors.New("key not found")
+
+// Store keeps rate limit entries that expire after their TTL.
+// Get returns ErrNotFound for missing or expired keys. SetIfAbsent sets key atomically unless
+// it is present, and reports whether it did, so instances sharing a store can reserve keys.
+type Store interface {
+	Get(key string) (time.Duration, error)
+	SetWithTTL(key string, ttl time.Duration) error
+	SetIfAbsent(key string, ttl time.Duration) (bool, error)
+	Remove(key string) error
+}
+
+type MemoryStore struct {
+	// mu makes SetIfAbsent atomic with the writes of other keys' callers
+	mu    sync.Mutex
+	cache *ttlcache.Cache
+}
+
+func NewMemoryStore() *MemoryStore {
+	cache := ttlcache.NewCache()
+	cache.SkipTTLExtensionOnHit(true)
+	return &MemoryStore{cache: cache}
+}
+
+func (m *MemoryStore) Get(key string) (time.Duration, error) {
+	_, ttl, err := m.cache.GetWithTTL(key)
+	if errors.Is(err, ttlcache.ErrNotFound) {
+		return 0, ErrNotFound
+	}
+	return ttl, err
+}
+
+func (m *MemoryStore) SetWithTTL(key string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cache.SetWithTTL(key, true, ttl)
+}
+
+func (m *MemoryStore) SetIfAbsent(key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.cache.Get(key)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ttlcache.ErrNotFound) {
+		return false, err
+	}
+	return true, m.cache.SetWithTTL(key, true, ttl)
+}
+
+func (m *MemoryStore) Remove(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.cache.Remove(key)
+	if errors.Is(err, ttlcache.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// FileStore is a MemoryStore that snapshots its entries to a file every interval and on Close,
+// and restores them on startup, so a restart of a single instance keeps the cooldowns.
+// Entries are saved with their absolute expiry, time spent offline counts towards the TTL.
+type FileStore struct {
+	*MemoryStore
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewFileStore(path string, interval time.Duration) (*FileStore, error) {
+	store := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	go store.run(interval)
+	return store, nil
+}
+
+func (f *FileStore) run(interval time.Duration) {
+	defer close(f.done)
+	if interval <= 0 {
+		<-f.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.save(); err != nil {
+				log.WithError(err).Warn("Failed to save rate limit state")
+			}
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// load restores the entries that did not expire while the faucet was down, a missing file is not an error.
+func (f *FileStore) load() error {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries map[string]int64
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", f.path, err)
+	}
+	now := time.Now()
+	for key, expiry := range entries {
+		if ttl := time.UnixMilli(expiry).Sub(now); ttl > 0 {
+			f.SetWithTTL(key, ttl)
+		}
+	}
+	return nil
+}
+
+// save writes every entry with its expiry in Unix milliseconds, replacing the file atomically.
+func (f *FileStore) save() error {
+	now := time.Now()
+	entries := make(map[string]int64)
+	for _, key := range f.cache.GetKeys() {
+		if ttl, err := f.Get(key); err == nil {
+			entries[key] = now.Add(ttl).UnixMilli()
+		}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+// writeFileAtomic replaces the file at path with data, so readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Close stops the snapshots and saves the final state.
+func (f *FileStore) Close() error {
+	close(f.stop)
+	<-f.done
+	return f.save()
+}
+
+// prefixedStore namespaces the keys of a shared store.
+type prefixedStore struct {
+	store  Store
+	prefix string
+}
+
+func newPrefixedStore(store Store, prefix string) *prefixedStore {
+	return &prefixedStore{store: store, prefix: prefix}
+}
+
+func (p *prefixedStore) Get(key string) (time.Duration, error) {
+	return p.store.Get(p.prefix + key)
+}
+
+func (p *prefixedStore) SetWithTTL(key string, ttl time.Duration) error {
+	return p.store.SetWithTTL(p.prefix+key, ttl)
+}
+
+func (p *prefixedStore) SetIfAbsent(key string, ttl time.Duration) (bool, error) {
+	return p.store.SetIfAbsent(p.prefix+key, ttl)
+}
+
+func (p *prefixedStore) Remove(key string) error {
+	return p.store.Remove(p.prefix + key)
+}
+
+// RedisStore shares rate limit state between faucet instances.
+type RedisStore struct {
+	client  *redis.Client
+	timeout time.Duration
+}
+
+func NewRedisStore(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &RedisStore{
+		client:  redis.NewClient(opts),
+		timeout: 3 * time.Second,
+	}
+	ctx, cancel := store.context()
+	defer cancel()
+	if err := store.client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *RedisStore) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.timeout)
+}
+
+func (s *RedisStore) Get(key string) (time.Duration, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// PTTL reports -2 for missing keys and -1 for keys without expiry
+	if ttl < 0 {
+		return 0, ErrNotFound
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) SetWithTTL(key string, ttl time.Duration) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.client.Set(ctx, key, 1, ttl).Err()
+}
+
+func (s *RedisStore) SetIfAbsent(key string, ttl time.Duration) (bool, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.client.SetNX(ctx, key, 1, ttl).Result()
+}
+
+func (s *RedisStore) Remove(key string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.client.Del(ctx, key).Err()
+}
+
+// Close releases the connection pool, pending writes have already completed
+// since every operation waits for Redis to answer.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const telegramCommand = "faucet"
+
+// TelegramBot funds addresses sent with /faucet in chats and direct messages,
+// limiting each Telegram user to one claim per faucet interval.
+type TelegramBot struct {
+	api    *tgbotapi.BotAPI
+	faucet *Faucet
+}
+
+func NewTelegramBot(token string, faucet *Faucet) (*TelegramBot, error) {
+	api, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return nil, err
+	}
+	return &TelegramBot{api: api, faucet: faucet}, nil
+}
+
+// Run polls for updates until Stop is called, every claim is handled on its own goroutine.
+func (b *TelegramBot) Run() {
+	config := tgbotapi.NewUpdate(0)
+	config.Timeout = 60
+	for update := range b.api.GetUpdatesChan(config) {
+		msg := update.Message
+		if msg == nil || msg.From == nil || !msg.IsCommand() || msg.Command() != telegramCommand {
+			continue
+		}
+		go b.handleCommand(msg)
+	}
+}
+
+func (b *TelegramBot) Stop() {
+	b.api.StopReceivingUpdates()
+}
+
+func (b *TelegramBot) handleCommand(msg *tgbotapi.Message) {
+	address := strings.TrimSpace(msg.CommandArguments())
+	if address == "" {
+		b.reply(msg, "Usage: /faucet <address>")
+		return
+	}
+
+	result, err := b.faucet.claimFor(context.Background(), "telegram:"+strconv.FormatInt(msg.From.ID, 10), address)
+	if err != nil {
+		b.reply(msg, botErrorMessage(err))
+		return
+	}
+	b.reply(msg, fmt.Sprintf("Sent %s %s, txhash: %s", formatAmount(b.faucet.chainCfg.Payout), b.faucet.chainCfg.Symbol, strings.Join(result.txHashes, ", "))+botCoolingDown(result))
+}
+
+func (b *TelegramBot) reply(msg *tgbotapi.Message, text string) {
+	reply := tgbotapi.NewMessage(msg.Chat.ID, text)
+	reply.ReplyToMessageID = msg.MessageID
+	if _, err := b.api.Send(reply); err != nil {
+		log.WithError(err).Warn("Failed to reply to Telegram command")
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsEnabled reports whether the server terminates TLS itself, rather than a reverse proxy.
+func (c *Config) tlsEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSDomain != ""
+}
+
+// listenAndServe serves srv over TLS when configured, and plain HTTP otherwise. Go enables
+// HTTP/2 on TLS connections by itself.
+func (s *Server) listenAndServe(srv *http.Server) error {
+	switch {
+	case s.cfg.TLSDomain != "":
+		// Certificates are obtained through the TLS-ALPN-01 challenge, which Let's Encrypt only
+		// sends to port 443, so the server must be reachable there on HTTPPort
+		if s.cfg.HTTPPort != 443 {
+			log.Warnf("Let's Encrypt verifies %s on port 443, the certificate cannot be obtained unless it is forwarded to port %d", s.cfg.TLSDomain, s.cfg.HTTPPort)
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.cfg.TLSDomain),
+			Cache:      autocert.DirCache(s.cfg.TLSCacheDir),
+		}
+		srv.TLSConfig = m.TLSConfig()
+		return srv.ListenAndServeTLS("", "")
+	case s.cfg.TLSCertFile != "":
+		return srv.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	default:
+		return srv.ListenAndServe()
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+// Counters keep the lifetime totals of the faucets. Add is atomic, also between the instances
+// sharing a Redis counter store, and Get returns zero for counters never added to.
+type Counters interface {
+	Add(key string, delta *big.Int) error
+	Get(key string) (*big.Int, error)
+}
+
+// MemoryCounters count since the process started.
+type MemoryCounters struct {
+	mu     sync.Mutex
+	values map[string]*big.Int
+}
+
+func NewMemoryCounters() *MemoryCounters {
+	return &MemoryCounters{values: make(map[string]*big.Int)}
+}
+
+func (c *MemoryCounters) Add(key string, delta *big.Int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, delta)
+	return nil
+}
+
+func (c *MemoryCounters) add(key string, delta *big.Int) {
+	value, ok := c.values[key]
+	if !ok {
+		value = new(big.Int)
+		c.values[key] = value
+	}
+	value.Add(value, delta)
+}
+
+func (c *MemoryCounters) Get(key string) (*big.Int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if value, ok := c.values[key]; ok {
+		return new(big.Int).Set(value), nil
+	}
+	return new(big.Int), nil
+}
+
+// FileCounters are MemoryCounters that rewrite their file on every Add, so the totals survive
+// restarts without a Redis store.
+type FileCounters struct {
+	*MemoryCounters
+	path string
+}
+
+// NewFileCounters restores the counters saved at path, a missing file starts them at zero.
+func NewFileCounters(path string) (*FileCounters, error) {
+	c := &FileCounters{MemoryCounters: NewMemoryCounters(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Amounts are decimal strings, wei totals soon outgrow JSON numbers
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for key, value := range values {
+		amount, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse %s: invalid total %q of %s", path, value, key)
+		}
+		c.values[key] = amount
+	}
+	return c, nil
+}
+
+func (c *FileCounters) Add(key string, delta *big.Int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, delta)
+	values := make(map[string]string, len(c.values))
+	for key, value := range c.values {
+		values[key] = value.String()
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path, data)
+}
+
+// RedisCounters keep the totals in the Redis store as decimal strings, shared by every instance.
+type RedisCounters struct {
+	store *RedisStore
+}
+
+func NewRedisCounters(store *RedisStore) *RedisCounters {
+	return &RedisCounters{store: store}
+}
+
+const redisCountersPrefix = "totals:"
+
+// redisAddRetries bounds the optimistic transactions of an Add that lost a race
+const redisAddRetries = 10
+
+func (c *RedisCounters) Add(key string, delta *big.Int) error {
+	ctx, cancel := c.store.context()
+	defer cancel()
+
+	key = redisCountersPrefix + key
+	// INCRBY stops at 64 bits, so the sum is computed here under WATCH
+	add := func(tx *redis.Tx) error {
+		value, err := c.get(tx.Get(ctx, key))
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, value.Add(value, delta).String(), 0)
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < redisAddRetries; i++ {
+		err := c.store.client.Watch(ctx, add, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+func (c *RedisCounters) Get(key string) (*big.Int, error) {
+	ctx, cancel := c.store.context()
+	defer cancel()
+	return c.get(c.store.client.Get(ctx, redisCountersPrefix+key))
+}
+
+func (c *RedisCounters) get(cmd *redis.StringCmd) (*big.Int, error) {
+	value, err := cmd.Result()
+	if errors.Is(err, redis.Nil) {
+		return new(big.Int), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid total %q", value)
+	}
+	return amount, nil
+}
+
+// prefixedCounters namespaces the counters of a shared counter store.
+type prefixedCounters struct {
+	counters Counters
+	prefix   string
+}
+
+func (p *prefixedCounters) Add(key string, delta *big.Int) error {
+	return p.counters.Add(p.prefix+key, delta)
+}
+
+func (p *prefixedCounters) Get(key string) (*big.Int, error) {
+	return p.counters.Get(p.prefix + key)
+}
+
+// Totals counts the funded claims of a faucet and the base units it sent of the native currency
+// and of every token, over the lifetime of its counters.
+type Totals struct {
+	counters Counters
+}
+
+const (
+	totalClaimsKey = "claims"
+	totalNativeKey = "native"
+)
+
+func tokenTotalKey(token string) string {
+	return "token:" + strings.ToLower(token)
+}
+
+// totals is the lifetime totals of /api/info, in base units.
+type totals struct {
+	claims *big.Int
+	native *big.Int
+	tokens map[string]*big.Int
+}
+
+func NewTotals(counters Counters) *Totals {
+	return &Totals{counters: counters}
+}
+
+// record adds a funded claim that sent native wei and tokens. A failing counter is logged, the
+// claim was paid either way.
+func (t *Totals) record(native *big.Int, tokens []TokenPayout) {
+	if t == nil {
+		return
+	}
+	add := func(key string, delta *big.Int) {
+		if err := t.counters.Add(key, delta); err != nil {
+			log.WithError(err).WithField("counter", key).Warn("Failed to update lifetime total")
+		}
+	}
+	add(totalClaimsKey, big.NewInt(1))
+	if native.Sign() > 0 {
+		add(totalNativeKey, native)
+	}
+	for _, token := range tokens {
+		add(tokenTotalKey(token.Address), chain.ToBaseUnits(token.Amount, token.Decimals))
+	}
+}
+
+// read returns the totals of the native currency and of tokens.
+func (t *Totals) read(tokens []TokenPayout) (*totals, error) {
+	claims, err := t.counters.Get(totalClaimsKey)
+	if err != nil {
+		return nil, err
+	}
+	native, err := t.counters.Get(totalNativeKey)
+	if err != nil {
+		return nil, err
+	}
+	result := &totals{claims: claims, native: native, tokens: make(map[string]*big.Int, len(tokens))}
+	for _, token := range tokens {
+		amount, err := t.counters.Get(tokenTotalKey(token.Address))
+		if err != nil {
+			return nil, err
+		}
+		result.tokens[token.Address] = amount
+	}
+	return result, nil
+}
+
+func (t *totals) info() *totalsInfo {
+	info := &totalsInfo{Claims: t.claims.String(), DispensedWei: t.native.String()}
+	if len(t.tokens) > 0 {
+		info.Tokens = make(map[string]string, len(t.tokens))
+		for token, amount := range t.tokens {
+			info.Tokens[token] = amount.String()
+		}
+	}
+	return info
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/chainflag/eth-faucet/internal/chain"
+)
+
+func TestTotals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "totals.json")
+	counters, err := NewFileCounters(path)
+	if err != nil {
+		t.Fatalf("NewFileCounters() error = %v", err)
+	}
+	token := TokenPayout{Address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Amount: 2.5, Decimals: 6}
+	totals := NewTotals(&prefixedCounters{counters: counters, prefix: "sepolia:"})
+	// Beyond 64 bits, as wei totals get
+	native, _ := new(big.Int).SetString("20000000000000000000", 10)
+	totals.record(native, []TokenPayout{token})
+	totals.record(chain.EtherToWei(0.5), nil)
+	totals.record(new(big.Int), []TokenPayout{token})
+
+	// The counters survive a restart
+	counters, err = NewFileCounters(path)
+	if err != nil {
+		t.Fatalf("NewFileCounters() of a saved file error = %v", err)
+	}
+	got, err := NewTotals(&prefixedCounters{counters: counters, prefix: "sepolia:"}).read([]TokenPayout{token})
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	info := got.info()
+	if info.Claims != "3" || info.DispensedWei != "20500000000000000000" || info.Tokens[token.Address] != "5000000" {
+		t.Errorf("totals = %+v, want 3 claims, 20.5 ether and 5000000 token units", info)
+	}
+
+	// Other chains sharing the counters start at zero
+	other, err := NewTotals(&prefixedCounters{counters: counters, prefix: "holesky:"}).read(nil)
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	if info := other.info(); info.Claims != "0" || info.DispensedWei != "0" || info.Tokens != nil {
+		t.Errorf("totals of another chain = %+v, want zero", info)
+	}
+}
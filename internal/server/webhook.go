@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Webhook events, see Config.WebhookEvents.
+const (
+	EventClaim      = "claim"
+	EventLowBalance = "low_balance"
+)
+
+const (
+	webhookTimeout  = 30 * time.Second
+	webhookAttempts = 3
+	webhookBackoff  = time.Second
+)
+
+// Notifier posts faucet events to a Slack or Discord compatible webhook.
+// A nil Notifier drops every event.
+type Notifier struct {
+	client *http.Client
+	url    string
+	events map[string]bool
+}
+
+// NewNotifier returns a notifier posting the given events to url, all events when none are given.
+// It returns nil when url is empty.
+func NewNotifier(url string, events []string) (*Notifier, error) {
+	if url == "" {
+		return nil, nil
+	}
+	if len(events) == 0 {
+		events = []string{EventClaim, EventLowBalance}
+	}
+
+	enabled := make(map[string]bool, len(events))
+	for _, event := range events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		switch event {
+		case EventClaim, EventLowBalance:
+			enabled[event] = true
+		default:
+			return nil, fmt.Errorf("unknown webhook event %q", event)
+		}
+	}
+	return &Notifier{
+		client: &http.Client{Timeout: 10 * time.Second},
+		url:    url,
+		events: enabled,
+	}, nil
+}
+
+// webhookPayload carries the message as both "text" for Slack and "content" for Discord.
+type webhookPayload struct {
+	Event   string            `json:"event"`
+	Text    string            `json:"text"`
+	Content string            `json:"content"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Notify sends the event in the background, so a slow webhook never delays a claim.
+func (n *Notifier) Notify(event, message string, fields map[string]string) {
+	if n == nil || !n.events[event] {
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{Event: event, Text: message, Content: message, Fields: fields})
+	if err != nil {
+		log.WithError(err).Error("Failed to encode webhook payload")
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		defer cancel()
+		if err := n.post(ctx, body); err != nil {
+			log.WithError(err).WithField("event", event).Warn("Failed to send webhook")
+		}
+	}()
+}
+
+// post retries network errors and 5xx responses with exponential backoff.
+func (n *Notifier) post(ctx context.Context, body []byte) error {
+	backoff := webhookBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = n.send(ctx, body)
+		if !retry || attempt == webhookAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// send reports whether a failed request is worth retrying.
+func (n *Notifier) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return true, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		return false, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return false, nil
+}